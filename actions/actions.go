@@ -22,10 +22,18 @@ type ExecuteResult struct {
 	Success      bool
 	Advance      bool
 	NewTxn       string
+	Resume       bool // with Advance, start NewTxn at ResumeIdx instead of its first action
+	ResumeIdx    int
 	RegisterURL  string
 	RegisterUUID uuid.UUID
+	OnExpected   interface{} // an on_expected override picked by the action, such as a url rule's
+	Repeat       bool        // answer the request, but wait for another one before moving on
+	Fault        interface{} // the fault arg of the url action that answered the request
 }
 
+// Actions holds an instance of each built in action type.
+//
+// Deprecated: use Lookup and New, which know about registered actions too.
 type Actions struct {
 	Actions map[string]Action
 }
@@ -62,29 +70,33 @@ type ArgStruct struct {
 type QueueContext struct {
 	Ctx      *gin.Context
 	Finished chan bool
+	Body     []byte            // the request body, once it's been read
+	Params   map[string]string // the path parameters of the url action that matched
 }
 
-var ActionsArr = map[string]Action{
-	"advance":     &Advance{},
-	"callback":    &Callback{},
-	"cbsplit":     &CbSplit{},
-	"cbfinish":    &CbFinish{},
-	"conditional": &Conditional{},
-	"log":         &Log{},
-	"match":       &Match{},
-	"math":        &Math{},
-	"set":         &Set{},
-	"wait":        &Wait{},
-	"test":        &Test{},
-	"url":         &URL{},
-}
+// ActionsArr has an instance of each built in action type.  The instances
+// are shared, and actions added with Register aren't in it.
+//
+// Deprecated: use Lookup to check for a type, and New for an instance.
+var ActionsArr = builtinActions()
 
+// NewActions returns the built in action types.
+//
+// Deprecated: use New.
 func NewActions() *Actions {
 	a := &Actions{}
 	a.Actions = ActionsArr
 	return a
 }
 
+func builtinActions() map[string]Action {
+	m := make(map[string]Action, len(builtins))
+	for _, r := range builtins {
+		m[r.Name] = r.Factory()
+	}
+	return m
+}
+
 func (a *ArgStruct) SetArg(n string, i interface{}) error {
 	if a.Args == nil {
 		a.Args = make(map[string]interface{}, 0)
@@ -122,14 +134,16 @@ func (a *ArgStruct) GetArg(n string, t reflect.Type, required bool) (interface{}
 	return arg, nil
 }
 
-// DoAction executes the respective action requested, executing
-// callbacks, advancing, waiting, or resetting as needed.
+// Execute creates a new action of type t and runs it.  An unknown type is
+// returned as an error.
 func Execute(t string, a map[string]interface{}, p *plan.Plan) (Action, ExecuteResult) {
 
 	logger := loggo.GetLogger("default")
 	logger.Tracef("starting execute execute: action %s", t)
-	as := NewActions()
-	action := as.Actions[t]
+	action, err := New(t)
+	if err != nil {
+		return nil, ExecuteResult{Complete: true, Err: err}
+	}
 	action.SetArgs(a)
 	return action, action.Execute(p)
 }
@@ -137,8 +151,10 @@ func Execute(t string, a map[string]interface{}, p *plan.Plan) (Action, ExecuteR
 func Satisfy(t string, a map[string]interface{}) (bool, error) {
 	logger := loggo.GetLogger("default")
 	logger.Tracef("starting execute execute: action %s", t)
-	as := NewActions()
-	action := as.Actions[t]
+	action, err := New(t)
+	if err != nil {
+		return false, err
+	}
 	action.SetArgs(a)
 	return action.Satisfy()
 }
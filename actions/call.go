@@ -0,0 +1,208 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/state"
+	"github.com/homedepot/trainer/structs/transaction"
+	"github.com/juju/loggo"
+	"github.com/mohae/deepcopy"
+	"reflect"
+)
+
+// MaxCallDepth is how deeply plans can call each other before we assume
+// one of them is calling itself forever.
+const MaxCallDepth = 32
+
+type Call struct {
+	Action
+	Args ArgStruct
+}
+
+func (c *Call) GetName() string {
+	return "call"
+}
+func (c *Call) Abort() {
+	return
+}
+
+func (c *Call) Execute(p *plan.Plan) (r ExecuteResult) {
+	logger := loggo.GetLogger("default")
+	logger.Tracef("Executing call action")
+
+	r.Complete = true
+
+	name, err := c.Args.GetArg("plan", reflect.TypeOf(""), true)
+	if err != nil {
+		r.Err = fmt.Errorf("couldnt get plan: %w", err)
+		return
+	}
+	callee, err := p.FindLibraryPlan(name.(string))
+	if err != nil {
+		r.Err = err
+		return
+	}
+	if len(p.State.CallStack) >= MaxCallDepth {
+		r.Err = fmt.Errorf("calls nested more than %d deep", MaxCallDepth)
+		return
+	}
+
+	scope, err := c.Args.GetArg("scope", reflect.TypeOf(""), false)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	isolated := true
+	if scope != nil {
+		switch scope.(string) {
+		case "", "isolated":
+		case "shared":
+			isolated = false
+		default:
+			r.Err = fmt.Errorf("invalid scope %s", scope.(string))
+			return
+		}
+	}
+
+	inputs, err := StringMap(c.Args.Args["inputs"])
+	if err != nil {
+		r.Err = fmt.Errorf("inputs: %w", err)
+		return
+	}
+	outputs, err := StringMap(c.Args.Args["outputs"])
+	if err != nil {
+		r.Err = fmt.Errorf("outputs: %w", err)
+		return
+	}
+
+	// the called plan gets its own copy of the transactions, the same as the
+	// plan that was launched did.
+	txns := deepcopy.Copy(callee.Txn).([]transaction.Transaction)
+	start, err := callee.GetFirstTxn()
+	if err != nil {
+		r.Err = err
+		return
+	}
+	starttxn := start.Name
+	if t, ok := c.Args.Args["txn"].(string); ok && t != "" {
+		starttxn = t
+	}
+	found := false
+	for i := range txns {
+		if txns[i].Name == starttxn {
+			found = true
+		}
+	}
+	if !found {
+		r.Err = fmt.Errorf("plan %s has no transaction %s", callee.Name, starttxn)
+		return
+	}
+
+	// gather the inputs before the variables change underneath us.
+	in := make(map[string]interface{})
+	for k, v := range inputs {
+		i, err := p.State.GetVariable(v)
+		if err != nil {
+			r.Err = fmt.Errorf("couldnt get input variable %s: %w", v, err)
+			return
+		}
+		in[k] = deepcopy.Copy(i)
+	}
+
+	frame := &state.CallFrame{
+		Plan:      callee.Name,
+		ReturnTxn: p.State.Transaction,
+		ReturnIdx: p.State.TxnActionIdx,
+		Isolated:  isolated,
+		Outputs:   outputs,
+		Txn:       txns,
+	}
+	defaults, _ := deepcopy.Copy(callee.DefaultVars).(map[string]interface{})
+	if defaults == nil {
+		defaults = make(map[string]interface{})
+	}
+	if isolated {
+		frame.Variables = p.State.Variables
+		p.State.Variables = defaults
+	} else {
+		// the caller's variables win, the called plan's are only defaults.
+		for k, v := range defaults {
+			if _, ok := p.State.Variables[k]; !ok {
+				p.State.Variables[k] = v
+			}
+		}
+	}
+	for k, v := range in {
+		delete(p.State.Variables, k)
+		err = p.State.SetVariable(k, v)
+		if err != nil {
+			r.Err = fmt.Errorf("couldnt set input variable %s: %w", k, err)
+			if isolated {
+				p.State.Variables = frame.Variables
+			}
+			return
+		}
+	}
+	p.State.CallStack = append(p.State.CallStack, frame)
+
+	logger.Debugf("calling plan %s at %s", callee.Name, starttxn)
+	r.Advance = true
+	r.NewTxn = starttxn
+	r.Success = true
+	return
+}
+
+func (c *Call) SetArgs(i map[string]interface{}) {
+	c.Args.Args = i
+}
+
+func (c *Call) Satisfy() (bool, error) {
+	return false, errors.New("cannot use satisfy_group for Call action: there are no conditions to satisfy")
+}
+
+func (c *Call) GetContext() (*context.Context, *context.CancelFunc) {
+	return nil, nil
+}
+
+func (c *Call) CanBackground() bool {
+	return false
+}
+
+func (c *Call) IsBackgrounded() bool {
+	return false
+}
+
+// StringMap converts a yaml map of strings to strings.  A missing map is
+// just an empty one.
+func StringMap(i interface{}) (map[string]string, error) {
+	out := make(map[string]string)
+	switch m := i.(type) {
+	case nil:
+	case map[interface{}]interface{}:
+		for k, v := range m {
+			vs, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("value for %v is not a string", k)
+			}
+			out[fmt.Sprint(k)] = vs
+		}
+	case map[string]interface{}:
+		for k, v := range m {
+			vs, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("value for %v is not a string", k)
+			}
+			out[k] = vs
+		}
+	default:
+		return nil, errors.New("not a map")
+	}
+	return out, nil
+}
@@ -0,0 +1,163 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/state"
+	"github.com/homedepot/trainer/structs/transaction"
+	"reflect"
+	"testing"
+)
+
+func callPlan(vars map[string]interface{}) *plan.Plan {
+	return &plan.Plan{
+		Name: "caller",
+		Txn: []transaction.Transaction{
+			{Name: "start"},
+			{Name: "next"},
+		},
+		Library: []plan.Plan{
+			{
+				Name: "login",
+				Txn: []transaction.Transaction{
+					{Name: "login_start"},
+					{Name: "login_other"},
+				},
+				DefaultVars: map[string]interface{}{
+					"user":  "default",
+					"realm": "store",
+				},
+			},
+		},
+		State: &state.State{
+			Transaction:  "start",
+			TxnActionIdx: 2,
+			Variables:    vars,
+		},
+	}
+}
+
+func TestCall_Execute(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     map[string]interface{}
+		vars     map[string]interface{}
+		wantR    ExecuteResult
+		wantVars map[string]interface{}
+		wantErr  bool
+	}{
+		{
+			name: "isolated",
+			args: map[string]interface{}{
+				"plan":   "login",
+				"inputs": map[interface{}]interface{}{"user": "name"},
+			},
+			vars:     map[string]interface{}{"name": "bob", "other": "x"},
+			wantR:    ExecuteResult{Complete: true, Success: true, Advance: true, NewTxn: "login_start"},
+			wantVars: map[string]interface{}{"user": "bob", "realm": "store"},
+		},
+		{
+			name: "shared",
+			args: map[string]interface{}{
+				"plan":  "login",
+				"scope": "shared",
+				"txn":   "login_other",
+			},
+			vars:     map[string]interface{}{"user": "bob"},
+			wantR:    ExecuteResult{Complete: true, Success: true, Advance: true, NewTxn: "login_other"},
+			wantVars: map[string]interface{}{"user": "bob", "realm": "store"},
+		},
+		{
+			name:    "unknown plan",
+			args:    map[string]interface{}{"plan": "logout"},
+			vars:    map[string]interface{}{},
+			wantErr: true,
+		},
+		{
+			name:    "unknown transaction",
+			args:    map[string]interface{}{"plan": "login", "txn": "nope"},
+			vars:    map[string]interface{}{},
+			wantErr: true,
+		},
+		{
+			name:    "bad scope",
+			args:    map[string]interface{}{"plan": "login", "scope": "global"},
+			vars:    map[string]interface{}{},
+			wantErr: true,
+		},
+		{
+			name: "missing input",
+			args: map[string]interface{}{
+				"plan":   "login",
+				"inputs": map[interface{}]interface{}{"user": "name"},
+			},
+			vars:    map[string]interface{}{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := callPlan(tt.vars)
+			c := &Call{Args: ArgStruct{Args: tt.args}}
+			r := c.Execute(p)
+			if (r.Err != nil) != tt.wantErr {
+				t.Errorf("Execute() error = %v, wantErr %v", r.Err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if len(p.State.CallStack) != 0 {
+					t.Errorf("Execute() left a frame behind")
+				}
+				return
+			}
+			if !reflect.DeepEqual(r, tt.wantR) {
+				t.Errorf("Execute() = %v, want %v", r, tt.wantR)
+			}
+			if !reflect.DeepEqual(p.State.Variables, tt.wantVars) {
+				t.Errorf("Execute() variables = %v, want %v", p.State.Variables, tt.wantVars)
+			}
+			if _, err := p.FindTransaction(tt.wantR.NewTxn); err != nil {
+				t.Errorf("FindTransaction() in called plan: %v", err)
+			}
+		})
+	}
+}
+
+func TestReturn_Execute(t *testing.T) {
+	p := callPlan(map[string]interface{}{"name": "bob"})
+	c := &Call{Args: ArgStruct{Args: map[string]interface{}{
+		"plan":    "login",
+		"inputs":  map[interface{}]interface{}{"user": "name"},
+		"outputs": map[interface{}]interface{}{"token": "user"},
+	}}}
+	r := c.Execute(p)
+	if r.Err != nil {
+		t.Fatalf("Call Execute() error = %v", r.Err)
+	}
+
+	rt := &Return{}
+	r = rt.Execute(p)
+	if r.Err != nil {
+		t.Fatalf("Return Execute() error = %v", r.Err)
+	}
+	want := ExecuteResult{Complete: true, Success: true, Advance: true, NewTxn: "start", Resume: true, ResumeIdx: 3}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("Return Execute() = %v, want %v", r, want)
+	}
+	wantVars := map[string]interface{}{"name": "bob", "token": "bob"}
+	if !reflect.DeepEqual(p.State.Variables, wantVars) {
+		t.Errorf("Return Execute() variables = %v, want %v", p.State.Variables, wantVars)
+	}
+	if len(p.State.CallStack) != 0 {
+		t.Errorf("Return Execute() left %d frames", len(p.State.CallStack))
+	}
+
+	r = rt.Execute(p)
+	if r.Err == nil {
+		t.Errorf("Return Execute() without a call should fail")
+	}
+}
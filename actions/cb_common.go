@@ -33,24 +33,53 @@ func DoCallback(a ArgStruct, p *plan.Plan, ctx context.Context) (r ExecuteResult
 
 	r.Complete = true
 
-	iargs, err := ParseTemplate(p, a.Args)
+	code, rs, err := SendCallback(&a, p, ctx)
 	if err != nil {
-		logger.Warningf("Parsing action template failed, aborting test")
 		r.Err = err
 		return
 	}
+	var ignorefailure bool
+	ign, ok := a.Args["ignore_failure"]
+	if ok {
+		ignorefailure = ign.(bool)
+	}
+	if ignorefailure == true {
+		logger.Tracef("ignore_failure set, ignoring response code")
+	} else if code != 200 {
+		r.Err = fmt.Errorf("callback did not succeed (code %v)", code)
+		return
+	}
+
+	_, err = SaveCallbackResponse(a, p, rs)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	r.Success = true
+	return
+}
+
+// SendCallback templates the args (in place), makes the request they
+// describe, and returns the status code and body of the response.
+func SendCallback(a *ArgStruct, p *plan.Plan, ctx context.Context) (int, []byte, error) {
+	logger := loggo.GetLogger("default")
+
+	iargs, err := ParseTemplate(p, a.Args)
+	if err != nil {
+		logger.Warningf("Parsing action template failed, aborting test")
+		return 0, nil, err
+	}
 	a.Args = iargs
 
 	// Get the callback method from the Action.
 	// If method is not POST or GET, exit function.
 	method, err := a.GetArg("method", reflect.TypeOf(""), false)
 	if err != nil {
-		r.Err = err
-		return
+		return 0, nil, err
 	}
 	methodstr := ""
 
-	if method == nil {
+	if method != nil {
 		methodstr = method.(string)
 	}
 
@@ -60,27 +89,23 @@ func DoCallback(a ArgStruct, p *plan.Plan, ctx context.Context) (r ExecuteResult
 
 	// TODO: should accept more methods.
 	if methodstr != "POST" && methodstr != "GET" {
-		r.Err = errors.New(fmt.Sprintf("invalid method %s", methodstr))
-		return r
+		return 0, nil, errors.New(fmt.Sprintf("invalid method %s", methodstr))
 	}
 
 	url, err := a.GetArg("url", reflect.TypeOf(""), true)
 	if err != nil {
-		r.Err = err
-		return r
+		return 0, nil, err
 	}
 	urlstr := url.(string)
 
 	if urlstr == "" {
-		r.Err = errors.New("callback url specified but empty")
-		return r
+		return 0, nil, errors.New("callback url specified but empty")
 	}
 
 	// Get payload content type.
 	pct, err := a.GetArg("url", reflect.TypeOf(""), false)
 	if err != nil {
-		r.Err = err
-		return r
+		return 0, nil, err
 	}
 
 	pctstr := "text/plain"
@@ -104,21 +129,20 @@ func DoCallback(a ArgStruct, p *plan.Plan, ctx context.Context) (r ExecuteResult
 	payload, err := a.GetArg("payload", reflect.TypeOf(""), false)
 	if err != nil {
 		logger.Warningf("invalid payload variable: %s", err)
-		r.Err = err
-		return r
+		return 0, nil, err
 	}
 
 	if payload != nil && payload.(string) != "" {
 		// Validate payload file path to prevent path traversal
 		if err := security.ValidatePath(payload.(string), ""); err != nil {
 			logger.Warningf("Payload file path validation failed: %s", err)
-			return
+			return 0, nil, err
 		}
-		
+
 		out, err := os.ReadFile(payload.(string))
 		if err != nil {
 			logger.Warningf("Couldn't read payload file: %s", payload.(string))
-			return
+			return 0, nil, err
 		}
 		payloadbody = string(out)
 	} else {
@@ -127,19 +151,23 @@ func DoCallback(a ArgStruct, p *plan.Plan, ctx context.Context) (r ExecuteResult
 
 	var resp *http.Response
 	var req *http.Request
-	if method == "GET" {
+	if methodstr == "GET" {
 		logger.Tracef("Sending GET")
 		req, err = http.NewRequest("GET", urlstr, strings.NewReader(""))
-	} else if method == "POST" {
+	} else if methodstr == "POST" {
 		logger.Tracef("Sending POST")
-		req, err = http.NewRequest("POST", urlstr, strings.NewReader(ParseStringTemplate(p, payloadbody)))
+		var body string
+		body, err = ParseStringTemplate(p, payloadbody)
+		if err != nil {
+			return 0, nil, fmt.Errorf("payload: %w", err)
+		}
+		req, err = http.NewRequest("POST", urlstr, strings.NewReader(body))
 	} else {
 		panic("We checked the methods before, but one seems to have slipped through.  FIXME.")
 	}
 	if err != nil {
 		logger.Warningf("NewRequest failed: %s", err.Error())
-		r.Err = err
-		return
+		return 0, nil, err
 	}
 	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", pctstr)
@@ -153,14 +181,12 @@ func DoCallback(a ArgStruct, p *plan.Plan, ctx context.Context) (r ExecuteResult
 			kstr, ok := k.(string)
 			if !ok {
 				logger.Warningf("header key %s is not a string", k)
-				r.Err = errors.New(fmt.Sprintf("header key %s is not a string", k))
-				return
+				return 0, nil, errors.New(fmt.Sprintf("header key %s is not a string", k))
 			}
 			str, ok := v.(string)
 			if !ok {
 				logger.Warningf("header value %s is not a string", k)
-				r.Err = errors.New(fmt.Sprintf("header key %s is not a string", k))
-				return
+				return 0, nil, errors.New(fmt.Sprintf("header key %s is not a string", k))
 			}
 			req.Header.Set(kstr, str)
 		}
@@ -169,52 +195,45 @@ func DoCallback(a ArgStruct, p *plan.Plan, ctx context.Context) (r ExecuteResult
 	resp, err = client.Do(req)
 	if err != nil {
 		logger.Warningf("Couldn't execute callback: %s", err.Error())
-		r.Err = err
-		return
+		return 0, nil, err
 	}
 	defer resp.Body.Close()
-	var ignorefailure bool
-	ign, ok := a.Args["ignore_failure"]
-	if ok {
-		ignorefailure = ign.(bool)
-	}
-	if ignorefailure == true {
-		logger.Tracef("ignore_failure set, ignoring response code")
-	} else if resp.StatusCode != 200 {
-		r.Err = fmt.Errorf("callback did not succeed (code %v)", resp.StatusCode)
-		return
-	}
 
 	rs, err := io.ReadAll(resp.Body)
 	if err != nil {
-		r.Err = err
-		return
+		return 0, nil, err
 	}
+	return resp.StatusCode, rs, nil
+}
+
+// SaveCallbackResponse decodes a response according to response_type and
+// saves it into the save_response, save_response_map and save variables.
+// The decoded response is returned (nil for a string).
+func SaveCallbackResponse(a ArgStruct, p *plan.Plan, rs []byte) (interface{}, error) {
+	logger := loggo.GetLogger("default")
+
 	var i interface{}
+	var err error
 	rtype, err := a.GetArg("response_type", reflect.TypeOf(""), false)
 	if err != nil {
 		logger.Warningf("couldn't get response_type variable: %s", err)
-		r.Err = err
-		return
+		return nil, err
 	}
 	if rtype != nil && rtype.(string) == "json" {
 		i, err = LoadJSON(string(rs))
 		if err != nil {
-			r.Err = err
-			return
+			return nil, err
 		}
 	} else if rtype != nil && rtype.(string) == "yaml" {
 		i, err = LoadYAML(string(rs))
 		if err != nil {
-			r.Err = err
-			return
+			return nil, err
 		}
-	} else if rtype != nil && rtype.(string) == "string" {
+	} else if rtype == nil || rtype.(string) == "string" {
 		// do nothing, response_map won't be set, but response will.
 		// don't set response_map if you want to use a string.
 	} else {
-		r.Err = errors.New(fmt.Sprintf("unknown response type: %s", rtype.(string)))
-		return
+		return nil, errors.New(fmt.Sprintf("unknown response type: %s", rtype.(string)))
 	}
 	imap, imapok := i.(map[string]interface{})
 	if imapok {
@@ -234,8 +253,7 @@ func DoCallback(a ArgStruct, p *plan.Plan, ctx context.Context) (r ExecuteResult
 		logger.Tracef("saving response as %s", saveresponse)
 		err := p.State.SetVariable(saveresponse.(string), string(rs))
 		if err != nil {
-			r.Err = err
-			return
+			return nil, err
 		}
 	}
 	save, ok := a.Args["save"]
@@ -251,6 +269,5 @@ func DoCallback(a ArgStruct, p *plan.Plan, ctx context.Context) (r ExecuteResult
 			p.State.Variables[v.(string)] = q.(string)
 		}
 	}
-	r.Success = true
-	return
+	return i, nil
 }
@@ -32,12 +32,59 @@ func (c *Conditional) Execute(p *plan.Plan) (r ExecuteResult) {
 
 	r.Complete = true
 
-	rawterm, ok := c.Args.Args["term"]
-	if !ok {
-		r.Err = errors.New("term is nil")
+	term, err := ParseTerm(c.Args.Args["term"])
+	if err != nil {
+		r.Err = err
+		return
+	}
+	result, err := term.Evaluate(p)
+	if err != nil {
+		r.Err = err
 		return
 	}
 
+	var advanceTxn interface{}
+	if result == true {
+		// advance to the txn in match_success
+		advanceTxn, err = c.Args.GetArg("advance_true", reflect.TypeOf(""), true)
+		if err != nil {
+			r.Err = errors.New("advance_true not set")
+			return
+		}
+	} else {
+		// advance to the txn in match_failure
+		advanceTxn, err = c.Args.GetArg("advance_false", reflect.TypeOf(""), true)
+		if err != nil {
+			r.Err = errors.New("advance_false not set")
+			return
+		}
+	}
+	logger.Tracef("Executing advance")
+	r.Advance = true
+	r.NewTxn = advanceTxn.(string)
+
+	r.Success = result
+	return
+}
+
+// ErrVariableNotSet is returned when a term refers to a variable that
+// doesn't exist (or is nil).
+var ErrVariableNotSet = errors.New("variable not set")
+
+// Term is a single comparison, the term arg of conditional and wait_until.
+type Term struct {
+	Variable         string
+	Conditional      string
+	ConditionalVar   string
+	ConditionalValue interface{}
+}
+
+// ParseTerm checks a term arg and turns it into a Term.
+func ParseTerm(rawterm interface{}) (*Term, error) {
+	if rawterm == nil {
+		return nil, errors.New("term is nil")
+	}
+
 	t := make(map[interface{}]interface{})
 	term, ok := rawterm.(map[interface{}]interface{})
 	if ok {
@@ -49,56 +96,58 @@ func (c *Conditional) Execute(p *plan.Plan) (r ExecuteResult) {
 				t[k] = v
 			}
 		} else {
-			r.Err = errors.New("term isn't a useful map")
-			return
+			return nil, errors.New("term isn't a useful map")
 		}
 	}
 
-	fmt.Printf("t: %v", t)
-	variable, ok := t["variable"].(string)
+	out := &Term{}
+	out.Variable, ok = t["variable"].(string)
 	if !ok {
-		r.Err = errors.New("no variable specified on left side of term")
-		return
+		return nil, errors.New("no variable specified on left side of term")
 	}
-	conditional, ok := t["conditional"].(string)
+	out.Conditional, ok = t["conditional"].(string)
 	if !ok {
-		r.Err = errors.New("no conditional specified in term")
-		return
+		return nil, errors.New("no conditional specified in term")
+	}
+
+	cvar, ok1 := t["conditional_var"].(string)
+	cval, ok2 := t["conditional_value"]
+	if !ok1 && !ok2 {
+		return nil, errors.New("must specify one of conditional_var or conditional_value")
 	}
+	out.ConditionalVar = cvar
+	out.ConditionalValue = cval
+	return out, nil
+}
+
+// Evaluate compares the term's variable against its conditional var or value.
+func (t *Term) Evaluate(p *plan.Plan) (bool, error) {
+	logger := loggo.GetLogger("default")
 
 	var leftop interface{}
 	var rightop interface{}
 	var err error
 
-	cvar, ok1 := t["conditional_var"].(string)
-	cval, ok2 := t["conditional_value"]
-
-	if !ok1 && !ok2 {
-		r.Err = errors.New("must specify one of conditional_var or conditional_value")
-		return
-	} else if ok1 {
-		rightop, err = p.State.GetVariable(cvar)
+	if t.ConditionalVar != "" {
+		rightop, err = p.State.GetVariable(t.ConditionalVar)
 		if err != nil {
 			logger.Warningf("Specified undeclared variable for conditional variable: %s", err)
-			r.Err = err
-			return
+			return false, fmt.Errorf("%w: %s", ErrVariableNotSet, err)
 		}
 	} else {
-		rightop = cval
+		rightop = t.ConditionalValue
 	}
 
 	logger.Tracef("Variables: %s", p.State.Variables)
-	leftop, err = p.State.GetVariable(variable)
+	leftop, err = p.State.GetVariable(t.Variable)
 	if err != nil {
 		logger.Warningf("Specified undeclared variable for conditional operation: %s", err)
-		r.Err = err
-		return
+		return false, fmt.Errorf("%w: %s", ErrVariableNotSet, err)
 	}
 
 	if leftop == nil {
-		logger.Warningf("Trying to compare a nil variable: %s", variable)
-		r.Err = errors.New("nil variable")
-		return
+		logger.Warningf("Trying to compare a nil variable: %s", t.Variable)
+		return false, fmt.Errorf("%w: nil variable %s", ErrVariableNotSet, t.Variable)
 	}
 
 	cond := NewConditionalOps()
@@ -106,35 +155,13 @@ func (c *Conditional) Execute(p *plan.Plan) (r ExecuteResult) {
 	cond.LeftOp = leftop
 	cond.RightOp = rightop
 
-	result, err := cond.Compare(conditional)
+	result, err := cond.Compare(t.Conditional)
 	if err != nil {
-		r.Err = err
-		return
-	}
-
-	logger.Tracef("Conditional:  leftop: %v (%s) rightop: %v (%s) operation: %s result: %v", cond.LeftOp, reflect.TypeOf(cond.LeftOp).String(), cond.RightOp, reflect.TypeOf(cond.RightOp).String(), conditional, result)
-	var advanceTxn interface{}
-	if result == true {
-		// advance to the txn in match_success
-		advanceTxn, err = c.Args.GetArg("advance_true", reflect.TypeOf(""), true)
-		if err != nil {
-			r.Err = errors.New("advance_true not set")
-			return
-		}
-	} else {
-		// advance to the txn in match_failure
-		advanceTxn, err = c.Args.GetArg("advance_false", reflect.TypeOf(""), true)
-		if err != nil {
-			r.Err = errors.New("advance_false not set")
-			return
-		}
+		return false, err
 	}
-	logger.Tracef("Executing advance")
-	r.Advance = true
-	r.NewTxn = advanceTxn.(string)
 
-	r.Success = result
-	return
+	logger.Tracef("Conditional:  leftop: %v (%s) rightop: %v (%s) operation: %s result: %v", cond.LeftOp, reflect.TypeOf(cond.LeftOp).String(), cond.RightOp, reflect.TypeOf(cond.RightOp).String(), t.Conditional, result)
+	return result, nil
 }
 
 func (c *Conditional) SetArgs(i map[string]interface{}) {
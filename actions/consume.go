@@ -0,0 +1,307 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/homedepot/trainer/broker"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/state"
+	"github.com/juju/loggo"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultConsumeTimeout is how long a consume waits for a message, unless
+// told otherwise.
+const DefaultConsumeTimeout = 30 * time.Second
+
+type Consume struct {
+	Action
+	Args ArgStruct
+}
+
+func (c *Consume) GetName() string {
+	return "consume"
+}
+func (c *Consume) Abort() {
+	return
+}
+
+func (c *Consume) Execute(p *plan.Plan) (r ExecuteResult) {
+	logger := loggo.GetLogger("default")
+	logger.Tracef("Executing consume action")
+
+	if p.State.AbortRunningAction {
+		FinishWait(p)
+		r.Complete = true
+		r.Err = errors.New("aborted")
+		return
+	}
+
+	args, err := ParseTemplate(p, c.Args.Args)
+	if err != nil {
+		FinishWait(p)
+		r.Complete = true
+		r.Err = err
+		return
+	}
+	b, err := broker.Get(fmt.Sprint(args["broker"]))
+	if err != nil {
+		FinishWait(p)
+		r.Complete = true
+		r.Err = err
+		return
+	}
+	topic, ok := args["topic"].(string)
+	if !ok || topic == "" {
+		FinishWait(p)
+		r.Complete = true
+		r.Err = errors.New("topic not set")
+		return
+	}
+	// messages that arrived before the first consume of a topic that wasn't
+	// listed in the broker's config are missed.
+	if err := b.Subscribe(topic); err != nil {
+		FinishWait(p)
+		r.Complete = true
+		r.Err = err
+		return
+	}
+
+	starttime := StartWait(p)
+	if p.State.WaitActionDuration == 0 {
+		p.State.WaitActionDuration = DefaultConsumeTimeout
+		if t, ok := args["timeout"]; ok {
+			p.State.WaitActionDuration, err = ParseDuration(t)
+			if err != nil {
+				FinishWait(p)
+				r.Complete = true
+				r.Err = fmt.Errorf("timeout: %w", err)
+				return
+			}
+		}
+	}
+	timeout := p.State.WaitActionDuration
+
+	match, err := c.Matcher(p, args)
+	if err != nil {
+		FinishWait(p)
+		r.Complete = true
+		r.Err = err
+		return
+	}
+	m, err := b.Take(topic, match)
+	if err != nil {
+		FinishWait(p)
+		r.Complete = true
+		r.Err = err
+		return
+	}
+
+	if m != nil {
+		FinishWait(p)
+		r.Complete = true
+		err = c.Save(p, args, m)
+		if err != nil {
+			r.Err = err
+			return
+		}
+		r.Success = true
+		if adv, ok := args["advance_success"].(string); ok && adv != "" {
+			logger.Debugf("consumed message from %s, advancing to %s", topic, adv)
+			r.Advance = true
+			r.NewTxn = adv
+		}
+		return
+	}
+
+	elapsed := time.Since(starttime)
+	if elapsed >= timeout {
+		FinishWait(p)
+		r.Complete = true
+		adv, ok := args["advance_timeout"].(string)
+		if !ok || adv == "" {
+			r.Err = fmt.Errorf("no matching message on %s after %s", topic, timeout)
+			return
+		}
+		logger.Debugf("consume timed out after %v, advancing to %s", elapsed, adv)
+		r.Advance = true
+		r.NewTxn = adv
+		return
+	}
+	p.State.WaitRemaining = (timeout - elapsed).Round(time.Millisecond).String()
+	return
+}
+
+// Matcher builds the predicate for the match arg.  Every condition that's
+// given has to hold; with none, any message on the topic will do.
+func (c *Consume) Matcher(p *plan.Plan, args map[string]interface{}) (func(broker.Message) (bool, error), error) {
+	cond := make(map[string]interface{})
+	switch m := StringKeys(args["match"]).(type) {
+	case nil:
+	case map[string]interface{}:
+		cond = m
+	default:
+		return nil, errors.New("match is not a map")
+	}
+	// the match arg is a map, so ParseTemplate left it alone.
+	for k, v := range cond {
+		if s, ok := v.(string); ok {
+			res, err := ParseStringTemplate(p, s)
+			if err != nil {
+				return nil, fmt.Errorf("match %s: %w", k, err)
+			}
+			cond[k] = res
+		}
+	}
+
+	var re *regexp.Regexp
+	if s, ok := cond["regex"].(string); ok {
+		var err error
+		re, err = regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("match regex: %w", err)
+		}
+	}
+	var expected interface{}
+	if mf, ok := cond["match_file"].(string); ok && mf != "" {
+		s, err := ReadTemplateFile(p, mf)
+		if err != nil {
+			return nil, err
+		}
+		mft, _ := cond["match_file_type"].(string)
+		if mft == "" {
+			mft = c.BodyType(args)
+		}
+		expected, err = (&Match{}).LoadString(s, mft)
+		if err != nil {
+			return nil, fmt.Errorf("match_file: %w", err)
+		}
+	}
+	headers, _ := cond["headers"].(map[string]interface{})
+
+	return func(m broker.Message) (bool, error) {
+		if k, ok := cond["key"]; ok && fmt.Sprint(k) != m.Key {
+			return false, nil
+		}
+		if s, ok := cond["contains"].(string); ok && !strings.Contains(string(m.Body), s) {
+			return false, nil
+		}
+		if re != nil && !re.Match(m.Body) {
+			return false, nil
+		}
+		for k, v := range headers {
+			if m.Headers[k] != fmt.Sprint(v) {
+				return false, nil
+			}
+		}
+		if cond["path"] == nil && expected == nil {
+			return true, nil
+		}
+
+		// a body that can't be parsed just isn't the message we want.
+		body, err := (&Match{}).LoadString(string(m.Body), c.BodyType(args))
+		if err != nil {
+			return false, nil
+		}
+		if path, ok := cond["path"].(string); ok && path != "" {
+			v, err := p.State.GetVariableRecursive(StringKeys(body), state.ParseString(path), nil)
+			if err != nil {
+				return false, nil
+			}
+			ops := NewConditionalOps()
+			ops.LeftOp = v
+			ops.RightOp = cond["value"]
+			conditional, _ := cond["conditional"].(string)
+			if conditional == "" {
+				conditional = "eq"
+			}
+			res, err := ops.Compare(conditional)
+			if err != nil {
+				return false, fmt.Errorf("match path %s: %w", path, err)
+			}
+			if !res {
+				return false, nil
+			}
+		}
+		if expected != nil && !MatchingInterfaces(expected, body) {
+			return false, nil
+		}
+		return true, nil
+	}, nil
+}
+
+// BodyType is how message bodies are parsed, json unless told otherwise.
+func (c *Consume) BodyType(args map[string]interface{}) string {
+	if t, ok := args["body_type"].(string); ok && t != "" {
+		return t
+	}
+	return "json"
+}
+
+// Save puts the parts of the message into the variables that were asked for.
+func (c *Consume) Save(p *plan.Plan, args map[string]interface{}, m *broker.Message) error {
+	headers := make(map[string]interface{})
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+	saves := map[string]func() (interface{}, error){
+		"save_body": func() (interface{}, error) { return string(m.Body), nil },
+		"save_body_as_map": func() (interface{}, error) {
+			i, err := (&Match{}).LoadString(string(m.Body), c.BodyType(args))
+			return StringKeys(i), err
+		},
+		"save_key":     func() (interface{}, error) { return m.Key, nil },
+		"save_headers": func() (interface{}, error) { return headers, nil },
+		"save_message": func() (interface{}, error) {
+			return map[string]interface{}{
+				"topic":   m.Topic,
+				"key":     m.Key,
+				"body":    string(m.Body),
+				"headers": headers,
+				"time":    m.Time.Format(time.RFC3339Nano),
+			}, nil
+		},
+	}
+	for arg, f := range saves {
+		v, ok := args[arg].(string)
+		if !ok || v == "" {
+			continue
+		}
+		i, err := f()
+		if err != nil {
+			return fmt.Errorf("%s: %w", arg, err)
+		}
+		if err := p.State.SetVariable(v, i); err != nil {
+			return fmt.Errorf("%s: %w", arg, err)
+		}
+	}
+	return nil
+}
+
+func (c *Consume) SetArgs(i map[string]interface{}) {
+	c.Args.Args = i
+}
+
+func (c *Consume) Satisfy() (bool, error) {
+	return false, errors.New("cannot use satisfy_group for Consume action: there are no conditions to satisfy")
+}
+
+func (c *Consume) GetContext() (*context.Context, *context.CancelFunc) {
+	return nil, nil
+}
+
+func (c *Consume) CanBackground() bool {
+	return false
+}
+
+func (c *Consume) IsBackgrounded() bool {
+	return false
+}
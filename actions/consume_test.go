@@ -0,0 +1,166 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"context"
+	"github.com/homedepot/trainer/broker"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/state"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConsume_Execute(t *testing.T) {
+	messages := []broker.Message{
+		{Key: "1", Body: []byte(`{"order": {"id": "1", "status": "new"}}`)},
+		{Key: "2", Body: []byte(`not json`), Headers: map[string]string{"type": "text"}},
+		{Key: "3", Body: []byte(`{"order": {"id": "3", "status": "shipped"}}`), Headers: map[string]string{"type": "order"}},
+	}
+	tests := []struct {
+		name     string
+		args     map[string]interface{}
+		advance  string
+		wantErr  bool
+		wantVars map[string]interface{}
+	}{
+		{
+			name:     "any message",
+			args:     map[string]interface{}{"save_key": "key"},
+			wantVars: map[string]interface{}{"key": "1"},
+		},
+		{
+			name: "by key",
+			args: map[string]interface{}{
+				"match":     map[interface{}]interface{}{"key": "<<.Variables.want>>"},
+				"save_body": "body", "advance_success": "got_it",
+			},
+			advance:  "got_it",
+			wantVars: map[string]interface{}{"body": `{"order": {"id": "3", "status": "shipped"}}`},
+		},
+		{
+			name: "by path",
+			args: map[string]interface{}{
+				"match":            map[interface{}]interface{}{"path": "order.status", "value": "shipped"},
+				"save_body_as_map": "msg",
+			},
+			wantVars: map[string]interface{}{"msg": map[string]interface{}{
+				"order": map[string]interface{}{"id": "3", "status": "shipped"},
+			}},
+		},
+		{
+			name: "by header and contains",
+			args: map[string]interface{}{
+				"match":        map[interface{}]interface{}{"headers": map[interface{}]interface{}{"type": "text"}, "contains": "json"},
+				"save_headers": "hdrs",
+			},
+			wantVars: map[string]interface{}{"hdrs": map[string]interface{}{"type": "text"}},
+		},
+		{
+			name: "by regex",
+			args: map[string]interface{}{
+				"match":    map[interface{}]interface{}{"regex": `"id": "[3-9]"`},
+				"save_key": "key",
+			},
+			wantVars: map[string]interface{}{"key": "3"},
+		},
+		{
+			name: "timeout advances",
+			args: map[string]interface{}{
+				"match":           map[interface{}]interface{}{"key": "9"},
+				"timeout":         "50ms",
+				"advance_timeout": "too_late",
+			},
+			advance: "too_late",
+		},
+		{
+			name: "timeout without advance",
+			args: map[string]interface{}{
+				"match":   map[interface{}]interface{}{"key": "9"},
+				"timeout": "50ms",
+			},
+			wantErr: true,
+		},
+		{
+			name: "bad regex",
+			args: map[string]interface{}{
+				"match": map[interface{}]interface{}{"regex": "("},
+			},
+			wantErr: true,
+		},
+	}
+	b := testBroker(t)
+	for n, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topic := "consume_" + string(rune('a'+n))
+			b.Subscribe(topic)
+			for _, m := range messages {
+				m.Topic = topic
+				b.Publish(context.Background(), m)
+			}
+			p := &plan.Plan{State: state.NewState("a")}
+			p.State.Variables["want"] = "3"
+			args := map[string]interface{}{"broker": "actions_test", "topic": topic}
+			for k, v := range tt.args {
+				args[k] = v
+			}
+
+			var r ExecuteResult
+			deadline := time.Now().Add(2 * time.Second)
+			for !r.Complete && time.Now().Before(deadline) {
+				c := &Consume{}
+				c.SetArgs(args)
+				r = c.Execute(p)
+				time.Sleep(10 * time.Millisecond)
+			}
+			if (r.Err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", r.Err, tt.wantErr)
+			}
+			if r.NewTxn != tt.advance || r.Advance != (tt.advance != "") {
+				t.Errorf("Execute() advance = %v %s, want %s", r.Advance, r.NewTxn, tt.advance)
+			}
+			for k, v := range tt.wantVars {
+				if !reflect.DeepEqual(p.State.Variables[k], v) {
+					t.Errorf("variable %s = %#v, want %#v", k, p.State.Variables[k], v)
+				}
+			}
+			if !p.State.WaitActionStartTime.IsZero() {
+				t.Errorf("wait left behind")
+			}
+		})
+	}
+}
+
+func TestConsume_Taken(t *testing.T) {
+	b := testBroker(t)
+	b.Subscribe("consume_taken")
+	b.Publish(context.Background(), broker.Message{Topic: "consume_taken", Key: "1"})
+
+	p := &plan.Plan{State: state.NewState("a")}
+	args := map[string]interface{}{"broker": "actions_test", "topic": "consume_taken", "timeout": 10}
+	c := &Consume{}
+	c.SetArgs(args)
+	if r := c.Execute(p); !r.Complete || r.Err != nil {
+		t.Fatalf("Execute() = %+v, want the message", r)
+	}
+
+	// the message has been consumed, so the next consume waits for another.
+	c = &Consume{}
+	c.SetArgs(args)
+	if r := c.Execute(p); r.Complete {
+		t.Fatalf("Execute() = %+v, want still waiting", r)
+	}
+	if p.State.WaitRemaining == "" {
+		t.Errorf("WaitRemaining not set")
+	}
+	b.Publish(context.Background(), broker.Message{Topic: "consume_taken", Key: "2"})
+	c = &Consume{}
+	c.SetArgs(args)
+	if r := c.Execute(p); !r.Complete || r.Err != nil {
+		t.Errorf("Execute() = %+v, want the second message", r)
+	}
+}
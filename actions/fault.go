@@ -0,0 +1,34 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"github.com/homedepot/trainer/structs/expected"
+	"github.com/mitchellh/mapstructure"
+)
+
+// LoadFault reads a fault arg, and checks it.
+func LoadFault(i interface{}) (*expected.Fault, error) {
+	if i == nil {
+		return nil, nil
+	}
+	f := &expected.Fault{}
+	d, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           f,
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := d.Decode(StringKeys(i)); err != nil {
+		return nil, err
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,251 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/planaction"
+	"github.com/homedepot/trainer/structs/state"
+	"github.com/juju/loggo"
+	"github.com/mohae/deepcopy"
+	"reflect"
+)
+
+// DefaultMaxIterations is how many items a foreach will go through before
+// it decides something has gone wrong, unless told otherwise.
+const DefaultMaxIterations = 1000
+
+type Foreach struct {
+	Action
+	Args ArgStruct
+}
+
+func (f *Foreach) GetName() string {
+	return "foreach"
+}
+func (f *Foreach) Abort() {
+	return
+}
+
+func (f *Foreach) Execute(p *plan.Plan) (r ExecuteResult) {
+	logger := loggo.GetLogger("default")
+	logger.Tracef("Executing foreach action")
+
+	args := f.Args
+
+	list, err := args.GetArg("list", reflect.TypeOf(""), true)
+	if err != nil {
+		r.Complete = true
+		r.Err = fmt.Errorf("couldnt get list: %w", err)
+		return
+	}
+	item, err := args.GetArg("item", reflect.TypeOf(""), true)
+	if err != nil {
+		r.Complete = true
+		r.Err = fmt.Errorf("couldnt get item: %w", err)
+		return
+	}
+	index, err := args.GetArg("index", reflect.TypeOf(""), false)
+	if err != nil {
+		r.Complete = true
+		r.Err = fmt.Errorf("couldnt get index: %w", err)
+		return
+	}
+	advance, err := args.GetArg("advance", reflect.TypeOf(""), false)
+	if err != nil {
+		r.Complete = true
+		r.Err = fmt.Errorf("couldnt get advance: %w", err)
+		return
+	}
+	max := DefaultMaxIterations
+	if m, ok := args.Args["max_iterations"]; ok {
+		max, ok = m.(int)
+		if !ok {
+			r.Complete = true
+			r.Err = errors.New("max_iterations is not an int")
+			return
+		}
+	}
+	name := LoopName(args.Args)
+
+	body, err := f.Body(p)
+	if err != nil {
+		r.Complete = true
+		r.Err = err
+		return
+	}
+
+	if p.State.Loops == nil {
+		p.State.Loops = make(map[string]*state.LoopState)
+	}
+	ls, ok := p.State.Loops[name]
+	if !ok {
+		ls = &state.LoopState{}
+		p.State.Loops[name] = ls
+	}
+
+	// whatever happens from here on, unless it's waiting on an action,
+	// the loop is over.
+	defer func() {
+		if r.Complete {
+			delete(p.State.Loops, name)
+		}
+	}()
+
+	for {
+		if p.State.AbortRunningAction {
+			r.Complete = true
+			r.Err = errors.New("aborted")
+			return
+		}
+		// read the list every time around, the body is allowed to change it.
+		li, err := p.State.GetVariable(list.(string))
+		if err != nil {
+			r.Complete = true
+			r.Err = fmt.Errorf("couldnt get variable %s: %w", list.(string), err)
+			return
+		}
+		l, ok := li.([]interface{})
+		if !ok {
+			r.Complete = true
+			r.Err = fmt.Errorf("variable %s is not a list", list.(string))
+			return
+		}
+		if ls.Index >= len(l) {
+			break
+		}
+		if ls.Index >= max {
+			r.Complete = true
+			r.Err = fmt.Errorf("foreach %s: more than %d iterations", name, max)
+			return
+		}
+
+		if ls.ActionIdx == 0 {
+			logger.Debugf("foreach %s: item %d", name, ls.Index)
+			delete(p.State.Variables, item.(string))
+			err = p.State.SetVariable(item.(string), deepcopy.Copy(l[ls.Index]))
+			if err != nil {
+				r.Complete = true
+				r.Err = err
+				return
+			}
+			if index != nil && index.(string) != "" {
+				delete(p.State.Variables, index.(string))
+				err = p.State.SetVariable(index.(string), ls.Index)
+				if err != nil {
+					r.Complete = true
+					r.Err = err
+					return
+				}
+			}
+		}
+
+		for ls.ActionIdx < len(body) {
+			pa := body[ls.ActionIdx]
+			_, res := Execute(pa.Type, pa.Args, p)
+			if res.Err != nil {
+				r.Complete = true
+				r.Err = fmt.Errorf("foreach %s: item %d: %s: %w", name, ls.Index, pa.Type, res.Err)
+				return
+			}
+			if !res.Complete {
+				logger.Tracef("foreach %s: action %s not complete, waiting", name, pa.Type)
+				return
+			}
+			if res.Advance {
+				logger.Debugf("foreach %s: advancing out of the loop to %s", name, res.NewTxn)
+				r.Complete = true
+				r.Success = true
+				r.Advance = true
+				r.NewTxn = res.NewTxn
+				r.Resume = res.Resume
+				r.ResumeIdx = res.ResumeIdx
+				return
+			}
+			ls.ActionIdx++
+		}
+		ls.ActionIdx = 0
+		ls.Index++
+	}
+
+	logger.Debugf("foreach %s finished after %d items", name, ls.Index)
+	r.Complete = true
+	r.Success = true
+	if advance != nil && advance.(string) != "" {
+		// don't try if there's no such transaction
+		_, err = p.FindTransaction(advance.(string))
+		if err != nil {
+			r.Err = err
+			return
+		}
+		r.Advance = true
+		r.NewTxn = advance.(string)
+	}
+	return
+}
+
+// LoopName returns the name a foreach's loop state is kept under: its name
+// arg, or its item variable if it doesn't have one.
+func LoopName(args map[string]interface{}) string {
+	if n, ok := args["name"].(string); ok && n != "" {
+		return n
+	}
+	item, _ := args["item"].(string)
+	return item
+}
+
+// Body returns the actions to run for each item, either from the inline
+// actions argument or from the named transaction's init_action.
+func (f *Foreach) Body(p *plan.Plan) ([]planaction.PlanAction, error) {
+	var body []planaction.PlanAction
+	if t, ok := f.Args.Args["txn"].(string); ok && t != "" {
+		txn, err := p.FindTransaction(t)
+		if err != nil {
+			return nil, fmt.Errorf("couldnt find transaction %s: %w", t, err)
+		}
+		body = txn.InitAction
+	} else if a, ok := f.Args.Args["actions"]; ok {
+		var err error
+		body, err = LoadPlanActions(a)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errors.New("txn or actions not defined")
+	}
+	for _, v := range body {
+		if v.Type == "url" {
+			return nil, errors.New("url actions cannot be run inside of a foreach")
+		}
+		if _, ok := Lookup(v.Type); !ok {
+			return nil, fmt.Errorf("unknown action type %s", v.Type)
+		}
+	}
+	return body, nil
+}
+
+func (f *Foreach) SetArgs(i map[string]interface{}) {
+	f.Args.Args = i
+}
+
+func (f *Foreach) Satisfy() (bool, error) {
+	return false, errors.New("cannot use satisfy_group for Foreach action: there are no conditions to satisfy")
+}
+
+func (f *Foreach) GetContext() (*context.Context, *context.CancelFunc) {
+	return nil, nil
+}
+
+func (f *Foreach) CanBackground() bool {
+	return false
+}
+
+func (f *Foreach) IsBackgrounded() bool {
+	return false
+}
@@ -0,0 +1,234 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/planaction"
+	"github.com/homedepot/trainer/structs/state"
+	"github.com/homedepot/trainer/structs/transaction"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func foreachPlan(vars map[string]interface{}) *plan.Plan {
+	return &plan.Plan{
+		Txn: []transaction.Transaction{
+			{
+				Name: "body",
+				InitAction: []planaction.PlanAction{
+					{
+						Type: "set",
+						Args: map[string]interface{}{
+							"variable":  "seen",
+							"operation": "append",
+							"source":    "order.id",
+						},
+					},
+				},
+			},
+			{Name: "done"},
+			{Name: "found"},
+		},
+		State: &state.State{Variables: vars},
+	}
+}
+
+func TestForeach_Execute(t *testing.T) {
+	orders := func() []interface{} {
+		return []interface{}{
+			map[string]interface{}{"id": "a"},
+			map[string]interface{}{"id": "b"},
+			map[string]interface{}{"id": "c"},
+		}
+	}
+	tests := []struct {
+		name     string
+		args     map[string]interface{}
+		vars     map[string]interface{}
+		wantR    ExecuteResult
+		variable string
+		want     interface{}
+		wantErr  bool
+	}{
+		{
+			name: "named transaction then advance",
+			args: map[string]interface{}{
+				"list":    "orders",
+				"item":    "order",
+				"txn":     "body",
+				"advance": "done",
+			},
+			vars:     map[string]interface{}{"orders": orders()},
+			wantR:    ExecuteResult{Complete: true, Success: true, Advance: true, NewTxn: "done"},
+			variable: "seen",
+			want:     []interface{}{"a", "b", "c"},
+		},
+		{
+			name: "inline actions with index",
+			args: map[string]interface{}{
+				"list":  "orders",
+				"item":  "order",
+				"index": "i",
+				"actions": []interface{}{
+					map[interface{}]interface{}{
+						"type": "set",
+						"args": map[interface{}]interface{}{
+							"variable":  "seen",
+							"operation": "append",
+							"source":    "i",
+						},
+					},
+				},
+			},
+			vars:     map[string]interface{}{"orders": orders()},
+			wantR:    ExecuteResult{Complete: true, Success: true},
+			variable: "seen",
+			want:     []interface{}{0, 1, 2},
+		},
+		{
+			name: "advance breaks out",
+			args: map[string]interface{}{
+				"list": "orders",
+				"item": "order",
+				"actions": []interface{}{
+					map[interface{}]interface{}{
+						"type": "set",
+						"args": map[interface{}]interface{}{
+							"variable":  "seen",
+							"operation": "append",
+							"source":    "order.id",
+						},
+					},
+					map[interface{}]interface{}{
+						"type": "advance",
+						"args": map[interface{}]interface{}{"txn": "found"},
+					},
+				},
+			},
+			vars:     map[string]interface{}{"orders": orders()},
+			wantR:    ExecuteResult{Complete: true, Success: true, Advance: true, NewTxn: "found"},
+			variable: "seen",
+			want:     []interface{}{"a"},
+		},
+		{
+			name: "empty list",
+			args: map[string]interface{}{
+				"list":    "orders",
+				"item":    "order",
+				"txn":     "body",
+				"advance": "done",
+			},
+			vars:  map[string]interface{}{"orders": []interface{}{}},
+			wantR: ExecuteResult{Complete: true, Success: true, Advance: true, NewTxn: "done"},
+		},
+		{
+			name: "too many iterations",
+			args: map[string]interface{}{
+				"list":           "orders",
+				"item":           "order",
+				"txn":            "body",
+				"max_iterations": 2,
+			},
+			vars:    map[string]interface{}{"orders": orders()},
+			wantErr: true,
+		},
+		{
+			name: "not a list",
+			args: map[string]interface{}{
+				"list": "orders",
+				"item": "order",
+				"txn":  "body",
+			},
+			vars:    map[string]interface{}{"orders": "a,b"},
+			wantErr: true,
+		},
+		{
+			name: "url in body",
+			args: map[string]interface{}{
+				"list": "orders",
+				"item": "order",
+				"actions": []interface{}{
+					map[interface{}]interface{}{
+						"type": "url",
+						"args": map[interface{}]interface{}{"url": "/a"},
+					},
+				},
+			},
+			vars:    map[string]interface{}{"orders": orders()},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := foreachPlan(tt.vars)
+			f := &Foreach{Args: ArgStruct{Args: tt.args}}
+			r := f.Execute(p)
+			if (r.Err != nil) != tt.wantErr {
+				t.Errorf("Execute() error = %v, wantErr %v", r.Err, tt.wantErr)
+				return
+			}
+			if len(p.State.Loops) != 0 {
+				t.Errorf("Execute() left loop state behind: %v", p.State.Loops)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(r, tt.wantR) {
+				t.Errorf("Execute() = %v, want %v", r, tt.wantR)
+			}
+			if tt.variable != "" && !reflect.DeepEqual(p.State.Variables[tt.variable], tt.want) {
+				t.Errorf("Execute() %s = %v, want %v", tt.variable, p.State.Variables[tt.variable], tt.want)
+			}
+		})
+	}
+}
+
+func TestForeach_ExecuteResumes(t *testing.T) {
+	p := foreachPlan(map[string]interface{}{"orders": []interface{}{"a", "b"}})
+	args := map[string]interface{}{
+		"list": "orders",
+		"item": "order",
+		"actions": []interface{}{
+			map[interface{}]interface{}{
+				"type": "set",
+				"args": map[interface{}]interface{}{
+					"variable":  "seen",
+					"operation": "append",
+					"source":    "order",
+				},
+			},
+			map[interface{}]interface{}{
+				"type": "wait",
+				"args": map[interface{}]interface{}{"duration": 1},
+			},
+		},
+	}
+	f := &Foreach{Args: ArgStruct{Args: args}}
+	r := f.Execute(p)
+	if r.Complete {
+		t.Fatalf("Execute() completed while waiting: %v", r)
+	}
+	if !reflect.DeepEqual(p.State.Variables["seen"], []interface{}{"a"}) {
+		t.Fatalf("Execute() seen = %v", p.State.Variables["seen"])
+	}
+
+	// pretend the wait is over, the set must not run again for the same item.
+	p.State.WaitActionStartTime = time.Now().Add(-2 * time.Second)
+	r = f.Execute(p)
+	if r.Complete {
+		t.Fatalf("Execute() completed while waiting on the second item: %v", r)
+	}
+	p.State.WaitActionStartTime = time.Now().Add(-2 * time.Second)
+	r = f.Execute(p)
+	if !r.Complete || !r.Success {
+		t.Fatalf("Execute() = %v, want complete", r)
+	}
+	if !reflect.DeepEqual(p.State.Variables["seen"], []interface{}{"a", "b"}) {
+		t.Errorf("Execute() seen = %v", p.State.Variables["seen"])
+	}
+}
@@ -6,17 +6,19 @@ package actions
 // See LICENSE for further details.
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/homedepot/trainer/security"
 	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/planaction"
+	"github.com/homedepot/trainer/templates"
 	"github.com/juju/loggo"
 	"gopkg.in/yaml.v2"
 	"os"
 	"reflect"
 	"strconv"
-	"text/template"
+	"strings"
 	"time"
 )
 
@@ -44,6 +46,86 @@ func IfaceToFloat(i interface{}) (float64, error) {
 	return retval, nil
 }
 
+// ParseDuration converts a duration arg to a time.Duration.  Numbers (and
+// strings that are just numbers) are seconds, anything else has to be a go
+// duration string like 500ms or 2m.
+func ParseDuration(i interface{}) (time.Duration, error) {
+	var d time.Duration
+	switch v := i.(type) {
+	case int:
+		d = time.Duration(v) * time.Second
+	case float64:
+		d = time.Duration(v * float64(time.Second))
+	case string:
+		s := strings.TrimSpace(v)
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			d = time.Duration(f * float64(time.Second))
+			break
+		}
+		var err error
+		d, err = time.ParseDuration(s)
+		if err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("unknown type for duration %T", i)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %s", d)
+	}
+	return d, nil
+}
+
+// LoadPlanActions converts a list of actions declared inside of another
+// action's args into PlanActions.  Only the top level of each action is
+// converted; the args are left the way the yaml parser made them, since
+// that's what the actions expect.
+func LoadPlanActions(i interface{}) ([]planaction.PlanAction, error) {
+	l, ok := i.([]interface{})
+	if !ok {
+		return nil, errors.New("actions is not a list")
+	}
+	out := make([]planaction.PlanAction, 0)
+	for n, v := range l {
+		m := make(map[string]interface{})
+		switch a := v.(type) {
+		case map[interface{}]interface{}:
+			for k, e := range a {
+				m[fmt.Sprint(k)] = e
+			}
+		case map[string]interface{}:
+			m = a
+		default:
+			return nil, fmt.Errorf("action %d is not a map", n)
+		}
+		pa := planaction.PlanAction{}
+		pa.Type, ok = m["type"].(string)
+		if !ok || pa.Type == "" {
+			return nil, fmt.Errorf("action %d has no type", n)
+		}
+		if _, ok := Lookup(pa.Type); !ok {
+			return nil, fmt.Errorf("action %d: unknown action type %s", n, pa.Type)
+		}
+		pa.SatisfyGroup, _ = m["satisfy_group"].(string)
+		pa.Args = make(map[string]interface{})
+		switch a := m["args"].(type) {
+		case map[interface{}]interface{}:
+			for k, e := range a {
+				pa.Args[fmt.Sprint(k)] = e
+			}
+		case map[string]interface{}:
+			for k, e := range a {
+				pa.Args[k] = e
+			}
+		case nil:
+		default:
+			return nil, fmt.Errorf("action %d: args is not a map", n)
+		}
+		out = append(out, pa)
+	}
+	return out, nil
+}
+
 // LoadJSON unmarshals JSON into an
 // interface and returns the interface.
 func LoadJSON(in string) (interface{}, error) {
@@ -71,34 +153,13 @@ func LoadString(in string) (interface{}, error) {
 	return in, nil
 }
 
+// ParseTemplate runs the string args through the template engine.  Other
+// types are passed through as they are.
 func ParseTemplate(p *plan.Plan, args map[string]interface{}) (map[string]interface{}, error) {
-
 	logger := loggo.GetLogger("default")
 
-	t := time.Now()
-	mt, err := t.MarshalText()
-	if err != nil {
-		logger.Criticalf("Couldn't marshal time: %s", err.Error())
-		panic("AIEEEEEEEEE")
-	}
-
-	// Anonymous arg template struct.
-	at := struct {
-		Variables map[string]interface{}
-		Bases     map[string]string
-		Now       string
-	}{
-		Bases: p.Bases,
-		Now:   string(mt),
-	}
-
-	at.Variables = p.State.Variables
+	data := p.TemplateData()
 	out := make(map[string]interface{}, 0)
-
-	// Only template the string variables.  It doesn't make much sense
-	// for any other type.
-	tt := template.New("local")
-	tt.Delims("<<", ">>")
 	for j, w := range args {
 		str, ok := w.(string)
 		if !ok {
@@ -106,23 +167,45 @@ func ParseTemplate(p *plan.Plan, args map[string]interface{}) (map[string]interf
 			out[j] = args[j]
 			continue
 		}
-		tpl, err := tt.Parse(str)
+		res, err := templates.Render(j, str, data)
 		if err != nil {
-			logger.Warningf("Error parsing template: %s", err.Error())
-			return nil, err
+			return nil, fmt.Errorf("arg %s: %w", j, err)
 		}
-		var b bytes.Buffer
-		err = tpl.Execute(&b, at)
-		if err != nil {
-			logger.Warningf("Error executing template: %s.  It's still alive.", err.Error())
-			return nil, err
-		}
-		out[j] = b.String()
+		out[j] = res
 	}
 	logger.Tracef("returning: %v", out)
 	return out, nil
 }
 
+// TemplateValue runs every string in a value through render, including the
+// ones in maps and lists.  Maps come back with string keys.
+func TemplateValue(render func(string) (string, error), i interface{}) (interface{}, error) {
+	switch v := StringKeys(i).(type) {
+	case string:
+		return render(v)
+	case map[string]interface{}:
+		for k, e := range v {
+			res, err := TemplateValue(render, e)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			v[k] = res
+		}
+		return v, nil
+	case []interface{}:
+		for n, e := range v {
+			res, err := TemplateValue(render, e)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %w", n, err)
+			}
+			v[n] = res
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
 // EqualStrings returns a boolean value
 // for string comparison, as well as error.
 func EqualStrings(input string, expected string) (bool, interface{}, error) {
@@ -211,7 +294,11 @@ func ExecuteComparison(p *plan.Plan, data string, path string, strbody string, f
 	}
 
 	// Execute comparison.
-	tequ := ParseStringTemplate(p, string(expected))
+	tequ, err := ParseStringTemplate(p, string(expected))
+	if err != nil {
+		logger.Warningf("Couldn't template transaction data: %s: %s", data, err.Error())
+		return nil, err
+	}
 	logger.Tracef("tequ: %s, strbody: %s", tequ, strbody)
 	equal, i, err := f(strbody, tequ)
 	if err != nil {
@@ -226,49 +313,20 @@ func ExecuteComparison(p *plan.Plan, data string, path string, strbody string, f
 	return i, nil
 }
 
-func ParseStringTemplate(p *plan.Plan, in string) string {
-
-	logger := loggo.GetLogger("default")
-
-	t := time.Now()
-	mt, err := t.MarshalText()
-	if err != nil {
-		logger.Criticalf("Couldn't marshal time: %s", err.Error())
-		panic("AIEEEEEEEEE")
-	}
-
-	// Anonymous arg template struct.
-	at := struct {
-		Variables map[string]string
-		Bases     map[string]string
-		Now       string
-	}{
-		Bases: p.Bases,
-		Now:   string(mt),
-	}
-
-	at.Variables = make(map[string]string, 0)
+// ParseStringTemplate runs a string (usually a file) through the template
+// engine.
+func ParseStringTemplate(p *plan.Plan, in string) (string, error) {
+	return p.ParseTemplate(in)
+}
 
-	// Only template the string variables.  It doesn't make much sense
-	// for any other type.
-	for i, v := range p.State.Variables {
-		if reflect.TypeOf(v).String() == "string" {
-			at.Variables[i] = v.(string)
-		}
-	}
-	tt := template.New("local")
-	tt.Delims("<<", ">>")
-	tpl, err := tt.Parse(in)
-	if err != nil {
-		logger.Warningf("Error parsing template: %s", err.Error())
-		return in
+// ReadTemplateFile reads a file and runs it through the template engine.
+func ReadTemplateFile(p *plan.Plan, n string) (string, error) {
+	if err := security.ValidatePath(n, ""); err != nil {
+		return "", err
 	}
-	var b bytes.Buffer
-	err = tpl.Execute(&b, at)
+	b, err := os.ReadFile(n)
 	if err != nil {
-		logger.Warningf("Error executing template: %s.  It's still alive.", err.Error())
-		return in
+		return "", err
 	}
-	logger.Tracef("returning: %s", b.String())
-	return b.String()
+	return ParseStringTemplate(p, string(b))
 }
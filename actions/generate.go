@@ -0,0 +1,267 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/juju/loggo"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Charsets are the named sets of characters that random strings can be
+// made of.
+var Charsets = map[string]string{
+	"alpha":        "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"alphanumeric": "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789",
+	"lower":        "abcdefghijklmnopqrstuvwxyz",
+	"upper":        "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"numeric":      "0123456789",
+	"hex":          "0123456789abcdef",
+}
+
+type Generate struct {
+	Action
+	Args ArgStruct
+}
+
+func (g *Generate) GetName() string {
+	return "generate"
+}
+func (g *Generate) Abort() {
+	return
+}
+
+func (g *Generate) Execute(p *plan.Plan) (r ExecuteResult) {
+	logger := loggo.GetLogger("default")
+	logger.Tracef("Executing generate action")
+
+	r.Complete = true
+
+	args, err := ParseTemplate(p, g.Args.Args)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	a := ArgStruct{Args: args}
+
+	variable, err := a.GetArg("variable", reflect.TypeOf(""), true)
+	if err != nil {
+		r.Err = fmt.Errorf("couldnt get variable: %w", err)
+		return
+	}
+	kind, err := a.GetArg("kind", reflect.TypeOf(""), true)
+	if err != nil {
+		r.Err = fmt.Errorf("couldnt get kind: %w", err)
+		return
+	}
+	if seed, ok := args["seed"]; ok {
+		n, err := strconv.ParseInt(fmt.Sprint(seed), 10, 64)
+		if err != nil {
+			r.Err = fmt.Errorf("seed is not an int: %w", err)
+			return
+		}
+		p.State.Reseed(n)
+	}
+
+	if lv, ok := args["list_var"].(string); ok && lv != "" {
+		args["list"], err = p.State.GetVariable(lv)
+		if err != nil {
+			r.Err = fmt.Errorf("couldnt get list_var %s: %w", lv, err)
+			return
+		}
+	}
+
+	rnd := p.State.Random()
+	v, err := GenerateValue(rnd, kind.(string), a, p.State.SeedNow())
+	if err != nil {
+		r.Err = err
+		return
+	}
+	logger.Debugf("generated %s %v into %s (seed %d)", kind.(string), v, variable.(string), p.State.Seed)
+
+	delete(p.State.Variables, variable.(string))
+	err = p.State.SetVariable(variable.(string), v)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	r.Success = true
+	return
+}
+
+// GenerateValue makes one value of the given kind, using the args for that
+// kind.  All of the randomness comes from rnd, so the same seed gets the
+// same values.  Dates are relative to now, which is passed in so that they
+// come out the same on another day too.
+func GenerateValue(rnd *rand.Rand, kind string, a ArgStruct, now time.Time) (interface{}, error) {
+	switch kind {
+	case "uuid":
+		var b [16]byte
+		rnd.Read(b[:])
+		u := uuid.UUID(b)
+		u.SetVersion(uuid.V4)
+		u.SetVariant(uuid.VariantRFC4122)
+		return u.String(), nil
+	case "int":
+		min, err := intArg(a, "min", 0)
+		if err != nil {
+			return nil, err
+		}
+		max, err := intArg(a, "max", 100)
+		if err != nil {
+			return nil, err
+		}
+		if max < min {
+			return nil, errors.New("max is less than min")
+		}
+		return min + rnd.Intn(max-min+1), nil
+	case "string":
+		length, err := intArg(a, "length", 16)
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, errors.New("length is negative")
+		}
+		charset, _ := a.Args["charset"].(string)
+		if charset == "" {
+			charset = "alphanumeric"
+		}
+		if named, ok := Charsets[charset]; ok {
+			charset = named
+		}
+		return randomString(rnd, charset, length), nil
+	case "email":
+		domain, _ := a.Args["domain"].(string)
+		if domain == "" {
+			domain = "example.com"
+		}
+		prefix, _ := a.Args["prefix"].(string)
+		if prefix == "" {
+			prefix = "user"
+		}
+		return fmt.Sprintf("%s.%s@%s", prefix, randomString(rnd, Charsets["lower"]+Charsets["numeric"], 10), domain), nil
+	case "phone":
+		format, _ := a.Args["format"].(string)
+		if format == "" {
+			format = "###-###-####"
+		}
+		var b strings.Builder
+		for _, c := range format {
+			if c == '#' {
+				b.WriteByte(Charsets["numeric"][rnd.Intn(10)])
+			} else {
+				b.WriteRune(c)
+			}
+		}
+		return b.String(), nil
+	case "date":
+		format, _ := a.Args["format"].(string)
+		if format == "" {
+			format = "2006-01-02"
+		}
+		from, err := dateArg(a, "from", format, now.AddDate(-1, 0, 0), now)
+		if err != nil {
+			return nil, err
+		}
+		to, err := dateArg(a, "to", format, now, now)
+		if err != nil {
+			return nil, err
+		}
+		if to.Before(from) {
+			return nil, errors.New("to is before from")
+		}
+		span := to.Sub(from)
+		if span == 0 {
+			return from.Format(format), nil
+		}
+		return from.Add(time.Duration(rnd.Int63n(int64(span)))).Format(format), nil
+	case "pick":
+		l, ok := a.Args["list"].([]interface{})
+		if !ok {
+			return nil, errors.New("list is not a list")
+		}
+		if len(l) == 0 {
+			return nil, errors.New("nothing to pick from")
+		}
+		return l[rnd.Intn(len(l))], nil
+	default:
+		return nil, fmt.Errorf("unknown kind %s", kind)
+	}
+}
+
+func randomString(rnd *rand.Rand, charset string, length int) string {
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = charset[rnd.Intn(len(charset))]
+	}
+	return string(b)
+}
+
+// intArg gets an int arg, which may have been templated into a string.
+func intArg(a ArgStruct, n string, def int) (int, error) {
+	v, ok := a.Args[n]
+	if !ok {
+		return def, nil
+	}
+	switch i := v.(type) {
+	case int:
+		return i, nil
+	case string:
+		out, err := strconv.Atoi(i)
+		if err != nil {
+			return 0, fmt.Errorf("%s is not an int: %w", n, err)
+		}
+		return out, nil
+	default:
+		return 0, fmt.Errorf("%s is not an int", n)
+	}
+}
+
+// dateArg gets a date arg, which is either a date in the given format or
+// a duration from now, like -720h.
+func dateArg(a ArgStruct, n string, format string, def time.Time, now time.Time) (time.Time, error) {
+	v, ok := a.Args[n].(string)
+	if !ok || v == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(format, v); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is neither a date nor a duration: %s", n, v)
+	}
+	return now.Add(d), nil
+}
+
+func (g *Generate) SetArgs(i map[string]interface{}) {
+	g.Args.Args = i
+}
+
+func (g *Generate) Satisfy() (bool, error) {
+	return false, errors.New("cannot use satisfy_group for Generate action: there are no conditions to satisfy")
+}
+
+func (g *Generate) GetContext() (*context.Context, *context.CancelFunc) {
+	return nil, nil
+}
+
+func (g *Generate) CanBackground() bool {
+	return false
+}
+
+func (g *Generate) IsBackgrounded() bool {
+	return false
+}
@@ -0,0 +1,226 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/state"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestGenerate_Execute(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    map[string]interface{}
+		vars    map[string]interface{}
+		check   func(interface{}) bool
+		wantErr bool
+	}{
+		{
+			name: "uuid",
+			args: map[string]interface{}{"kind": "uuid"},
+			check: func(i interface{}) bool {
+				u, err := uuid.FromString(i.(string))
+				return err == nil && u.Version() == uuid.V4
+			},
+		},
+		{
+			name: "int",
+			args: map[string]interface{}{"kind": "int", "min": 5, "max": "<<.Variables.max>>"},
+			vars: map[string]interface{}{"max": "7"},
+			check: func(i interface{}) bool {
+				n := i.(int)
+				return n >= 5 && n <= 7
+			},
+		},
+		{
+			name: "string",
+			args: map[string]interface{}{"kind": "string", "length": 8, "charset": "hex"},
+			check: func(i interface{}) bool {
+				return regexp.MustCompile(`^[0-9a-f]{8}$`).MatchString(i.(string))
+			},
+		},
+		{
+			name: "literal charset",
+			args: map[string]interface{}{"kind": "string", "length": 4, "charset": "xy"},
+			check: func(i interface{}) bool {
+				return regexp.MustCompile(`^[xy]{4}$`).MatchString(i.(string))
+			},
+		},
+		{
+			name: "email",
+			args: map[string]interface{}{"kind": "email", "domain": "test.example.com"},
+			check: func(i interface{}) bool {
+				return regexp.MustCompile(`^user\.[a-z0-9]{10}@test\.example\.com$`).MatchString(i.(string))
+			},
+		},
+		{
+			name: "phone",
+			args: map[string]interface{}{"kind": "phone", "format": "+1 (###) ###-####"},
+			check: func(i interface{}) bool {
+				return regexp.MustCompile(`^\+1 \(\d{3}\) \d{3}-\d{4}$`).MatchString(i.(string))
+			},
+		},
+		{
+			name: "date",
+			args: map[string]interface{}{"kind": "date", "from": "2020-01-01", "to": "2020-01-31"},
+			check: func(i interface{}) bool {
+				d, err := time.Parse("2006-01-02", i.(string))
+				return err == nil && d.Year() == 2020 && d.Month() == time.January
+			},
+		},
+		{
+			name: "date relative",
+			args: map[string]interface{}{"kind": "date", "from": "24h", "to": "48h", "format": time.RFC3339},
+			check: func(i interface{}) bool {
+				d, err := time.Parse(time.RFC3339, i.(string))
+				return err == nil && d.After(time.Now()) && d.Before(time.Now().Add(49*time.Hour))
+			},
+		},
+		{
+			name: "pick",
+			args: map[string]interface{}{"kind": "pick", "list": []interface{}{"red", "green"}},
+			check: func(i interface{}) bool {
+				return i == "red" || i == "green"
+			},
+		},
+		{
+			name: "pick from variable",
+			args: map[string]interface{}{"kind": "pick", "list_var": "skus"},
+			vars: map[string]interface{}{"skus": []interface{}{1001}},
+			check: func(i interface{}) bool {
+				return i == 1001
+			},
+		},
+		{
+			name:    "unknown kind",
+			args:    map[string]interface{}{"kind": "ssn"},
+			wantErr: true,
+		},
+		{
+			name:    "max less than min",
+			args:    map[string]interface{}{"kind": "int", "min": 5, "max": 1},
+			wantErr: true,
+		},
+		{
+			name:    "negative length",
+			args:    map[string]interface{}{"kind": "string", "length": -1},
+			wantErr: true,
+		},
+		{
+			name:    "empty pick",
+			args:    map[string]interface{}{"kind": "pick", "list": []interface{}{}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := tt.vars
+			if vars == nil {
+				vars = map[string]interface{}{}
+			}
+			p := &plan.Plan{State: &state.State{Variables: vars}}
+			args := map[string]interface{}{"variable": "out"}
+			for k, v := range tt.args {
+				args[k] = v
+			}
+			g := &Generate{Args: ArgStruct{Args: args}}
+			r := g.Execute(p)
+			if (r.Err != nil) != tt.wantErr {
+				t.Errorf("Execute() error = %v, wantErr %v", r.Err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !r.Complete || !r.Success {
+				t.Errorf("Execute() = %v", r)
+			}
+			if !tt.check(p.State.Variables["out"]) {
+				t.Errorf("Execute() generated %v", p.State.Variables["out"])
+			}
+			if p.State.Seed == 0 {
+				t.Errorf("Execute() didn't record the seed")
+			}
+		})
+	}
+}
+
+func TestGenerate_ExecuteSeeded(t *testing.T) {
+	kinds := []map[string]interface{}{
+		{"variable": "id", "kind": "uuid"},
+		{"variable": "qty", "kind": "int", "min": 1, "max": 1000},
+		{"variable": "name", "kind": "string"},
+		{"variable": "email", "kind": "email"},
+	}
+	run := func(seed int64) map[string]interface{} {
+		p := &plan.Plan{State: &state.State{Variables: map[string]interface{}{}, Seed: seed}}
+		for _, k := range kinds {
+			r := (&Generate{Args: ArgStruct{Args: k}}).Execute(p)
+			if r.Err != nil {
+				t.Fatalf("Execute() error = %v", r.Err)
+			}
+		}
+		return p.State.Variables
+	}
+
+	first := run(42)
+	second := run(42)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("same seed generated %v and %v", first, second)
+	}
+	other := run(43)
+	if reflect.DeepEqual(first, other) {
+		t.Errorf("different seeds generated the same values %v", first)
+	}
+
+	// a seed on the action starts over, whatever the run had.
+	p := &plan.Plan{State: &state.State{Variables: map[string]interface{}{}}}
+	r := (&Generate{Args: ArgStruct{Args: map[string]interface{}{"variable": "id", "kind": "uuid", "seed": 42}}}).Execute(p)
+	if r.Err != nil {
+		t.Fatalf("Execute() error = %v", r.Err)
+	}
+	if p.State.Seed != 42 || p.State.Variables["id"] != first["id"] {
+		t.Errorf("Execute() with seed = %v (seed %d), want %v", p.State.Variables["id"], p.State.Seed, first["id"])
+	}
+
+	// dates relative to now come out the same with the same seed and seed time.
+	seedTime := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	dates := []struct {
+		args map[string]interface{}
+		want string
+	}{
+		{args: map[string]interface{}{"from": "2020-01-01", "to": "2020-12-31"}},
+		{args: map[string]interface{}{"from": "-48h", "to": "-24h"}},
+		{args: map[string]interface{}{}},
+		{args: map[string]interface{}{"from": "0s", "to": "0s"}, want: "2020-06-01"},
+	}
+	for _, d := range dates {
+		args := map[string]interface{}{"variable": "d", "kind": "date"}
+		for k, v := range d.args {
+			args[k] = v
+		}
+		var got []interface{}
+		for i := 0; i < 2; i++ {
+			p := &plan.Plan{State: &state.State{Variables: map[string]interface{}{}, Seed: 42, SeedTime: seedTime}}
+			r := (&Generate{Args: ArgStruct{Args: args}}).Execute(p)
+			if r.Err != nil {
+				t.Fatalf("Execute(%v) error = %v", d.args, r.Err)
+			}
+			got = append(got, p.State.Variables["d"])
+		}
+		if got[0] != got[1] {
+			t.Errorf("Execute(%v) = %v and %v, want the same date", d.args, got[0], got[1])
+		}
+		if d.want != "" && got[0] != d.want {
+			t.Errorf("Execute(%v) = %v, want %v", d.args, got[0], d.want)
+		}
+	}
+}
@@ -41,7 +41,12 @@ func (m *Match) Execute(p *plan.Plan) (r ExecuteResult) {
 
 	matchfiletype, err := m.Args.GetArg("match_file_type", reflect.TypeOf(""), true)
 
-	comp, err := m.LoadFile(matchfile.(string), matchfiletype.(string))
+	body, err := ReadTemplateFile(p, matchfile.(string))
+	if err != nil {
+		r.Err = err
+		return
+	}
+	comp, err := m.LoadString(body, matchfiletype.(string))
 	if err != nil {
 		r.Err = err
 		return
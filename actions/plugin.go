@@ -0,0 +1,310 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/plugin"
+	"github.com/homedepot/trainer/structs/state"
+	"github.com/juju/loggo"
+	"os"
+	"os/exec"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// PluginRequest is what a plugin gets on stdin.
+type PluginRequest struct {
+	Action      string                 `json:"action"`
+	Transaction string                 `json:"transaction"`
+	Args        map[string]interface{} `json:"args"`
+	Variables   map[string]interface{} `json:"variables"`
+}
+
+// PluginReply is what a plugin writes to stdout.  It's shaped like an
+// ExecuteResult.  Complete defaults to true; a plugin that says it isn't
+// complete is run again on the next pass, like a wait.
+type PluginReply struct {
+	Complete  *bool                  `json:"complete"`
+	Success   bool                   `json:"success"`
+	Advance   bool                   `json:"advance"`
+	NewTxn    string                 `json:"new_txn"`
+	Variables map[string]interface{} `json:"variables"` // set in the plan's variables
+	Error     string                 `json:"error"`
+}
+
+// pluginRun is a plugin process that's in progress.
+type pluginRun struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	reply  *PluginReply
+	err    error
+}
+
+// running plugin processes, by the id kept in the plan's state.  The
+// actions themselves are made fresh each time, so they can't hold onto
+// them.
+var plugins = struct {
+	sync.Mutex
+	m map[string]*pluginRun
+}{m: make(map[string]*pluginRun)}
+
+type Plugin struct {
+	Action
+	Args    ArgStruct
+	Spec    plugin.Plugin
+	started string // the id of the run started by this instance, if any
+}
+
+// RegisterPlugin adds an action type that runs an external program.
+func RegisterPlugin(pl plugin.Plugin) error {
+	if pl.Command == "" {
+		return fmt.Errorf("plugin %s has no command", pl.Name)
+	}
+	if pl.Timeout != "" {
+		if _, err := ParseDuration(pl.Timeout); err != nil {
+			return fmt.Errorf("plugin %s: timeout: %w", pl.Name, err)
+		}
+	}
+	// loading the same config again registers the same plugins again.
+	if r, ok := Lookup(pl.Name); ok {
+		if pg, ok := r.Factory().(*Plugin); ok && reflect.DeepEqual(pg.Spec, pl) {
+			return nil
+		}
+	}
+	args := make([]ArgSpec, 0)
+	for _, n := range pl.RequiredArgs {
+		args = append(args, ArgSpec{Name: n, Required: true})
+	}
+	return Register(Registration{
+		Name:    pl.Name,
+		Factory: func() Action { return &Plugin{Spec: pl} },
+		Args:    args,
+	})
+}
+
+func (pg *Plugin) GetName() string {
+	return pg.Spec.Name
+}
+
+func (pg *Plugin) Abort() {
+	if pg.started == "" {
+		return
+	}
+	plugins.Lock()
+	run, ok := plugins.m[pg.started]
+	delete(plugins.m, pg.started)
+	plugins.Unlock()
+	if ok {
+		run.cancel()
+	}
+}
+
+func (pg *Plugin) Execute(p *plan.Plan) (r ExecuteResult) {
+	logger := loggo.GetLogger("default")
+	logger.Tracef("Executing plugin action %s", pg.Spec.Name)
+
+	ps := p.State.Plugin
+	if ps != nil && (ps.Txn != p.State.Transaction || ps.Name != pg.Spec.Name) {
+		// left behind by something that didn't finish.
+		pg.Finish(p)
+		ps = nil
+	}
+
+	if p.State.AbortRunningAction {
+		pg.Finish(p)
+		r.Complete = true
+		r.Err = errors.New("aborted")
+		return
+	}
+
+	if ps == nil {
+		id, err := pg.Start(p)
+		if err != nil {
+			r.Complete = true
+			r.Err = err
+			return
+		}
+		pg.started = id
+		p.State.Plugin = &state.PluginState{ID: id, Name: pg.Spec.Name, Txn: p.State.Transaction, Started: time.Now()}
+		ps = p.State.Plugin
+	}
+
+	plugins.Lock()
+	run, ok := plugins.m[ps.ID]
+	plugins.Unlock()
+	if !ok {
+		p.State.Plugin = nil
+		r.Complete = true
+		r.Err = fmt.Errorf("plugin %s is no longer running", pg.Spec.Name)
+		return
+	}
+
+	select {
+	case <-run.done:
+	default:
+		return
+	}
+
+	pg.Finish(p)
+	if run.err != nil {
+		r.Complete = true
+		r.Err = fmt.Errorf("plugin %s: %w", pg.Spec.Name, run.err)
+		return
+	}
+	return pg.Result(p, run.reply)
+}
+
+// Start launches the plugin and hands it the request.  It returns the id of
+// the run.
+func (pg *Plugin) Start(p *plan.Plan) (string, error) {
+	logger := loggo.GetLogger("default")
+
+	args, err := ParseTemplate(p, pg.Args.Args)
+	if err != nil {
+		return "", err
+	}
+	delete(args, "_context")
+	req := PluginRequest{
+		Action:      pg.Spec.Name,
+		Transaction: p.State.Transaction,
+		Args:        StringKeys(args).(map[string]interface{}),
+		Variables:   StringKeys(p.State.Variables).(map[string]interface{}),
+	}
+	in, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("plugin %s: request: %w", pg.Spec.Name, err)
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if pg.Spec.Timeout != "" {
+		timeout, err := ParseDuration(pg.Spec.Timeout)
+		if err != nil {
+			return "", fmt.Errorf("plugin %s: timeout: %w", pg.Spec.Name, err)
+		}
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	cmd := exec.CommandContext(ctx, pg.Spec.Command, pg.Spec.Args...)
+	cmd.Dir = pg.Spec.Dir
+	cmd.Env = os.Environ()
+	for k, v := range pg.Spec.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stdin = bytes.NewReader(in)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return "", fmt.Errorf("plugin %s: %w", pg.Spec.Name, err)
+	}
+
+	id := uuid.Must(uuid.NewV4()).String()
+	run := &pluginRun{cancel: cancel, done: make(chan struct{})}
+	plugins.Lock()
+	plugins.m[id] = run
+	plugins.Unlock()
+
+	go func() {
+		defer close(run.done)
+		defer cancel()
+		err := cmd.Wait()
+		if stderr.Len() > 0 {
+			logger.Debugf("plugin %s stderr: %s", pg.Spec.Name, stderr.String())
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			run.err = errors.New("timed out")
+			return
+		}
+		if ctx.Err() == context.Canceled {
+			run.err = errors.New("aborted")
+			return
+		}
+		reply := &PluginReply{}
+		if jerr := json.Unmarshal(stdout.Bytes(), reply); jerr != nil {
+			if err != nil {
+				run.err = err
+			} else {
+				run.err = fmt.Errorf("bad reply: %w", jerr)
+			}
+			return
+		}
+		run.reply = reply
+	}()
+	logger.Debugf("started plugin %s (%s)", pg.Spec.Name, id)
+	return id, nil
+}
+
+// Result turns the plugin's reply into an ExecuteResult, saving any
+// variables it sent back.
+func (pg *Plugin) Result(p *plan.Plan, reply *PluginReply) (r ExecuteResult) {
+	for k, v := range reply.Variables {
+		p.State.Variables[k] = v
+	}
+	if reply.Error != "" {
+		r.Complete = true
+		r.Err = fmt.Errorf("plugin %s: %s", pg.Spec.Name, reply.Error)
+		return
+	}
+	r.Complete = reply.Complete == nil || *reply.Complete
+	r.Success = reply.Success
+	r.Advance = reply.Advance
+	r.NewTxn = reply.NewTxn
+	if r.Advance && r.NewTxn == "" {
+		r.Complete = true
+		r.Err = fmt.Errorf("plugin %s: advance without new_txn", pg.Spec.Name)
+	}
+	return
+}
+
+// Finish forgets the run in progress.
+func (pg *Plugin) Finish(p *plan.Plan) {
+	if p.State.Plugin == nil {
+		return
+	}
+	plugins.Lock()
+	run, ok := plugins.m[p.State.Plugin.ID]
+	delete(plugins.m, p.State.Plugin.ID)
+	plugins.Unlock()
+	if ok {
+		run.cancel()
+	}
+	p.State.Plugin = nil
+}
+
+func (pg *Plugin) SetArgs(i map[string]interface{}) {
+	pg.Args.Args = i
+}
+
+func (pg *Plugin) Satisfy() (bool, error) {
+	return false, fmt.Errorf("cannot use satisfy_group for plugin %s: there are no conditions to satisfy", pg.Spec.Name)
+}
+
+func (pg *Plugin) GetContext() (*context.Context, *context.CancelFunc) {
+	return nil, nil
+}
+
+// CanBackground is only true for the pass that started the process, so
+// that it's handed to the handler (to be aborted) once.
+func (pg *Plugin) CanBackground() bool {
+	return pg.started != ""
+}
+
+func (pg *Plugin) IsBackgrounded() bool {
+	return false
+}
@@ -0,0 +1,231 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/plugin"
+	"github.com/homedepot/trainer/structs/state"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestPluginHelper isn't a real test, it's the plugin the other tests run
+// (the test binary runs itself with GO_WANT_PLUGIN_HELPER set).
+func TestPluginHelper(t *testing.T) {
+	if os.Getenv("GO_WANT_PLUGIN_HELPER") != "1" {
+		return
+	}
+	var req PluginRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		fmt.Fprintf(os.Stderr, "bad request: %s", err)
+		os.Exit(2)
+	}
+	switch req.Args["mode"] {
+	case "advance":
+		fmt.Printf(`{"success": true, "advance": true, "new_txn": "%s", "variables": {"seen": "%v"}}`, req.Args["txn"], req.Variables["input"])
+	case "incomplete":
+		fmt.Print(`{"complete": false}`)
+	case "error":
+		fmt.Print(`{"error": "no stock", "variables": {"reason": "empty"}}`)
+	case "bad":
+		fmt.Print(`not json`)
+	case "exit":
+		os.Exit(3)
+	case "sleep":
+		time.Sleep(10 * time.Second)
+		fmt.Print(`{}`)
+	}
+	os.Exit(0)
+}
+
+func helperPlugin(name, timeout string) plugin.Plugin {
+	return plugin.Plugin{
+		Name:    name,
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^TestPluginHelper$"},
+		Env:     map[string]string{"GO_WANT_PLUGIN_HELPER": "1"},
+		Timeout: timeout,
+	}
+}
+
+// runPlugin executes the action until the process is done, or gives up.
+func runPlugin(pg *Plugin, p *plan.Plan) ExecuteResult {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r := pg.Execute(p)
+		if p.State.Plugin == nil || time.Now().After(deadline) {
+			return r
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestPlugin_Execute(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     map[string]interface{}
+		timeout  string
+		wantErr  bool
+		complete bool
+		advance  string
+		vars     map[string]interface{}
+	}{
+		{
+			name:     "advance",
+			args:     map[string]interface{}{"mode": "advance", "txn": "<<.Variables.next>>"},
+			complete: true,
+			advance:  "b",
+			vars:     map[string]interface{}{"seen": "in"},
+		},
+		{
+			name: "incomplete",
+			args: map[string]interface{}{"mode": "incomplete"},
+		},
+		{
+			name:     "error reply",
+			args:     map[string]interface{}{"mode": "error"},
+			wantErr:  true,
+			complete: true,
+			vars:     map[string]interface{}{"reason": "empty"},
+		},
+		{
+			name:     "bad reply",
+			args:     map[string]interface{}{"mode": "bad"},
+			wantErr:  true,
+			complete: true,
+		},
+		{
+			name:     "exit status",
+			args:     map[string]interface{}{"mode": "exit"},
+			wantErr:  true,
+			complete: true,
+		},
+		{
+			name:     "timeout",
+			args:     map[string]interface{}{"mode": "sleep"},
+			timeout:  "200ms",
+			wantErr:  true,
+			complete: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &plan.Plan{State: state.NewState("a")}
+			p.State.Variables["input"] = "in"
+			p.State.Variables["next"] = "b"
+			pg := &Plugin{Spec: helperPlugin("helper", tt.timeout)}
+			pg.SetArgs(tt.args)
+
+			r := runPlugin(pg, p)
+			if (r.Err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", r.Err, tt.wantErr)
+			}
+			if r.Complete != tt.complete {
+				t.Errorf("Execute() complete = %v, want %v", r.Complete, tt.complete)
+			}
+			if r.NewTxn != tt.advance || r.Advance != (tt.advance != "") {
+				t.Errorf("Execute() advance = %v %s, want %s", r.Advance, r.NewTxn, tt.advance)
+			}
+			for k, v := range tt.vars {
+				if p.State.Variables[k] != v {
+					t.Errorf("variable %s = %v, want %v", k, p.State.Variables[k], v)
+				}
+			}
+			if p.State.Plugin != nil {
+				t.Errorf("plugin state left behind: %+v", p.State.Plugin)
+			}
+		})
+	}
+}
+
+func TestPlugin_Abort(t *testing.T) {
+	p := &plan.Plan{State: state.NewState("a")}
+	pg := &Plugin{Spec: helperPlugin("helper", "")}
+	pg.SetArgs(map[string]interface{}{"mode": "sleep"})
+
+	r := pg.Execute(p)
+	if r.Complete || r.Err != nil {
+		t.Fatalf("Execute() = %+v, want in progress", r)
+	}
+	if !pg.CanBackground() {
+		t.Errorf("CanBackground() = false for the instance that started the process")
+	}
+
+	// the next pass is a new instance, like the handler makes.
+	next := &Plugin{Spec: helperPlugin("helper", "")}
+	next.SetArgs(map[string]interface{}{"mode": "sleep"})
+	if r := next.Execute(p); r.Complete {
+		t.Fatalf("Execute() = %+v, want still in progress", r)
+	}
+	if next.CanBackground() {
+		t.Errorf("CanBackground() = true for an instance that didn't start the process")
+	}
+
+	start := time.Now()
+	pg.Abort()
+	r = next.Execute(p)
+	if !r.Complete || r.Err == nil {
+		t.Errorf("Execute() after abort = %+v, want an error", r)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("abort took %s", time.Since(start))
+	}
+}
+
+func TestRegisterPlugin(t *testing.T) {
+	tests := []struct {
+		name    string
+		pl      plugin.Plugin
+		wantErr bool
+	}{
+		{
+			name: "ok",
+			pl:   plugin.Plugin{Name: "plugin_test", Command: "true", RequiredArgs: []string{"sku"}},
+		},
+		{
+			name: "same again",
+			pl:   plugin.Plugin{Name: "plugin_test", Command: "true", RequiredArgs: []string{"sku"}},
+		},
+		{
+			name:    "same name, other command",
+			pl:      plugin.Plugin{Name: "plugin_test", Command: "false"},
+			wantErr: true,
+		},
+		{
+			name:    "no command",
+			pl:      plugin.Plugin{Name: "plugin_test_nocommand"},
+			wantErr: true,
+		},
+		{
+			name:    "bad timeout",
+			pl:      plugin.Plugin{Name: "plugin_test_timeout", Command: "true", Timeout: "soon"},
+			wantErr: true,
+		},
+		{
+			name:    "builtin name",
+			pl:      plugin.Plugin{Name: "wait", Command: "true"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := RegisterPlugin(tt.pl); (err != nil) != tt.wantErr {
+				t.Errorf("RegisterPlugin() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	a, err := New("plugin_test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if a.GetName() != "plugin_test" {
+		t.Errorf("GetName() = %s", a.GetName())
+	}
+}
@@ -0,0 +1,310 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/state"
+	"github.com/juju/loggo"
+	"reflect"
+	"time"
+)
+
+// DefaultPollInterval is how long a poll waits between attempts, unless
+// told otherwise.
+const DefaultPollInterval = time.Second
+
+type Poll struct {
+	Action
+	Args ArgStruct
+}
+
+func (pl *Poll) GetName() string {
+	return "poll"
+}
+func (pl *Poll) Abort() {
+	return
+}
+
+func (pl *Poll) Execute(p *plan.Plan) (r ExecuteResult) {
+	logger := loggo.GetLogger("default")
+	logger.Tracef("Executing poll action")
+
+	if p.State.AbortRunningAction {
+		pl.Finish(p)
+		r.Complete = true
+		r.Err = errors.New("aborted")
+		return
+	}
+
+	advanceSuccess, err := pl.Args.GetArg("advance_success", reflect.TypeOf(""), true)
+	if err != nil {
+		r.Complete = true
+		r.Err = errors.New("advance_success not set")
+		return
+	}
+	advanceTimeout, err := pl.Args.GetArg("advance_timeout", reflect.TypeOf(""), true)
+	if err != nil {
+		r.Complete = true
+		r.Err = errors.New("advance_timeout not set")
+		return
+	}
+
+	starttime := StartWait(p)
+	if p.State.WaitActionDuration == 0 || p.State.Poll == nil {
+		err = pl.Start(p)
+		if err != nil {
+			pl.Finish(p)
+			r.Complete = true
+			r.Err = err
+			return
+		}
+	}
+	timeout := p.State.WaitActionDuration
+	ps := p.State.Poll
+
+	if time.Now().Before(ps.Next) {
+		if time.Since(starttime) >= timeout {
+			logger.Debugf("poll timed out after %d attempts, advancing to %s", ps.Attempts, advanceTimeout.(string))
+			pl.Finish(p)
+			r.Complete = true
+			r.Advance = true
+			r.NewTxn = advanceTimeout.(string)
+			return
+		}
+		p.State.WaitRemaining = (timeout - time.Since(starttime)).Round(time.Millisecond).String()
+		return
+	}
+
+	ps.Attempts++
+	ok, err := pl.Attempt(p, starttime.Add(timeout))
+	if err != nil {
+		pl.Finish(p)
+		r.Complete = true
+		r.Err = err
+		return
+	}
+	if ok {
+		logger.Debugf("poll succeeded after %d attempts, advancing to %s", ps.Attempts, advanceSuccess.(string))
+		pl.Finish(p)
+		r.Complete = true
+		r.Success = true
+		r.Advance = true
+		r.NewTxn = advanceSuccess.(string)
+		return
+	}
+	if time.Since(starttime) >= timeout {
+		logger.Debugf("poll timed out after %d attempts, advancing to %s", ps.Attempts, advanceTimeout.(string))
+		pl.Finish(p)
+		r.Complete = true
+		r.Advance = true
+		r.NewTxn = advanceTimeout.(string)
+		return
+	}
+	ps.Next = time.Now().Add(ps.Interval)
+	p.State.WaitRemaining = (timeout - time.Since(starttime)).Round(time.Millisecond).String()
+	return
+}
+
+// Start works out the interval and the timeout, and clears out the attempts
+// variable.
+func (pl *Poll) Start(p *plan.Plan) error {
+	args, err := ParseTemplate(p, pl.Args.Args)
+	if err != nil {
+		return err
+	}
+	md, ok := args["max_duration"]
+	if !ok {
+		return errors.New("argument max_duration not present")
+	}
+	timeout, err := ParseDuration(md)
+	if err != nil {
+		return fmt.Errorf("max_duration: %w", err)
+	}
+	interval := DefaultPollInterval
+	if i, ok := args["interval"]; ok {
+		interval, err = ParseDuration(i)
+		if err != nil {
+			return fmt.Errorf("interval: %w", err)
+		}
+	}
+	until, err := pl.Conditions()
+	if err != nil {
+		return err
+	}
+	// a path is looked up in the decoded response, so there has to be one.
+	if path, _ := until["path"].(string); path != "" {
+		rt, _ := args["response_type"].(string)
+		if rt != "json" && rt != "yaml" {
+			return errors.New("until path needs a response_type of json or yaml")
+		}
+	}
+	p.State.WaitActionDuration = timeout
+	p.State.Poll = &state.PollState{Interval: interval}
+
+	if v, ok := args["save_attempts"].(string); ok && v != "" {
+		_ = p.State.DeleteVariable(v)
+		err = p.State.SetVariable(v, make([]interface{}, 0))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Attempt makes one call and checks it against the until conditions.  An
+// error is only returned if the poll can't go on; a call that fails is just
+// an attempt that didn't succeed.
+func (pl *Poll) Attempt(p *plan.Plan, deadline time.Time) (bool, error) {
+	logger := loggo.GetLogger("default")
+
+	ctx, cf := context.WithDeadline(context.Background(), deadline)
+	defer cf()
+
+	a := ArgStruct{Args: pl.Args.Args}
+	attempt := map[string]interface{}{
+		"attempt": p.State.Poll.Attempts,
+		"time":    time.Now().Format(time.RFC3339Nano),
+	}
+	ok := false
+	code, body, err := SendCallback(&a, p, ctx)
+	if err == nil {
+		attempt["status"] = code
+		var i interface{}
+		i, err = SaveCallbackResponse(a, p, body)
+		if err == nil {
+			ok, err = pl.Until(p, code, string(body), i)
+		}
+	}
+	if err != nil {
+		logger.Debugf("poll attempt %d: %s", p.State.Poll.Attempts, err)
+		attempt["error"] = err.Error()
+	}
+	attempt["success"] = ok
+
+	if v, _ := pl.Args.Args["save_attempts"].(string); v != "" {
+		err = (&Set{}).Append(p, v, attempt)
+		if err != nil {
+			return false, err
+		}
+	}
+	return ok, nil
+}
+
+// Until checks a response against the until conditions.  All of the ones
+// that are given have to be true.  With no conditions at all, a 200 is good
+// enough.
+func (pl *Poll) Until(p *plan.Plan, code int, body string, i interface{}) (bool, error) {
+	until, err := pl.Conditions()
+	if err != nil {
+		return false, err
+	}
+
+	if status, ok := until["status"].(int); ok && code != status {
+		return false, nil
+	}
+
+	if path, ok := until["path"].(string); ok && path != "" {
+		// without this, the lookup falls back to the plan's variables.
+		if i == nil {
+			return false, fmt.Errorf("path %s: no decoded response", path)
+		}
+		v, err := p.State.GetVariableRecursive(StringKeys(i), state.ParseString(path), nil)
+		if err != nil {
+			return false, fmt.Errorf("path %s: %w", path, err)
+		}
+		cond := NewConditionalOps()
+		cond.LeftOp = v
+		cond.RightOp = until["value"]
+		conditional, _ := until["conditional"].(string)
+		if conditional == "" {
+			conditional = "eq"
+		}
+		res, err := cond.Compare(conditional)
+		if err != nil {
+			return false, err
+		}
+		if !res {
+			return false, nil
+		}
+	}
+
+	if mf, ok := until["match_file"].(string); ok && mf != "" {
+		mft, _ := until["match_file_type"].(string)
+		if mft == "" {
+			mft = "json"
+		}
+		m := &Match{}
+		expected, err := ReadTemplateFile(p, mf)
+		if err != nil {
+			return false, err
+		}
+		comp, err := m.LoadString(expected, mft)
+		if err != nil {
+			return false, err
+		}
+		resp, err := m.LoadString(body, mft)
+		if err != nil {
+			return false, err
+		}
+		if !MatchingInterfaces(comp, resp) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Conditions returns the until conditions, checking the ones that can be
+// checked before any calls are made.
+func (pl *Poll) Conditions() (map[string]interface{}, error) {
+	until := make(map[string]interface{})
+	switch u := StringKeys(pl.Args.Args["until"]).(type) {
+	case nil:
+	case map[string]interface{}:
+		until = u
+	default:
+		return nil, errors.New("until is not a map")
+	}
+
+	status, ok := until["status"]
+	if !ok && until["path"] == nil && until["match_file"] == nil {
+		until["status"] = 200
+	} else if ok {
+		if _, ok := status.(int); !ok {
+			return nil, errors.New("until status is not an int")
+		}
+	}
+	return until, nil
+}
+
+// Finish clears out the poll, so the next one starts fresh.
+func (pl *Poll) Finish(p *plan.Plan) {
+	FinishWait(p)
+	p.State.Poll = nil
+}
+
+func (pl *Poll) SetArgs(i map[string]interface{}) {
+	pl.Args.Args = i
+}
+
+func (pl *Poll) Satisfy() (bool, error) {
+	return false, errors.New("cannot use satisfy_group for Poll action: there are no conditions to satisfy")
+}
+
+func (pl *Poll) GetContext() (*context.Context, *context.CancelFunc) {
+	return nil, nil
+}
+
+func (pl *Poll) CanBackground() bool {
+	return false
+}
+
+func (pl *Poll) IsBackgrounded() bool {
+	return false
+}
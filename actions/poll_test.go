@@ -0,0 +1,232 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/state"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// jobServer answers with each of the responses in turn, and then keeps
+// giving the last one.
+func jobServer(codes []int, bodies []string) *httptest.Server {
+	n := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := n
+		if i >= len(codes) {
+			i = len(codes) - 1
+		}
+		n++
+		w.WriteHeader(codes[i])
+		w.Write([]byte(bodies[i]))
+	}))
+}
+
+func TestPoll_Execute(t *testing.T) {
+	dir := t.TempDir()
+	matchfile := filepath.Join(dir, "done.json")
+	err := os.WriteFile(matchfile, []byte(`{"state": "done"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		codes        []int
+		bodies       []string
+		args         map[string]interface{}
+		variables    map[string]interface{}
+		wantTxn      string
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:   "body path",
+			codes:  []int{200, 200, 200},
+			bodies: []string{`{"state": "queued"}`, `{"state": "running"}`, `{"state": "done"}`},
+			args: map[string]interface{}{
+				"response_type": "json",
+				"until": map[interface{}]interface{}{
+					"path":  "state",
+					"value": "done",
+				},
+			},
+			wantTxn:      "done",
+			wantAttempts: 3,
+		},
+		{
+			name:   "status",
+			codes:  []int{404, 404, 200},
+			bodies: []string{"", "", "ok"},
+			args: map[string]interface{}{
+				"response_type": "string",
+			},
+			wantTxn:      "done",
+			wantAttempts: 3,
+		},
+		{
+			name:   "match file",
+			codes:  []int{200, 200},
+			bodies: []string{`{"state": "running", "id": 1}`, `{"state": "done", "id": 1}`},
+			args: map[string]interface{}{
+				"response_type": "json",
+				"until": map[interface{}]interface{}{
+					"match_file": matchfile,
+				},
+			},
+			wantTxn:      "done",
+			wantAttempts: 2,
+		},
+		{
+			name:   "not json yet",
+			codes:  []int{502, 200},
+			bodies: []string{"<html>bad gateway</html>", `{"state": "done"}`},
+			args: map[string]interface{}{
+				"response_type": "json",
+				"until": map[interface{}]interface{}{
+					"status": 200,
+					"path":   "state",
+					"value":  "done",
+				},
+			},
+			wantTxn:      "done",
+			wantAttempts: 2,
+		},
+		{
+			name:   "timeout",
+			codes:  []int{200},
+			bodies: []string{`{"state": "running"}`},
+			args: map[string]interface{}{
+				"response_type": "json",
+				"max_duration":  "100ms",
+				"until": map[interface{}]interface{}{
+					"path":  "state",
+					"value": "done",
+				},
+			},
+			wantTxn: "timed_out",
+		},
+		{
+			name:   "path on a string response",
+			codes:  []int{200},
+			bodies: []string{"still running"},
+			args: map[string]interface{}{
+				"response_type": "string",
+				"until": map[interface{}]interface{}{
+					"path":  "status",
+					"value": "complete",
+				},
+			},
+			variables: map[string]interface{}{"status": "complete"},
+			wantErr:   true,
+		},
+		{
+			name:   "path on a null response",
+			codes:  []int{200},
+			bodies: []string{"null"},
+			args: map[string]interface{}{
+				"response_type": "json",
+				"max_duration":  "100ms",
+				"until": map[interface{}]interface{}{
+					"path":  "status",
+					"value": "complete",
+				},
+			},
+			variables: map[string]interface{}{"status": "complete"},
+			wantTxn:   "timed_out",
+		},
+		{
+			name:   "bad until",
+			codes:  []int{200},
+			bodies: []string{"ok"},
+			args: map[string]interface{}{
+				"response_type": "string",
+				"until":         "done",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := jobServer(tt.codes, tt.bodies)
+			defer srv.Close()
+
+			args := map[string]interface{}{
+				"url":             srv.URL + "/jobs/1",
+				"method":          "GET",
+				"interval":        "10ms",
+				"max_duration":    "5s",
+				"advance_success": "done",
+				"advance_timeout": "timed_out",
+				"save_attempts":   "attempts",
+			}
+			for k, v := range tt.args {
+				args[k] = v
+			}
+			vars := map[string]interface{}{}
+			for k, v := range tt.variables {
+				vars[k] = v
+			}
+			p := &plan.Plan{State: &state.State{Variables: vars}}
+			pl := &Poll{Args: ArgStruct{Args: args}}
+
+			var r ExecuteResult
+			for i := 0; i < 1000; i++ {
+				r = pl.Execute(p)
+				if r.Complete {
+					break
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			if (r.Err != nil) != tt.wantErr {
+				t.Errorf("Execute() error = %v, wantErr %v", r.Err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !r.Complete || !r.Advance || r.NewTxn != tt.wantTxn {
+				t.Errorf("Execute() = %v, want advance to %s", r, tt.wantTxn)
+			}
+			if r.Success != (tt.wantTxn == "done") {
+				t.Errorf("Execute() success = %v", r.Success)
+			}
+			if p.State.Poll != nil || !p.State.WaitActionStartTime.IsZero() {
+				t.Errorf("Execute() didn't clear the poll")
+			}
+			attempts, ok := p.State.Variables["attempts"].([]interface{})
+			if !ok || len(attempts) == 0 {
+				t.Fatalf("Execute() attempts = %v", p.State.Variables["attempts"])
+			}
+			if tt.wantAttempts != 0 && len(attempts) != tt.wantAttempts {
+				t.Errorf("Execute() made %d attempts, want %d", len(attempts), tt.wantAttempts)
+			}
+			last := attempts[len(attempts)-1].(map[string]interface{})
+			if last["success"] != (tt.wantTxn == "done") {
+				t.Errorf("Execute() last attempt = %v", last)
+			}
+		})
+	}
+}
+
+func TestPoll_ExecuteNoMaxDuration(t *testing.T) {
+	p := &plan.Plan{State: &state.State{Variables: map[string]interface{}{}}}
+	pl := &Poll{Args: ArgStruct{Args: map[string]interface{}{
+		"url":             "http://localhost:1/",
+		"advance_success": "done",
+		"advance_timeout": "timed_out",
+	}}}
+	r := pl.Execute(p)
+	if r.Err == nil || !r.Complete {
+		t.Errorf("Execute() = %v, want an error", r)
+	}
+}
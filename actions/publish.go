@@ -0,0 +1,137 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/homedepot/trainer/broker"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/juju/loggo"
+	"time"
+)
+
+// DefaultPublishTimeout is how long a publish gets, unless told otherwise.
+const DefaultPublishTimeout = 10 * time.Second
+
+type Publish struct {
+	Action
+	Args ArgStruct
+}
+
+func (pb *Publish) GetName() string {
+	return "publish"
+}
+func (pb *Publish) Abort() {
+	return
+}
+
+func (pb *Publish) Execute(p *plan.Plan) (r ExecuteResult) {
+	logger := loggo.GetLogger("default")
+	logger.Tracef("Executing publish action")
+
+	r.Complete = true
+
+	args, err := ParseTemplate(p, pb.Args.Args)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	b, err := broker.Get(fmt.Sprint(args["broker"]))
+	if err != nil {
+		r.Err = err
+		return
+	}
+	m, err := pb.Message(p, args)
+	if err != nil {
+		r.Err = err
+		return
+	}
+
+	timeout := DefaultPublishTimeout
+	if t, ok := args["timeout"]; ok {
+		timeout, err = ParseDuration(t)
+		if err != nil {
+			r.Err = fmt.Errorf("timeout: %w", err)
+			return
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err = b.Publish(ctx, m)
+	if err != nil {
+		r.Err = fmt.Errorf("publishing to %s: %w", m.Topic, err)
+		return
+	}
+	logger.Debugf("published message to %s on %s", m.Topic, b.Name)
+	r.Success = true
+	return
+}
+
+// Message builds the message from the (already templated) args.
+func (pb *Publish) Message(p *plan.Plan, args map[string]interface{}) (broker.Message, error) {
+	m := broker.Message{Headers: make(map[string]string)}
+	topic, ok := args["topic"].(string)
+	if !ok || topic == "" {
+		return m, errors.New("topic not set")
+	}
+	m.Topic = topic
+	if k, ok := args["key"]; ok && k != nil {
+		m.Key = fmt.Sprint(k)
+	}
+
+	body, hasBody := args["body"].(string)
+	file, hasFile := args["body_file"].(string)
+	switch {
+	case hasBody && hasFile:
+		return m, errors.New("only one of body and body_file can be set")
+	case hasFile:
+		b, err := ReadTemplateFile(p, file)
+		if err != nil {
+			return m, fmt.Errorf("body_file: %w", err)
+		}
+		body = b
+	case !hasBody:
+		return m, errors.New("body or body_file not set")
+	}
+	m.Body = []byte(body)
+
+	switch h := StringKeys(args["headers"]).(type) {
+	case nil:
+	case map[string]interface{}:
+		for k, v := range h {
+			s, err := ParseStringTemplate(p, fmt.Sprint(v))
+			if err != nil {
+				return m, fmt.Errorf("header %s: %w", k, err)
+			}
+			m.Headers[k] = s
+		}
+	default:
+		return m, errors.New("headers is not a map")
+	}
+	return m, nil
+}
+
+func (pb *Publish) SetArgs(i map[string]interface{}) {
+	pb.Args.Args = i
+}
+
+func (pb *Publish) Satisfy() (bool, error) {
+	return false, errors.New("cannot use satisfy_group for Publish action: there are no conditions to satisfy")
+}
+
+func (pb *Publish) GetContext() (*context.Context, *context.CancelFunc) {
+	return nil, nil
+}
+
+func (pb *Publish) CanBackground() bool {
+	return false
+}
+
+func (pb *Publish) IsBackgrounded() bool {
+	return false
+}
@@ -0,0 +1,113 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"github.com/homedepot/trainer/broker"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/state"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testBroker returns the in-memory broker the publish and consume tests
+// share, opening it the first time.
+func testBroker(t *testing.T) *broker.Broker {
+	if b, err := broker.Get("actions_test"); err == nil {
+		return b
+	}
+	b, err := broker.Open("actions_test", broker.Config{Type: "memory"})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	return b
+}
+
+func TestPublish_Execute(t *testing.T) {
+	dir := t.TempDir()
+	bodyfile := filepath.Join(dir, "body.json")
+	os.WriteFile(bodyfile, []byte(`{"id": "<<.Variables.id>>"}`), 0644)
+
+	tests := []struct {
+		name    string
+		args    map[string]interface{}
+		want    string
+		key     string
+		headers map[string]string
+		wantErr bool
+	}{
+		{
+			name: "body",
+			args: map[string]interface{}{
+				"broker": "actions_test", "topic": "publish_body", "key": "<<.Variables.id>>",
+				"body":    `{"id": "<<.Variables.id>>"}`,
+				"headers": map[interface{}]interface{}{"source": "<<.Variables.id>>"},
+			},
+			want:    `{"id": "42"}`,
+			key:     "42",
+			headers: map[string]string{"source": "42"},
+		},
+		{
+			name: "body file",
+			args: map[string]interface{}{"broker": "actions_test", "topic": "publish_body_file", "body_file": bodyfile},
+			want: `{"id": "42"}`,
+		},
+		{
+			name:    "both bodies",
+			args:    map[string]interface{}{"broker": "actions_test", "topic": "publish_both", "body": "x", "body_file": bodyfile},
+			wantErr: true,
+		},
+		{
+			name:    "no body",
+			args:    map[string]interface{}{"broker": "actions_test", "topic": "publish_none"},
+			wantErr: true,
+		},
+		{
+			name:    "no topic",
+			args:    map[string]interface{}{"broker": "actions_test", "body": "x"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown broker",
+			args:    map[string]interface{}{"broker": "nope", "topic": "x", "body": "x"},
+			wantErr: true,
+		},
+	}
+	b := testBroker(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topic, _ := tt.args["topic"].(string)
+			b.Subscribe(topic)
+			p := &plan.Plan{State: state.NewState("a")}
+			p.State.Variables["id"] = "42"
+			pb := &Publish{}
+			pb.SetArgs(tt.args)
+			r := pb.Execute(p)
+			if (r.Err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", r.Err, tt.wantErr)
+			}
+			if !r.Complete {
+				t.Errorf("Execute() complete = false")
+			}
+			if tt.wantErr {
+				return
+			}
+			m, _ := b.Take(topic, func(broker.Message) (bool, error) { return true, nil })
+			if m == nil {
+				t.Fatalf("no message published to %s", topic)
+			}
+			if string(m.Body) != tt.want || m.Key != tt.key {
+				t.Errorf("published %s %q, want %s %q", m.Key, m.Body, tt.key, tt.want)
+			}
+			for k, v := range tt.headers {
+				if m.Headers[k] != v {
+					t.Errorf("header %s = %s, want %s", k, m.Headers[k], v)
+				}
+			}
+		})
+	}
+}
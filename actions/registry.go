@@ -0,0 +1,512 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/homedepot/trainer/config"
+	"github.com/homedepot/trainer/structs/expected"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/planaction"
+	"github.com/homedepot/trainer/structs/stub"
+	"github.com/homedepot/trainer/structs/transaction"
+)
+
+// Argument types for an ArgSpec.
+const (
+	ArgAny     = ""        // anything goes
+	ArgString  = "string"  // must be a string
+	ArgNumber  = "number"  // an int or float, or a string (which may be a template)
+	ArgBool    = "bool"    // a bool, or a string (which may be a template)
+	ArgList    = "list"    // a yaml list
+	ArgMap     = "map"     // a yaml map
+	ArgActions = "actions" // a list of actions, which are checked the same way
+)
+
+// ArgSpec describes one argument of an action.
+type ArgSpec struct {
+	Name        string
+	Type        string
+	Required    bool
+	Description string
+}
+
+// Factory returns a new, empty instance of an action.
+type Factory func() Action
+
+// Registration is everything trainer needs to know about an action type.
+// Args is optional; args that aren't listed in it are not checked.
+// WhileWaiting actions run in a satisfy group with url actions whenever
+// there's no request for them, instead of the group waiting for one.
+type Registration struct {
+	Name         string
+	Factory      Factory
+	Args         []ArgSpec
+	WhileWaiting bool
+}
+
+var registry = struct {
+	sync.RWMutex
+	m map[string]Registration
+}{m: make(map[string]Registration)}
+
+// Register adds an action type.  It's meant to be called from an init
+// function of the package that implements the action, before the config is
+// loaded.
+func Register(r Registration) error {
+	if r.Name == "" {
+		return errors.New("action name is empty")
+	}
+	if r.Factory == nil {
+		return fmt.Errorf("action %s has no factory", r.Name)
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.m[r.Name]; ok {
+		return fmt.Errorf("action %s is already registered", r.Name)
+	}
+	registry.m[r.Name] = r
+	return nil
+}
+
+// MustRegister is Register, but panics on error.
+func MustRegister(r Registration) {
+	if err := Register(r); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup returns the registration for an action type.
+func Lookup(name string) (Registration, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	r, ok := registry.m[name]
+	return r, ok
+}
+
+// New returns a fresh instance of an action type.
+func New(name string) (Action, error) {
+	r, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown action type %s", name)
+	}
+	return r.Factory(), nil
+}
+
+// RunsWhileWaiting returns whether an action type runs in a satisfy group
+// while there's no request for the group's url actions.
+func RunsWhileWaiting(name string) bool {
+	r, ok := Lookup(name)
+	return ok && r.WhileWaiting
+}
+
+// Registered returns the names of all registered action types, sorted.
+func Registered() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	out := make([]string, 0, len(registry.m))
+	for k := range registry.m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ValidateAction checks that an action's type is registered, and that its
+// args match the registered schema.
+func ValidateAction(pa planaction.PlanAction) error {
+	r, ok := Lookup(pa.Type)
+	if !ok {
+		return fmt.Errorf("unknown action type %s", pa.Type)
+	}
+	for _, s := range r.Args {
+		v, ok := pa.Args[s.Name]
+		if !ok || v == nil {
+			if s.Required {
+				return fmt.Errorf("%s: argument %s not found", pa.Type, s.Name)
+			}
+			continue
+		}
+		if err := s.Check(v); err != nil {
+			return fmt.Errorf("%s: argument %s: %w", pa.Type, s.Name, err)
+		}
+	}
+	return nil
+}
+
+// Check checks a single value against the spec.  Strings are accepted for
+// numbers and bools, since args are templated before the action sees them.
+func (s ArgSpec) Check(v interface{}) error {
+	switch s.Type {
+	case ArgAny:
+		return nil
+	case ArgString:
+		if _, ok := v.(string); ok {
+			return nil
+		}
+	case ArgNumber:
+		switch v.(type) {
+		case int, int64, float64, string:
+			return nil
+		}
+	case ArgBool:
+		switch v.(type) {
+		case bool, string:
+			return nil
+		}
+	case ArgList:
+		if _, ok := v.([]interface{}); ok {
+			return nil
+		}
+	case ArgMap:
+		switch v.(type) {
+		case map[interface{}]interface{}, map[string]interface{}:
+			return nil
+		}
+	case ArgActions:
+		l, err := LoadPlanActions(v)
+		if err != nil {
+			return err
+		}
+		for _, a := range l {
+			if err := ValidateAction(a); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown argument type %s", s.Type)
+	}
+	return fmt.Errorf("expected %s, got %T", s.Type, v)
+}
+
+// ValidatePlan checks every action in a plan, including the ones run on
+// expected and unexpected responses, and that the transactions to go to on
+// errors exist.
+func ValidatePlan(p *plan.Plan) error {
+	if p.ErrorTransaction != "" {
+		if _, err := p.FindTransaction(p.ErrorTransaction); err != nil {
+			return fmt.Errorf("plan %s: error_transaction %s: %w", p.Name, p.ErrorTransaction, err)
+		}
+	}
+	if p.Timeout != "" {
+		if _, err := time.ParseDuration(p.Timeout); err != nil {
+			return fmt.Errorf("plan %s: timeout: %w", p.Name, err)
+		}
+	}
+	if _, err := p.ParseSeedTime(); err != nil {
+		return fmt.Errorf("plan %s: %w", p.Name, err)
+	}
+	if err := ValidateStubs(p.Stubs); err != nil {
+		return fmt.Errorf("plan %s: %w", p.Name, err)
+	}
+	if err := validateHooks(p, "setup", p.Setup); err != nil {
+		return err
+	}
+	if err := validateHooks(p, "teardown", p.Teardown); err != nil {
+		return err
+	}
+	for _, t := range p.Txn {
+		if err := validateOnError(p, t.OnError); err != nil {
+			return fmt.Errorf("plan %s txn %s: %w", p.Name, t.Name, err)
+		}
+		for _, e := range []expected.Expected{t.OnExpected, t.OnUnexpected} {
+			if e.Fault == nil {
+				continue
+			}
+			if err := e.Fault.Validate(); err != nil {
+				return fmt.Errorf("plan %s txn %s: %w", p.Name, t.Name, err)
+			}
+		}
+		l := make([]planaction.PlanAction, 0)
+		l = append(l, t.InitAction...)
+		l = append(l, t.OnExpected.Action...)
+		l = append(l, t.OnUnexpected.Action...)
+		for _, a := range l {
+			if err := ValidateAction(a); err != nil {
+				return fmt.Errorf("plan %s txn %s: %w", p.Name, t.Name, err)
+			}
+			if err := validateOnError(p, a.OnError); err != nil {
+				return fmt.Errorf("plan %s txn %s: %s: %w", p.Name, t.Name, a.Type, err)
+			}
+			if err := validateRules(a); err != nil {
+				return fmt.Errorf("plan %s txn %s: %s: %w", p.Name, t.Name, a.Type, err)
+			}
+			if err := validateLoops(p, a, nil); err != nil {
+				return fmt.Errorf("plan %s txn %s: %w", p.Name, t.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateHooks checks setup or teardown transactions.  They just run their
+// actions in order, so there's nothing to wait for a request with.
+func validateHooks(p *plan.Plan, kind string, txns []transaction.Transaction) error {
+	for _, t := range txns {
+		if t.URL != "" {
+			return fmt.Errorf("plan %s %s txn %s: can't have a url", p.Name, kind, t.Name)
+		}
+		for _, a := range t.InitAction {
+			if a.Type == "url" {
+				return fmt.Errorf("plan %s %s txn %s: can't have a url action", p.Name, kind, t.Name)
+			}
+			if err := ValidateAction(a); err != nil {
+				return fmt.Errorf("plan %s %s txn %s: %w", p.Name, kind, t.Name, err)
+			}
+			if err := validateLoops(p, a, nil); err != nil {
+				return fmt.Errorf("plan %s %s txn %s: %w", p.Name, kind, t.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateLoops checks that a foreach doesn't have another foreach inside it
+// with the same name, since they'd share their loop state and their item
+// variable.  outer is the names of the loops pa is inside of.
+func validateLoops(p *plan.Plan, pa planaction.PlanAction, outer []string) error {
+	if pa.Type != "foreach" {
+		return nil
+	}
+	name := LoopName(pa.Args)
+	for _, o := range outer {
+		if o == name {
+			return fmt.Errorf("foreach %s is inside another foreach %s: give one of them another name", name, name)
+		}
+	}
+	var body []planaction.PlanAction
+	if t, ok := pa.Args["txn"].(string); ok && t != "" {
+		txn, err := p.FindTransaction(t)
+		if err != nil {
+			return fmt.Errorf("foreach %s: txn %s: %w", name, t, err)
+		}
+		body = txn.InitAction
+	} else if pa.Args["actions"] != nil {
+		var err error
+		body, err = LoadPlanActions(pa.Args["actions"])
+		if err != nil {
+			return fmt.Errorf("foreach %s: %w", name, err)
+		}
+	}
+	outer = append(outer[:len(outer):len(outer)], name)
+	for _, a := range body {
+		if err := validateLoops(p, a, outer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateStubs checks that stubs can match requests and build their
+// responses.  Stubs are answered without any plan's variables, so they
+// can't use body_from_var, and they don't run actions.
+func ValidateStubs(stubs []stub.Stub) error {
+	seen := make(map[string]bool)
+	for _, s := range stubs {
+		k := s.Key()
+		if seen[k] {
+			return fmt.Errorf("stub %s: there's another stub called that", k)
+		}
+		seen[k] = true
+		if s.URL == "" {
+			return fmt.Errorf("stub %s: no url", k)
+		}
+		if _, err := PathPattern(s.URL); err != nil {
+			return fmt.Errorf("stub %s: %w", k, err)
+		}
+		if _, err := LoadValueMatches(s.Headers); err != nil {
+			return fmt.Errorf("stub %s: headers: %w", k, err)
+		}
+		if _, err := LoadValueMatches(s.Query); err != nil {
+			return fmt.Errorf("stub %s: query: %w", k, err)
+		}
+		if s.ResponseCode == "" {
+			return fmt.Errorf("stub %s: no response_code", k)
+		}
+		if !s.HasBody() {
+			return fmt.Errorf("stub %s: no response or body", k)
+		}
+		if s.BodyFromVar != "" || len(s.Action) > 0 {
+			return fmt.Errorf("stub %s: stubs can't have body_from_var or actions", k)
+		}
+		if s.Fault != nil {
+			if err := s.Fault.Validate(); err != nil {
+				return fmt.Errorf("stub %s: %w", k, err)
+			}
+		}
+		if s.MinCalls != nil && s.MaxCalls != nil && *s.MinCalls > *s.MaxCalls {
+			return fmt.Errorf("stub %s: min_calls is more than max_calls", k)
+		}
+	}
+	return nil
+}
+
+// validateRules checks the rules, responses and fault of a url action, and
+// the actions the rules and responses run.
+func validateRules(pa planaction.PlanAction) error {
+	if pa.Type != "url" {
+		return nil
+	}
+	if _, err := LoadFault(pa.Args["fault"]); err != nil {
+		return err
+	}
+	rules, err := LoadResponseRules(pa.Args["rules"])
+	if err != nil {
+		return fmt.Errorf("rules: %w", err)
+	}
+	overrides := make(map[string]interface{})
+	for _, r := range rules {
+		overrides["rule "+r.Name] = r.OnExpected
+	}
+	if pa.Args["responses"] != nil {
+		if rules != nil {
+			return errors.New("only one of rules and responses can be given")
+		}
+		l, err := LoadResponses(pa.Args["responses"])
+		if err != nil {
+			return err
+		}
+		mode, _ := pa.Args["sequence"].(string)
+		if _, _, err := SequenceIndex(1, len(l), mode); err != nil {
+			return err
+		}
+		for i, r := range l {
+			overrides[fmt.Sprintf("response %d", i)] = r
+		}
+	}
+	for name, o := range overrides {
+		oe, _ := o.(map[string]interface{})
+		if _, err := LoadFault(oe["fault"]); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if oe["action"] == nil {
+			continue
+		}
+		l, err := LoadPlanActions(oe["action"])
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		for _, a := range l {
+			if err := ValidateAction(a); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateOnError(p *plan.Plan, oe *planaction.OnError) error {
+	if oe == nil {
+		return nil
+	}
+	if oe.Retry < 0 {
+		return errors.New("on_error: retry can't be negative")
+	}
+	if oe.Advance != "" && oe.Continue {
+		return errors.New("on_error: only one of advance and continue can be set")
+	}
+	if oe.Advance != "" {
+		if _, err := p.FindTransaction(oe.Advance); err != nil {
+			return fmt.Errorf("on_error: advance %s: %w", oe.Advance, err)
+		}
+	}
+	return nil
+}
+
+// ValidateConfig checks every plan and stub in a config, and its databases.
+// The config's plugins are registered first, since plans can use them.  It
+// runs whenever a config is loaded.
+func ValidateConfig(c *config.Config) error {
+	for _, pl := range c.Plugins {
+		if err := RegisterPlugin(pl); err != nil {
+			return err
+		}
+	}
+	for name, db := range c.Databases {
+		if err := checkDatabase(name, db); err != nil {
+			return err
+		}
+	}
+	for i := range c.Plans {
+		if err := ValidatePlan(&c.Plans[i]); err != nil {
+			return err
+		}
+	}
+	return ValidateStubs(c.Stubs)
+}
+
+func init() {
+	for _, r := range builtins {
+		MustRegister(r)
+	}
+	config.AddValidator(ValidateConfig)
+}
+
+func required(names ...string) []ArgSpec {
+	out := make([]ArgSpec, 0, len(names))
+	for _, n := range names {
+		out = append(out, ArgSpec{Name: n, Type: ArgString, Required: true})
+	}
+	return out
+}
+
+// builtins are the actions that ship with trainer.  Their schemas only list
+// the args they can't run without; the rest are checked when they run.
+var builtins = []Registration{
+	{Name: "advance", Factory: func() Action { return &Advance{} }, Args: required("txn")},
+	{Name: "call", Factory: func() Action { return &Call{} }, Args: required("plan")},
+	{Name: "callback", Factory: func() Action { return &Callback{} }, Args: required("url")},
+	{Name: "cbsplit", Factory: func() Action { return &CbSplit{} }, Args: required("url")},
+	{Name: "cbfinish", Factory: func() Action { return &CbFinish{} }},
+	{Name: "consume", Factory: func() Action { return &Consume{} }, Args: append(required("broker", "topic"),
+		ArgSpec{Name: "match", Type: ArgMap},
+	)},
+	{Name: "conditional", Factory: func() Action { return &Conditional{} }, Args: []ArgSpec{
+		{Name: "term", Required: true},
+	}},
+	{Name: "foreach", Factory: func() Action { return &Foreach{} }, Args: append(required("list", "item"),
+		ArgSpec{Name: "actions", Type: ArgActions},
+	)},
+	{Name: "generate", Factory: func() Action { return &Generate{} }, Args: required("variable", "kind")},
+	{Name: "log", Factory: func() Action { return &Log{} }, Args: required("value")},
+	{Name: "match", Factory: func() Action { return &Match{} }, Args: required("match_file", "match_file_type", "response_type", "variable")},
+	{Name: "math", Factory: func() Action { return &Math{} }, Args: append(required("variable", "action"),
+		ArgSpec{Name: "value", Type: ArgNumber, Required: true},
+	)},
+	{Name: "poll", Factory: func() Action { return &Poll{} }, Args: required("url", "advance_success", "advance_timeout")},
+	{Name: "publish", Factory: func() Action { return &Publish{} }, Args: append(required("broker", "topic"),
+		ArgSpec{Name: "headers", Type: ArgMap},
+	)},
+	{Name: "return", Factory: func() Action { return &Return{} }},
+	{Name: "set", Factory: func() Action { return &Set{} }, Args: required("variable")},
+	{Name: "sql", Factory: func() Action { return &SQL{} }, Args: []ArgSpec{
+		{Name: "params", Type: ArgList},
+	}},
+	{Name: "wait", Factory: func() Action { return &Wait{} }},
+	{Name: "wait_until", Factory: func() Action { return &WaitUntil{} }, WhileWaiting: true, Args: append(required("advance_true", "advance_false"),
+		ArgSpec{Name: "term", Required: true},
+	)},
+	{Name: "test", Factory: func() Action { return &Test{} }},
+	{Name: "time", Factory: func() Action { return &Time{} }},
+	{Name: "transform", Factory: func() Action { return &Transform{} }, Args: required("variable")},
+	{Name: "url", Factory: func() Action { return &URL{} }, Args: append(required("url"),
+		ArgSpec{Name: "method", Type: ArgString},
+		ArgSpec{Name: "headers", Type: ArgMap},
+		ArgSpec{Name: "query", Type: ArgMap},
+		ArgSpec{Name: "param_prefix", Type: ArgString},
+		ArgSpec{Name: "rules", Type: ArgList},
+		ArgSpec{Name: "responses", Type: ArgList},
+		ArgSpec{Name: "sequence", Type: ArgString},
+		ArgSpec{Name: "save_count", Type: ArgString},
+		ArgSpec{Name: "fault", Type: ArgMap},
+	)},
+}
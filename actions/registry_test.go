@@ -0,0 +1,442 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"github.com/homedepot/trainer/structs/expected"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/planaction"
+	"github.com/homedepot/trainer/structs/state"
+	"github.com/homedepot/trainer/structs/stub"
+	"github.com/homedepot/trainer/structs/transaction"
+	"reflect"
+	"testing"
+)
+
+type registryTestAction struct {
+	Test
+}
+
+func TestRegister(t *testing.T) {
+	factory := func() Action { return &registryTestAction{} }
+	tests := []struct {
+		name    string
+		reg     Registration
+		wantErr bool
+	}{
+		{
+			name: "new action",
+			reg:  Registration{Name: "registry_test", Factory: factory},
+		},
+		{
+			name:    "duplicate",
+			reg:     Registration{Name: "registry_test", Factory: factory},
+			wantErr: true,
+		},
+		{
+			name:    "builtin",
+			reg:     Registration{Name: "wait", Factory: factory},
+			wantErr: true,
+		},
+		{
+			name:    "no name",
+			reg:     Registration{Factory: factory},
+			wantErr: true,
+		},
+		{
+			name:    "no factory",
+			reg:     Registration{Name: "registry_test_nofactory"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Register(tt.reg); (err != nil) != tt.wantErr {
+				t.Errorf("Register() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, ok := Lookup("registry_test"); !ok {
+		t.Errorf("Lookup() didn't find registered action")
+	}
+	found := false
+	for _, n := range Registered() {
+		if n == "registry_test" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Registered() = %v, missing registry_test", Registered())
+	}
+}
+
+func TestNew(t *testing.T) {
+	a, err := New("wait")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	b, _ := New("wait")
+	if a == b {
+		t.Errorf("New() returned the same instance twice")
+	}
+	if _, err := New("nonexistent"); err == nil {
+		t.Errorf("New() expected error for unknown type")
+	}
+}
+
+func TestNewActions(t *testing.T) {
+	as := NewActions()
+	for _, r := range builtins {
+		a, ok := as.Actions[r.Name]
+		if !ok {
+			t.Errorf("NewActions() has no %s", r.Name)
+			continue
+		}
+		if want, _ := New(r.Name); reflect.TypeOf(a) != reflect.TypeOf(want) {
+			t.Errorf("NewActions() %s = %T, want %T", r.Name, a, want)
+		}
+	}
+}
+
+func TestRunsWhileWaiting(t *testing.T) {
+	for name, want := range map[string]bool{"wait_until": true, "set": false, "url": false, "nonexistent": false} {
+		if got := RunsWhileWaiting(name); got != want {
+			t.Errorf("RunsWhileWaiting(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestExecute_Unknown(t *testing.T) {
+	p := &plan.Plan{State: state.NewState("a")}
+	action, res := Execute("nonexistent", nil, p)
+	if action != nil || res.Err == nil || !res.Complete {
+		t.Errorf("Execute() = %v, %+v, want nil action and an error", action, res)
+	}
+	if _, err := Satisfy("nonexistent", nil); err == nil {
+		t.Errorf("Satisfy() expected error for unknown type")
+	}
+}
+
+func TestValidateAction(t *testing.T) {
+	tests := []struct {
+		name    string
+		pa      planaction.PlanAction
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			pa:   planaction.PlanAction{Type: "advance", Args: map[string]interface{}{"txn": "a"}},
+		},
+		{
+			name:    "unknown type",
+			pa:      planaction.PlanAction{Type: "advanse", Args: map[string]interface{}{"txn": "a"}},
+			wantErr: true,
+		},
+		{
+			name:    "missing required",
+			pa:      planaction.PlanAction{Type: "advance", Args: map[string]interface{}{}},
+			wantErr: true,
+		},
+		{
+			name:    "wrong type",
+			pa:      planaction.PlanAction{Type: "advance", Args: map[string]interface{}{"txn": 5}},
+			wantErr: true,
+		},
+		{
+			name: "number as template",
+			pa: planaction.PlanAction{Type: "math", Args: map[string]interface{}{
+				"variable": "a", "action": "add", "value": "<<.Variables.b>>",
+			}},
+		},
+		{
+			name: "nested actions",
+			pa: planaction.PlanAction{Type: "foreach", Args: map[string]interface{}{
+				"list": "l", "item": "i",
+				"actions": []interface{}{
+					map[interface{}]interface{}{"type": "log", "args": map[interface{}]interface{}{"value": "x"}},
+				},
+			}},
+		},
+		{
+			name: "nested unknown type",
+			pa: planaction.PlanAction{Type: "foreach", Args: map[string]interface{}{
+				"list": "l", "item": "i",
+				"actions": []interface{}{
+					map[interface{}]interface{}{"type": "lg"},
+				},
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateAction(tt.pa); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidatePlan(t *testing.T) {
+	for i := range Config.Plans {
+		if err := ValidatePlan(&Config.Plans[i]); err != nil {
+			t.Errorf("ValidatePlan(%s) error = %v", Config.Plans[i].Name, err)
+		}
+	}
+
+	p := &plan.Plan{Name: "bad", Txn: []transaction.Transaction{
+		{Name: "a", InitAction: []planaction.PlanAction{{Type: "nonexistent"}}},
+	}}
+	if err := ValidatePlan(p); err == nil {
+		t.Errorf("ValidatePlan() expected error for unknown type")
+	}
+
+	args := map[string]interface{}{"value": "x"}
+	tests := []struct {
+		name    string
+		plan    *plan.Plan
+		wantErr bool
+	}{
+		{
+			name: "on_error advance",
+			plan: &plan.Plan{ErrorTransaction: "b", Txn: []transaction.Transaction{
+				{Name: "a", OnError: &planaction.OnError{Continue: true}, InitAction: []planaction.PlanAction{
+					{Type: "log", Args: args, OnError: &planaction.OnError{Retry: 2, Advance: "b"}},
+				}},
+				{Name: "b"},
+			}},
+		},
+		{
+			name:    "unknown error_transaction",
+			plan:    &plan.Plan{ErrorTransaction: "nope", Txn: []transaction.Transaction{{Name: "a"}}},
+			wantErr: true,
+		},
+		{
+			name: "unknown advance",
+			plan: &plan.Plan{Txn: []transaction.Transaction{
+				{Name: "a", InitAction: []planaction.PlanAction{
+					{Type: "log", Args: args, OnError: &planaction.OnError{Advance: "nope"}},
+				}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "advance and continue",
+			plan: &plan.Plan{Txn: []transaction.Transaction{
+				{Name: "a", OnError: &planaction.OnError{Advance: "a", Continue: true}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "setup and teardown",
+			plan: &plan.Plan{Timeout: "1m", Txn: []transaction.Transaction{{Name: "a"}},
+				Setup:    []transaction.Transaction{{Name: "s", InitAction: []planaction.PlanAction{{Type: "log", Args: args}}}},
+				Teardown: []transaction.Transaction{{Name: "t", InitAction: []planaction.PlanAction{{Type: "log", Args: args}}}},
+			},
+		},
+		{
+			name:    "bad timeout",
+			plan:    &plan.Plan{Timeout: "soon", Txn: []transaction.Transaction{{Name: "a"}}},
+			wantErr: true,
+		},
+		{
+			name: "url in teardown",
+			plan: &plan.Plan{Txn: []transaction.Transaction{{Name: "a"}},
+				Teardown: []transaction.Transaction{{Name: "t", URL: "/cleanup"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "bad setup action",
+			plan: &plan.Plan{Txn: []transaction.Transaction{{Name: "a"}},
+				Setup: []transaction.Transaction{{Name: "s", InitAction: []planaction.PlanAction{{Type: "nonexistent"}}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "url rules",
+			plan: &plan.Plan{Txn: []transaction.Transaction{
+				{Name: "a", InitAction: []planaction.PlanAction{{Type: "url", Args: map[string]interface{}{"url": "/pay", "rules": []interface{}{
+					map[interface{}]interface{}{"body": map[interface{}]interface{}{"card": "1"}, "on_expected": map[interface{}]interface{}{
+						"action": []interface{}{map[interface{}]interface{}{"type": "log", "args": args}},
+					}},
+					map[interface{}]interface{}{"on_expected": map[interface{}]interface{}{"response_code": "200"}},
+				}}}}},
+			}},
+		},
+		{
+			name: "bad rule action",
+			plan: &plan.Plan{Txn: []transaction.Transaction{
+				{Name: "a", InitAction: []planaction.PlanAction{{Type: "url", Args: map[string]interface{}{"url": "/pay", "rules": []interface{}{
+					map[interface{}]interface{}{"on_expected": map[interface{}]interface{}{
+						"action": []interface{}{map[interface{}]interface{}{"type": "nonexistent"}},
+					}},
+				}}}}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "default rule not last",
+			plan: &plan.Plan{Txn: []transaction.Transaction{
+				{Name: "a", InitAction: []planaction.PlanAction{{Type: "url", Args: map[string]interface{}{"url": "/pay", "rules": []interface{}{
+					map[interface{}]interface{}{"name": "default"},
+					map[interface{}]interface{}{"query": map[interface{}]interface{}{"a": "1"}},
+				}}}}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "url responses",
+			plan: &plan.Plan{Txn: []transaction.Transaction{
+				{Name: "a", InitAction: []planaction.PlanAction{{Type: "url", Args: map[string]interface{}{"url": "/pay", "sequence": "cyclic", "responses": []interface{}{
+					map[interface{}]interface{}{"response_code": "503"},
+					map[interface{}]interface{}{"response_code": "200"},
+				}}}}},
+			}},
+		},
+		{
+			name: "unknown sequence",
+			plan: &plan.Plan{Txn: []transaction.Transaction{
+				{Name: "a", InitAction: []planaction.PlanAction{{Type: "url", Args: map[string]interface{}{"url": "/pay", "sequence": "shuffle", "responses": []interface{}{
+					map[interface{}]interface{}{"response_code": "200"},
+				}}}}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "bad response action",
+			plan: &plan.Plan{Txn: []transaction.Transaction{
+				{Name: "a", InitAction: []planaction.PlanAction{{Type: "url", Args: map[string]interface{}{"url": "/pay", "responses": []interface{}{
+					map[interface{}]interface{}{"action": []interface{}{map[interface{}]interface{}{"type": "nonexistent"}}},
+				}}}}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "url fault",
+			plan: &plan.Plan{Txn: []transaction.Transaction{
+				{Name: "a", InitAction: []planaction.PlanAction{{Type: "url", Args: map[string]interface{}{"url": "/pay",
+					"fault": map[interface{}]interface{}{"delay": "10ms", "delay_max": "1s", "error_code": 503, "probability": 0.1},
+				}}}},
+			}},
+		},
+		{
+			name: "bad url fault",
+			plan: &plan.Plan{Txn: []transaction.Transaction{
+				{Name: "a", InitAction: []planaction.PlanAction{{Type: "url", Args: map[string]interface{}{"url": "/pay",
+					"fault": map[interface{}]interface{}{"hang": true},
+				}}}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "bad response fault",
+			plan: &plan.Plan{Txn: []transaction.Transaction{
+				{Name: "a", InitAction: []planaction.PlanAction{{Type: "url", Args: map[string]interface{}{"url": "/pay", "responses": []interface{}{
+					map[interface{}]interface{}{"fault": map[interface{}]interface{}{"reset": true, "empty": true}},
+				}}}}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "bad on_expected fault",
+			plan: &plan.Plan{Txn: []transaction.Transaction{
+				{Name: "a", OnExpected: expected.Expected{Fault: &expected.Fault{Delay: "soon"}}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "negative retry",
+			plan: &plan.Plan{Txn: []transaction.Transaction{
+				{Name: "a", OnError: &planaction.OnError{Retry: -1}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "nested foreach",
+			plan: &plan.Plan{Txn: []transaction.Transaction{
+				{Name: "a", InitAction: []planaction.PlanAction{{Type: "foreach", Args: map[string]interface{}{
+					"list": "orders", "item": "order", "actions": []interface{}{
+						map[interface{}]interface{}{"type": "foreach", "args": map[interface{}]interface{}{
+							"list": "order.items", "item": "item", "actions": []interface{}{
+								map[interface{}]interface{}{"type": "log", "args": args},
+							},
+						}},
+					},
+				}}}},
+			}},
+		},
+		{
+			name: "nested foreach with the same item",
+			plan: &plan.Plan{Txn: []transaction.Transaction{
+				{Name: "a", InitAction: []planaction.PlanAction{{Type: "foreach", Args: map[string]interface{}{
+					"list": "orders", "item": "item", "actions": []interface{}{
+						map[interface{}]interface{}{"type": "foreach", "args": map[interface{}]interface{}{
+							"list": "item.lines", "item": "item", "actions": []interface{}{
+								map[interface{}]interface{}{"type": "log", "args": args},
+							},
+						}},
+					},
+				}}}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "nested foreach with the same name through a txn",
+			plan: &plan.Plan{Txn: []transaction.Transaction{
+				{Name: "a", InitAction: []planaction.PlanAction{{Type: "foreach", Args: map[string]interface{}{
+					"list": "orders", "item": "order", "name": "loop", "txn": "body",
+				}}}},
+				{Name: "body", InitAction: []planaction.PlanAction{{Type: "foreach", Args: map[string]interface{}{
+					"list": "order.items", "item": "item", "name": "loop", "actions": []interface{}{
+						map[interface{}]interface{}{"type": "log", "args": args},
+					},
+				}}}},
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidatePlan(tt.plan); (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePlan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateStubs(t *testing.T) {
+	ok := expected.Expected{ResponseCode: "200", Body: "{}"}
+	two, one := 2, 1
+	tests := []struct {
+		name    string
+		stubs   []stub.Stub
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "good", stubs: []stub.Stub{
+			{URL: "/flags/:app", Method: "GET", Headers: map[string]interface{}{"X-App": "a"}, Expected: ok},
+			{URL: "/flags/:app", Method: "POST", Expected: ok, MinCalls: &one, MaxCalls: &two},
+		}},
+		{name: "same key", stubs: []stub.Stub{{URL: "/flags", Expected: ok}, {URL: "/flags", Expected: ok}}, wantErr: true},
+		{name: "no url", stubs: []stub.Stub{{Name: "flags", Expected: ok}}, wantErr: true},
+		{name: "bad url", stubs: []stub.Stub{{URL: "^/flags/(", Expected: ok}}, wantErr: true},
+		{name: "bad query", stubs: []stub.Stub{{URL: "/flags", Query: map[string]interface{}{"a": map[interface{}]interface{}{"like": "b"}}, Expected: ok}}, wantErr: true},
+		{name: "no code", stubs: []stub.Stub{{URL: "/flags", Expected: expected.Expected{Body: "{}"}}}, wantErr: true},
+		{name: "no body", stubs: []stub.Stub{{URL: "/flags", Expected: expected.Expected{ResponseCode: "200"}}}, wantErr: true},
+		{name: "body_from_var", stubs: []stub.Stub{{URL: "/flags", Expected: expected.Expected{ResponseCode: "200", BodyFromVar: "flags"}}}, wantErr: true},
+		{name: "bad fault", stubs: []stub.Stub{{URL: "/flags", Expected: expected.Expected{ResponseCode: "200", Body: "", Fault: &expected.Fault{Delay: "soon"}}}}, wantErr: true},
+		{name: "min over max", stubs: []stub.Stub{{URL: "/flags", Expected: ok, MinCalls: &two, MaxCalls: &one}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateStubs(tt.stubs); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateStubs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
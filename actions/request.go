@@ -0,0 +1,72 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"encoding/json"
+	"github.com/homedepot/trainer/templates"
+	"gopkg.in/yaml.v2"
+	"io"
+	"strings"
+)
+
+// ReadBody returns the request body.  It can only be read from the request
+// once, so it's kept for whatever needs it next.
+func (q *QueueContext) ReadBody() ([]byte, error) {
+	if q.Body != nil {
+		return q.Body, nil
+	}
+	if q.Ctx.Request.Body == nil {
+		q.Body = []byte{}
+		return q.Body, nil
+	}
+	body, err := io.ReadAll(q.Ctx.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	q.Body = body
+	return body, nil
+}
+
+// TemplateRequest returns the request for a response template.  The body
+// is parsed as yaml if the content type says so, and as json otherwise.
+func (q *QueueContext) TemplateRequest() (*templates.Request, error) {
+	req := q.Ctx.Request
+	body, err := q.ReadBody()
+	if err != nil {
+		return nil, err
+	}
+	out := &templates.Request{
+		Method:  req.Method,
+		Path:    req.URL.Path,
+		Params:  make(map[string]string),
+		Query:   make(map[string]string),
+		Headers: make(map[string]string),
+		RawBody: string(body),
+	}
+	for k, v := range q.Params {
+		out.Params[k] = v
+	}
+	for k, v := range req.URL.Query() {
+		out.Query[k] = v[0]
+	}
+	for k, v := range req.Header {
+		out.Headers[k] = v[0]
+	}
+	if len(body) > 0 {
+		var i interface{}
+		if strings.Contains(strings.ToLower(req.Header.Get("Content-Type")), "yaml") {
+			err = yaml.Unmarshal(body, &i)
+		} else {
+			err = json.Unmarshal(body, &i)
+		}
+		// a body that doesn't parse is still there as RawBody.
+		if err == nil {
+			out.Body = StringKeys(i)
+		}
+	}
+	return out, nil
+}
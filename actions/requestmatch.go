@@ -0,0 +1,201 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var paramName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// PathPattern turns the url arg of a url action into a regular expression,
+// or returns nil if it's a plain path.  A url starting with ^ is a regular
+// expression already, and its named groups are the parameters.  Otherwise,
+// path segments written as :name or {name} match any one segment.
+func PathPattern(url string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(url, "^") {
+		return regexp.Compile(url)
+	}
+	if !strings.Contains(url, "/:") && !strings.Contains(url, "{") {
+		return nil, nil
+	}
+	segs := strings.Split(url, "/")
+	for i, seg := range segs {
+		name := ""
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			name = seg[1:]
+		case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}"):
+			name = seg[1 : len(seg)-1]
+		default:
+			segs[i] = regexp.QuoteMeta(seg)
+			continue
+		}
+		if !paramName.MatchString(name) {
+			return nil, fmt.Errorf("invalid parameter %q in %s", seg, url)
+		}
+		segs[i] = "(?P<" + name + ">[^/]+)"
+	}
+	return regexp.Compile("^" + strings.Join(segs, "/") + "$")
+}
+
+// MatchPath compares a request path with the url arg of a url action, and
+// returns any parameters captured from it.
+func MatchPath(url, path string) (bool, map[string]string, error) {
+	re, err := PathPattern(url)
+	if err != nil {
+		return false, nil, err
+	}
+	if re == nil {
+		return path == url, nil, nil
+	}
+	m := re.FindStringSubmatch(path)
+	if m == nil {
+		return false, nil, nil
+	}
+	params := make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			params[name] = m[i]
+		}
+	}
+	return true, params, nil
+}
+
+// ValueMatch is what a request header or query parameter has to look like.
+// In the args, a plain string is an exact match, and a map can have any of
+// value (exact), regex and present.  If more than one is given, they all
+// have to match.
+type ValueMatch struct {
+	Name    string
+	Value   *string
+	Regex   *regexp.Regexp
+	Present *bool // false means it must not be there at all
+}
+
+// LoadValueMatches reads the headers or query arg of a url action, sorted
+// by name so that failures are reported in the same order every time.
+func LoadValueMatches(i interface{}) ([]ValueMatch, error) {
+	m := make(map[string]interface{})
+	switch t := i.(type) {
+	case nil:
+		return nil, nil
+	case map[interface{}]interface{}:
+		for k, v := range t {
+			m[fmt.Sprint(k)] = v
+		}
+	case map[string]interface{}:
+		m = t
+	case map[string]string:
+		for k, v := range t {
+			m[k] = v
+		}
+	default:
+		return nil, errors.New("not a map")
+	}
+	out := make([]ValueMatch, 0, len(m))
+	for k, v := range m {
+		vm, err := loadValueMatch(k, v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		out = append(out, vm)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Name < out[b].Name })
+	return out, nil
+}
+
+func loadValueMatch(name string, v interface{}) (ValueMatch, error) {
+	vm := ValueMatch{Name: name}
+	spec := make(map[string]interface{})
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		for k, e := range t {
+			spec[fmt.Sprint(k)] = e
+		}
+	case map[string]interface{}:
+		spec = t
+	default:
+		s := fmt.Sprint(v)
+		vm.Value = &s
+		return vm, nil
+	}
+	for k, e := range spec {
+		switch k {
+		case "value":
+			s := fmt.Sprint(e)
+			vm.Value = &s
+		case "regex":
+			s, ok := e.(string)
+			if !ok {
+				return vm, errors.New("regex isn't a string")
+			}
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return vm, err
+			}
+			vm.Regex = re
+		case "present":
+			b, ok := e.(bool)
+			if !ok {
+				return vm, errors.New("present isn't a bool")
+			}
+			vm.Present = &b
+		default:
+			return vm, fmt.Errorf("unknown match %s", k)
+		}
+	}
+	return vm, nil
+}
+
+// Matches checks the values a request had under the name.  With more than
+// one value, any of them can match.
+func (m ValueMatch) Matches(values []string, found bool) bool {
+	if m.Present != nil && *m.Present != found {
+		return false
+	}
+	if m.Value == nil && m.Regex == nil {
+		return m.Present != nil || found
+	}
+	for _, v := range values {
+		if m.Value != nil && v != *m.Value {
+			continue
+		}
+		if m.Regex != nil && !m.Regex.MatchString(v) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// MatchHeaders checks a request's headers.  It returns the name of the first
+// header that didn't match, or "" if they all did.
+func MatchHeaders(matches []ValueMatch, h http.Header) string {
+	for _, m := range matches {
+		v, ok := h[http.CanonicalHeaderKey(m.Name)]
+		if !m.Matches(v, ok) {
+			return m.Name
+		}
+	}
+	return ""
+}
+
+// MatchQuery checks a request's query parameters, the same way.
+func MatchQuery(matches []ValueMatch, q map[string][]string) string {
+	for _, m := range matches {
+		v, ok := q[m.Name]
+		if !m.Matches(v, ok) {
+			return m.Name
+		}
+	}
+	return ""
+}
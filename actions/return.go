@@ -0,0 +1,92 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/juju/loggo"
+	"github.com/mohae/deepcopy"
+)
+
+type Return struct {
+	Action
+	Args ArgStruct
+}
+
+func (rt *Return) GetName() string {
+	return "return"
+}
+func (rt *Return) Abort() {
+	return
+}
+
+func (rt *Return) Execute(p *plan.Plan) (r ExecuteResult) {
+	logger := loggo.GetLogger("default")
+	logger.Tracef("Executing return action")
+
+	r.Complete = true
+
+	frame := p.State.CurrentFrame()
+	if frame == nil {
+		r.Err = errors.New("return without a call")
+		return
+	}
+
+	out := make(map[string]interface{})
+	for k, v := range frame.Outputs {
+		i, err := p.State.GetVariable(v)
+		if err != nil {
+			r.Err = fmt.Errorf("couldnt get output variable %s: %w", v, err)
+			return
+		}
+		out[k] = deepcopy.Copy(i)
+	}
+
+	p.State.CallStack = p.State.CallStack[:len(p.State.CallStack)-1]
+	if frame.Isolated {
+		p.State.Variables = frame.Variables
+	}
+	for k, v := range out {
+		delete(p.State.Variables, k)
+		err := p.State.SetVariable(k, v)
+		if err != nil {
+			r.Err = fmt.Errorf("couldnt set output variable %s: %w", k, err)
+			return
+		}
+	}
+
+	// pick the caller back up at the action after the call.
+	logger.Debugf("returning from plan %s to %s", frame.Plan, frame.ReturnTxn)
+	r.Advance = true
+	r.NewTxn = frame.ReturnTxn
+	r.Resume = true
+	r.ResumeIdx = frame.ReturnIdx + 1
+	r.Success = true
+	return
+}
+
+func (rt *Return) SetArgs(i map[string]interface{}) {
+	rt.Args.Args = i
+}
+
+func (rt *Return) Satisfy() (bool, error) {
+	return false, errors.New("cannot use satisfy_group for Return action: there are no conditions to satisfy")
+}
+
+func (rt *Return) GetContext() (*context.Context, *context.CancelFunc) {
+	return nil, nil
+}
+
+func (rt *Return) CanBackground() bool {
+	return false
+}
+
+func (rt *Return) IsBackgrounded() bool {
+	return false
+}
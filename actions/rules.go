@@ -0,0 +1,153 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"errors"
+	"fmt"
+	"github.com/homedepot/trainer/structs/state"
+	"github.com/homedepot/trainer/templates"
+	"net/http"
+	"strconv"
+)
+
+// ResponseRule is one of the rules of a url action.  The first rule whose
+// conditions all match the request picks the response, and a rule with no
+// conditions is the default.  Body conditions are keyed by a path into
+// the parsed body, such as card.number or items[0].sku.
+type ResponseRule struct {
+	Name       string
+	Body       []ValueMatch
+	Headers    []ValueMatch
+	Query      []ValueMatch
+	OnExpected interface{} // decoded over the transaction's on_expected
+}
+
+// IsDefault reports whether the rule matches every request.
+func (r ResponseRule) IsDefault() bool {
+	return len(r.Body) == 0 && len(r.Headers) == 0 && len(r.Query) == 0
+}
+
+// LoadResponseRules reads the rules arg of a url action.  Only the last
+// rule can be a default, since nothing after it would ever be used.
+func LoadResponseRules(i interface{}) ([]ResponseRule, error) {
+	if i == nil {
+		return nil, nil
+	}
+	l, ok := i.([]interface{})
+	if !ok {
+		return nil, errors.New("rules isn't a list")
+	}
+	out := make([]ResponseRule, 0, len(l))
+	for n, v := range l {
+		m, ok := StringKeys(v).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("rule %d isn't a map", n)
+		}
+		r, err := loadResponseRule(m)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", n, err)
+		}
+		if r.Name == "" {
+			r.Name = fmt.Sprint(n)
+		}
+		if r.IsDefault() && n != len(l)-1 {
+			return nil, fmt.Errorf("rule %s has no conditions, so it has to be the last", r.Name)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func loadResponseRule(m map[string]interface{}) (ResponseRule, error) {
+	var r ResponseRule
+	var err error
+	for k, v := range m {
+		switch k {
+		case "name":
+			r.Name = fmt.Sprint(v)
+		case "body":
+			r.Body, err = LoadValueMatches(v)
+		case "headers":
+			r.Headers, err = LoadValueMatches(v)
+		case "query":
+			r.Query, err = LoadValueMatches(v)
+		case "on_expected":
+			if _, ok := v.(map[string]interface{}); !ok {
+				return r, errors.New("on_expected isn't a map")
+			}
+			r.OnExpected = v
+		default:
+			return r, fmt.Errorf("unknown key %s", k)
+		}
+		if err != nil {
+			return r, fmt.Errorf("%s: %w", k, err)
+		}
+	}
+	return r, nil
+}
+
+// Matches checks a request against the rule.
+func (r ResponseRule) Matches(req *templates.Request, h http.Header, q map[string][]string) bool {
+	if MatchHeaders(r.Headers, h) != "" || MatchQuery(r.Query, q) != "" {
+		return false
+	}
+	for _, m := range r.Body {
+		var values []string
+		v, found := BodyValue(req.Body, m.Name)
+		if found {
+			values = []string{fmt.Sprint(v)}
+		}
+		if !m.Matches(values, found) {
+			return false
+		}
+	}
+	return true
+}
+
+// BodyValue looks up a path, like card.number or items[0].sku, in a parsed
+// request body.  Only maps and lists have anything in them, so a path into a
+// string or a number isn't found.
+func BodyValue(body interface{}, path string) (interface{}, bool) {
+	v := body
+	for _, e := range state.ParseString(path) {
+		switch c := v.(type) {
+		case map[string]interface{}:
+			k := e.Name
+			if k == "" {
+				k = strconv.Itoa(e.Index)
+			}
+			n, ok := c[k]
+			if !ok {
+				return nil, false
+			}
+			v = n
+		case []interface{}:
+			if e.Name != "" || e.Index < 0 || e.Index >= len(c) {
+				return nil, false
+			}
+			v = c[e.Index]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// MatchRule returns the first of the rules that matches the request, or nil
+// if none of them do.
+func MatchRule(rules []ResponseRule, ctx *QueueContext) (*ResponseRule, error) {
+	req, err := ctx.TemplateRequest()
+	if err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		if rules[i].Matches(req, ctx.Ctx.Request.Header, ctx.Ctx.Request.URL.Query()) {
+			return &rules[i], nil
+		}
+	}
+	return nil, nil
+}
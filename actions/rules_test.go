@@ -0,0 +1,136 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/state"
+)
+
+func TestLoadResponseRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		rules     interface{}
+		wantNames []string
+		wantErr   bool
+	}{
+		{name: "none"},
+		{
+			name: "named and numbered",
+			rules: []interface{}{
+				map[interface{}]interface{}{"name": "declined", "body": map[interface{}]interface{}{"card": map[interface{}]interface{}{"regex": "0002$"}}},
+				map[interface{}]interface{}{"headers": map[interface{}]interface{}{"X-Test": "1"}},
+				map[interface{}]interface{}{"on_expected": map[interface{}]interface{}{"response_code": "200"}},
+			},
+			wantNames: []string{"declined", "1", "2"},
+		},
+		{name: "not a list", rules: "declined", wantErr: true},
+		{name: "not a map", rules: []interface{}{"declined"}, wantErr: true},
+		{name: "unknown key", rules: []interface{}{map[interface{}]interface{}{"when": "always"}}, wantErr: true},
+		{
+			name:    "bad match",
+			rules:   []interface{}{map[interface{}]interface{}{"query": map[interface{}]interface{}{"a": map[interface{}]interface{}{"regex": "("}}}},
+			wantErr: true,
+		},
+		{name: "on_expected not a map", rules: []interface{}{map[interface{}]interface{}{"on_expected": "200"}}, wantErr: true},
+		{
+			name: "default before the end",
+			rules: []interface{}{
+				map[interface{}]interface{}{"name": "default"},
+				map[interface{}]interface{}{"query": map[interface{}]interface{}{"a": "1"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadResponseRules(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadResponseRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var names []string
+			for _, r := range got {
+				names = append(names, r.Name)
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("LoadResponseRules() names = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestURL_Rules(t *testing.T) {
+	rules := []interface{}{
+		map[interface{}]interface{}{
+			"name":        "declined",
+			"body":        map[interface{}]interface{}{"card.number": map[interface{}]interface{}{"regex": "0002$"}},
+			"on_expected": map[interface{}]interface{}{"response_code": "402"},
+		},
+		map[interface{}]interface{}{
+			"name":        "large",
+			"body":        map[interface{}]interface{}{"amount": "1000", "card.number": map[interface{}]interface{}{"present": true}},
+			"on_expected": map[interface{}]interface{}{"response_code": "202"},
+		},
+		map[interface{}]interface{}{
+			"name":        "test mode",
+			"headers":     map[interface{}]interface{}{"X-Test": "true"},
+			"query":       map[interface{}]interface{}{"dry_run": "1"},
+			"on_expected": map[interface{}]interface{}{"response_code": "204"},
+		},
+	}
+	withDefault := append(append([]interface{}{}, rules...),
+		map[interface{}]interface{}{"on_expected": map[interface{}]interface{}{"response_code": "200"}})
+	present := []interface{}{
+		map[interface{}]interface{}{
+			"name":        "has id",
+			"body":        map[interface{}]interface{}{"order.id": map[interface{}]interface{}{"present": true}},
+			"on_expected": map[interface{}]interface{}{"response_code": "201"},
+		},
+		map[interface{}]interface{}{"on_expected": map[interface{}]interface{}{"response_code": "200"}},
+	}
+	tests := []struct {
+		name    string
+		rules   []interface{}
+		target  string
+		headers map[string]string
+		body    string
+		want    string
+		success bool
+	}{
+		{name: "first rule", rules: rules, target: "/pay", body: `{"card": {"number": "4000000000000002"}, "amount": 1000}`, want: "402", success: true},
+		{name: "second rule", rules: rules, target: "/pay", body: `{"card": {"number": "4000000000000001"}, "amount": 1000}`, want: "202", success: true},
+		{name: "headers and query", rules: rules, target: "/pay?dry_run=1", headers: map[string]string{"X-Test": "true"}, body: "{}", want: "204", success: true},
+		{name: "no rule", rules: rules, target: "/pay", body: `{"amount": 5}`},
+		{name: "body that isn't json", rules: rules, target: "/pay", body: "amount=1000"},
+		{name: "default", rules: withDefault, target: "/pay", body: `{"amount": 5}`, want: "200", success: true},
+		{name: "present", rules: present, target: "/pay", body: `{"order": {"id": 7}}`, want: "201", success: true},
+		{name: "present in a text body", rules: present, target: "/pay", body: `"hello"`, want: "200", success: true},
+		{name: "present in a number body", rules: present, target: "/pay", body: `42`, want: "200", success: true},
+		{name: "present under a string", rules: present, target: "/pay", body: `{"order": "hello"}`, want: "200", success: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &plan.Plan{State: state.NewState("a")}
+			u := &URL{}
+			u.SetArgs(map[string]interface{}{"url": "/pay", "rules": tt.rules,
+				"_context": testRequest("POST", tt.target, tt.headers, tt.body)})
+			r := u.Execute(p)
+			if !r.Complete || r.Success != tt.success || r.Err != nil {
+				t.Fatalf("Execute() = %+v, want success %v", r, tt.success)
+			}
+			if !tt.success {
+				return
+			}
+			oe, _ := r.OnExpected.(map[string]interface{})
+			if oe["response_code"] != tt.want {
+				t.Errorf("on_expected = %v, want response_code %s", r.OnExpected, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"errors"
+	"fmt"
+)
+
+// How a url action's responses carry on once they've all been sent.
+const (
+	SequenceSticky = "sticky" // keep sending the last one
+	SequenceCyclic = "cyclic" // start over from the first one
+)
+
+// LoadResponses reads the responses arg of a url action, each of which is
+// an on_expected override.
+func LoadResponses(i interface{}) ([]interface{}, error) {
+	l, ok := i.([]interface{})
+	if !ok {
+		return nil, errors.New("responses isn't a list")
+	}
+	if len(l) == 0 {
+		return nil, errors.New("responses is empty")
+	}
+	out := make([]interface{}, 0, len(l))
+	for n, v := range l {
+		m, ok := StringKeys(v).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("response %d isn't a map", n)
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// SequenceIndex picks the response for the nth call (counting from 1) out
+// of count responses, and says whether it's the last one in the sequence,
+// which is the only one that lets the transaction move on.
+func SequenceIndex(n int, count int, mode string) (int, bool, error) {
+	switch mode {
+	case "", SequenceSticky:
+		if n >= count {
+			return count - 1, true, nil
+		}
+		return n - 1, false, nil
+	case SequenceCyclic:
+		i := (n - 1) % count
+		return i, i == count-1, nil
+	default:
+		return 0, false, fmt.Errorf("unknown sequence %s", mode)
+	}
+}
+
+// CallKey is what calls to a url action are counted under: the transaction,
+// the action's place in it, and the method and url, like
+// "checkout[0] POST /orders".
+func CallKey(txn string, idx int, method string, url string) string {
+	k := fmt.Sprintf("%s[%d] ", txn, idx)
+	if method == "" {
+		return k + url
+	}
+	return k + method + " " + url
+}
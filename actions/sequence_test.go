@@ -0,0 +1,111 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"testing"
+
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/state"
+)
+
+func TestSequenceIndex(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		calls     int
+		wantIdx   []int
+		wantFinal []bool
+		wantErr   bool
+	}{
+		{
+			name: "sticky", calls: 5,
+			wantIdx:   []int{0, 1, 2, 2, 2},
+			wantFinal: []bool{false, false, true, true, true},
+		},
+		{
+			name: "cyclic", mode: SequenceCyclic, calls: 5,
+			wantIdx:   []int{0, 1, 2, 0, 1},
+			wantFinal: []bool{false, false, true, false, false},
+		},
+		{name: "unknown", mode: "random", calls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for n := 1; n <= tt.calls; n++ {
+				i, final, err := SequenceIndex(n, 3, tt.mode)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("SequenceIndex() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if tt.wantErr {
+					return
+				}
+				if i != tt.wantIdx[n-1] || final != tt.wantFinal[n-1] {
+					t.Errorf("call %d: SequenceIndex() = %d, %v, want %d, %v", n, i, final, tt.wantIdx[n-1], tt.wantFinal[n-1])
+				}
+			}
+		})
+	}
+}
+
+func TestURL_Sequence(t *testing.T) {
+	responses := []interface{}{
+		map[interface{}]interface{}{"response_code": "503"},
+		map[interface{}]interface{}{"response_code": "200"},
+	}
+	p := &plan.Plan{State: state.NewState("a")}
+	want := []struct {
+		code   string
+		repeat bool
+	}{{"503", true}, {"200", false}, {"200", false}}
+	for n, w := range want {
+		u := &URL{}
+		u.SetArgs(map[string]interface{}{"url": "/orders", "method": "post", "responses": responses, "save_count": "calls",
+			"_context": testRequest("POST", "/orders", nil, "")})
+		r := u.Execute(p)
+		if !r.Success || r.Err != nil {
+			t.Fatalf("call %d: Execute() = %+v, want success", n+1, r)
+		}
+		oe, _ := r.OnExpected.(map[string]interface{})
+		if oe["response_code"] != w.code || r.Repeat != w.repeat {
+			t.Errorf("call %d: got %v, repeat %v, want %s, repeat %v", n+1, oe["response_code"], r.Repeat, w.code, w.repeat)
+		}
+		if p.State.Variables["calls"] != n+1 {
+			t.Errorf("call %d: calls = %v", n+1, p.State.Variables["calls"])
+		}
+	}
+	if c := p.State.Calls["a[0] POST /orders"]; c != 3 {
+		t.Errorf("Calls = %v, want 3 for a[0] POST /orders", p.State.Calls)
+	}
+
+	// another action for the same url is counted on its own.
+	p.State.TxnActionIdx = 1
+	u := &URL{}
+	u.SetArgs(map[string]interface{}{"url": "/orders", "method": "post", "save_count": "calls",
+		"_context": testRequest("POST", "/orders", nil, "")})
+	u.Execute(p)
+	if p.State.Variables["calls"] != 1 || p.State.Calls["a[0] POST /orders"] != 3 {
+		t.Errorf("calls = %v, Calls = %v, want the second action counted on its own", p.State.Variables["calls"], p.State.Calls)
+	}
+
+	// and entering the transaction again starts the counts over.
+	p.State.NewState("b")
+	p.State.NewState("a")
+	u = &URL{}
+	u.SetArgs(map[string]interface{}{"url": "/orders", "method": "post", "responses": responses,
+		"_context": testRequest("POST", "/orders", nil, "")})
+	r := u.Execute(p)
+	if oe, _ := r.OnExpected.(map[string]interface{}); oe["response_code"] != "503" || p.State.Calls["a[0] POST /orders"] != 1 {
+		t.Errorf("after entering again got %v, Calls = %v, want the first response", r.OnExpected, p.State.Calls)
+	}
+
+	u = &URL{}
+	u.SetArgs(map[string]interface{}{"url": "/orders", "responses": responses, "rules": []interface{}{},
+		"_context": testRequest("POST", "/orders", nil, "")})
+	if r := u.Execute(p); r.Err == nil {
+		t.Errorf("Execute() = %+v, want an error for rules and responses", r)
+	}
+}
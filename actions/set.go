@@ -8,8 +8,10 @@ package actions
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/homedepot/trainer/structs/plan"
 	"github.com/juju/loggo"
+	"github.com/mohae/deepcopy"
 	"reflect"
 )
 
@@ -19,7 +21,7 @@ type Set struct {
 }
 
 func (s *Set) GetName() string {
-	return "wait"
+	return "set"
 }
 func (s *Set) Abort() {
 	return
@@ -31,67 +33,96 @@ func (s *Set) Execute(p *plan.Plan) (r ExecuteResult) {
 
 	r.Complete = true
 
-	variable, err := s.Args.GetArg("variable", reflect.TypeOf(""), true)
+	args := s.Args
+
+	variable, err := args.GetArg("variable", reflect.TypeOf(""), true)
 	if err != nil {
 		logger.Warningf("couldn't get variable: %s", err)
 		r.Err = err
 		return
 	}
 
-	source, ok1 := s.Args.Args["source"]
-	value, ok2 := s.Args.Args["value"]
+	operation, err := args.GetArg("operation", reflect.TypeOf(""), false)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	if operation == nil || operation.(string) == "" {
+		operation = "set"
+	}
 
-	if ok1 && source.(string) != "" {
-		v, err := p.State.GetVariable(source.(string))
+	if operation.(string) == "delete" {
+		err = p.State.DeleteVariable(variable.(string))
 		if err != nil {
-			logger.Warningf("couldn't get variable %s: err", source.(string), err)
 			r.Err = err
 			return
 		}
-		if reflect.TypeOf(v).String() == "string" {
-			err = p.State.SetVariable(variable.(string), v.(string))
-			if err != nil {
-				r.Err = err
-				return
-			}
-		} else if reflect.TypeOf(v).String() == "int" {
-			err = p.State.SetVariable(variable.(string), v.(int))
-			if err != nil {
-				r.Err = err
-			}
-		} else if reflect.TypeOf(v).String() == "float64" {
-			err = p.State.SetVariable(variable.(string), v.(float64))
-			if err != nil {
-				r.Err = err
-				return
-			}
-		} else if reflect.TypeOf(v).String() == "float32" {
-			err = p.State.SetVariable(variable.(string), v.(float32))
-			if err != nil {
-				r.Err = err
-				return
-			}
-		} else if reflect.TypeOf(v).String() == "bool" {
-			err = p.State.SetVariable(variable.(string), v.(bool))
-			if err != nil {
-				r.Err = err
-				return
-			}
+		r.Success = true
+		return
+	}
+
+	source := ""
+	if sa, ok := args.Args["source"]; ok && sa != nil {
+		sv, ok := sa.(string)
+		if !ok {
+			r.Err = fmt.Errorf("source must be a variable name, not %T", sa)
+			return
 		}
-	} else if ok2 {
-		err := p.State.SetVariable(variable.(string), value)
+		source = sv
+	}
+	value, ok2 := args.Args["value"]
+
+	var v interface{}
+	if source != "" {
+		sv, err := p.State.GetVariable(source)
 		if err != nil {
+			logger.Warningf("couldn't get variable %s: %s", source, err)
 			r.Err = err
 			return
 		}
+		// copy maps and arrays, otherwise changing one variable later changes both.
+		v = deepcopy.Copy(sv)
+	} else if ok2 {
+		v = StringKeys(value)
 	} else {
 		r.Err = errors.New("value or source not defined")
 		return
 	}
+
+	switch operation.(string) {
+	case "set":
+		err = p.State.SetVariable(variable.(string), v)
+	case "append":
+		err = s.Append(p, variable.(string), v)
+	default:
+		err = fmt.Errorf("invalid set operation %s", operation.(string))
+	}
+	if err != nil {
+		r.Err = err
+		return
+	}
 	r.Success = true
 	return
 }
 
+// Append adds v to the end of the array variable, creating the array if
+// the variable doesn't exist yet.
+func (s *Set) Append(p *plan.Plan, variable string, v interface{}) error {
+	logger := loggo.GetLogger("default")
+	l := make([]interface{}, 0)
+	existing, err := p.State.GetVariable(variable)
+	if err != nil {
+		logger.Debugf("couldn't get variable %s, creating: %s", variable, err)
+	} else if existing != nil {
+		el, ok := existing.([]interface{})
+		if !ok {
+			return fmt.Errorf("cannot append to %s: not an array", variable)
+		}
+		l = el
+	}
+	return p.State.SetVariable(variable, append(l, v))
+}
+
 func (s *Set) SetArgs(i map[string]interface{}) {
 	s.Args.Args = i
 }
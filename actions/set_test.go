@@ -0,0 +1,110 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/state"
+	"reflect"
+	"testing"
+)
+
+func TestSet_Execute(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      map[string]interface{}
+		variables map[string]interface{}
+		want      map[string]interface{}
+		wantErr   bool
+	}{
+		{
+			name:      "copy map from source",
+			args:      map[string]interface{}{"variable": "copy", "source": "orig"},
+			variables: map[string]interface{}{"orig": map[string]interface{}{"a": "b"}},
+			want: map[string]interface{}{
+				"orig": map[string]interface{}{"a": "b"},
+				"copy": map[string]interface{}{"a": "b"},
+			},
+		},
+		{
+			name:      "yaml map value",
+			args:      map[string]interface{}{"variable": "m", "value": map[interface{}]interface{}{"a": 1}},
+			variables: map[string]interface{}{},
+			want:      map[string]interface{}{"m": map[string]interface{}{"a": 1}},
+		},
+		{
+			name:      "append creates array",
+			args:      map[string]interface{}{"variable": "ids", "operation": "append", "value": "1"},
+			variables: map[string]interface{}{},
+			want:      map[string]interface{}{"ids": []interface{}{"1"}},
+		},
+		{
+			name:      "append from source",
+			args:      map[string]interface{}{"variable": "ids", "operation": "append", "source": "id"},
+			variables: map[string]interface{}{"ids": []interface{}{"1"}, "id": "2"},
+			want:      map[string]interface{}{"ids": []interface{}{"1", "2"}, "id": "2"},
+		},
+		{
+			name:      "append to a string",
+			args:      map[string]interface{}{"variable": "ids", "operation": "append", "value": "1"},
+			variables: map[string]interface{}{"ids": "1"},
+			wantErr:   true,
+		},
+		{
+			name:      "insert key",
+			args:      map[string]interface{}{"variable": "orders.x1", "value": true},
+			variables: map[string]interface{}{"orders": map[string]interface{}{}},
+			want:      map[string]interface{}{"orders": map[string]interface{}{"x1": true}},
+		},
+		{
+			name:      "values aren't templated",
+			args:      map[string]interface{}{"variable": "v", "value": "<<.Variables.id>>"},
+			variables: map[string]interface{}{"id": "x1"},
+			want:      map[string]interface{}{"id": "x1", "v": "<<.Variables.id>>"},
+		},
+		{
+			name:      "delete",
+			args:      map[string]interface{}{"variable": "orders.x1", "operation": "delete"},
+			variables: map[string]interface{}{"orders": map[string]interface{}{"x1": true}},
+			want:      map[string]interface{}{"orders": map[string]interface{}{}},
+		},
+		{
+			name:      "source isn't a string",
+			args:      map[string]interface{}{"variable": "a", "source": 5},
+			variables: map[string]interface{}{},
+			wantErr:   true,
+		},
+		{
+			name:      "invalid operation",
+			args:      map[string]interface{}{"variable": "a", "operation": "frobnicate", "value": 1},
+			variables: map[string]interface{}{},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Set{
+				Args: ArgStruct{Args: tt.args},
+			}
+			p := &plan.Plan{State: &state.State{Variables: tt.variables}}
+			r := s.Execute(p)
+			if (r.Err != nil) != tt.wantErr {
+				t.Errorf("Execute() error = %v, wantErr %v", r.Err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(p.State.Variables, tt.want) {
+				t.Errorf("Execute() got = %v, want %v", p.State.Variables, tt.want)
+			}
+		})
+	}
+}
+
+func TestSet_GetName(t *testing.T) {
+	s := &Set{}
+	if got := s.GetName(); got != "set" {
+		t.Errorf("GetName() = %v, want %v", got, "set")
+	}
+}
@@ -0,0 +1,413 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/homedepot/trainer/structs/database"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/juju/loggo"
+	"gopkg.in/yaml.v2"
+	"strconv"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite" // the sqlite driver, so queries can be tested locally
+)
+
+// DefaultSQLTimeout is how long a query gets, unless told otherwise.
+const DefaultSQLTimeout = 30 * time.Second
+
+// databases are the ones named in the config, and the connections that have
+// been opened, by driver and dsn.
+var databases = struct {
+	sync.Mutex
+	named map[string]database.Database
+	open  map[string]*sql.DB
+}{named: make(map[string]database.Database), open: make(map[string]*sql.DB)}
+
+// RegisterDatabase makes a database available to the sql action by name.
+func RegisterDatabase(name string, d database.Database) error {
+	if err := checkDatabase(name, d); err != nil {
+		return err
+	}
+	databases.Lock()
+	defer databases.Unlock()
+	if _, ok := databases.named[name]; ok {
+		return fmt.Errorf("database %s is already registered", name)
+	}
+	databases.named[name] = d
+	return nil
+}
+
+func checkDatabase(name string, d database.Database) error {
+	if d.Driver == "" || d.DSN == "" {
+		return fmt.Errorf("database %s needs a driver and a dsn", name)
+	}
+	return nil
+}
+
+// OpenDatabase returns a connection pool for a driver and dsn, opening it
+// the first time.
+func OpenDatabase(driver, dsn string) (*sql.DB, error) {
+	databases.Lock()
+	defer databases.Unlock()
+	k := driver + "\x00" + dsn
+	if db, ok := databases.open[k]; ok {
+		return db, nil
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	databases.open[k] = db
+	return db, nil
+}
+
+// CloseDatabases closes every connection pool that's been opened.
+func CloseDatabases() {
+	logger := loggo.GetLogger("default")
+	databases.Lock()
+	defer databases.Unlock()
+	for k, db := range databases.open {
+		if err := db.Close(); err != nil {
+			logger.Warningf("closing database: %s", err)
+		}
+		delete(databases.open, k)
+	}
+}
+
+type SQL struct {
+	Action
+	Args ArgStruct
+}
+
+func (s *SQL) GetName() string {
+	return "sql"
+}
+func (s *SQL) Abort() {
+	return
+}
+
+func (s *SQL) Execute(p *plan.Plan) (r ExecuteResult) {
+	logger := loggo.GetLogger("default")
+	logger.Tracef("Executing sql action")
+
+	r.Complete = true
+
+	args, err := ParseTemplate(p, s.Args.Args)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	db, err := s.DB(args)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	query, err := s.Query(p, args)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	params, err := s.Params(p, args)
+	if err != nil {
+		r.Err = err
+		return
+	}
+
+	timeout := DefaultSQLTimeout
+	if t, ok := args["timeout"]; ok {
+		timeout, err = ParseDuration(t)
+		if err != nil {
+			r.Err = fmt.Errorf("timeout: %w", err)
+			return
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var rows []interface{}
+	var count int
+	mode, _ := args["mode"].(string)
+	switch mode {
+	case "", "query":
+		rows, err = QueryRows(ctx, db, query, params...)
+		if err != nil {
+			r.Err = fmt.Errorf("query: %w", err)
+			return
+		}
+		count = len(rows)
+	case "exec":
+		res, err := db.ExecContext(ctx, query, params...)
+		if err != nil {
+			r.Err = fmt.Errorf("exec: %w", err)
+			return
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			r.Err = fmt.Errorf("exec: %w", err)
+			return
+		}
+		count = int(n)
+	default:
+		r.Err = fmt.Errorf("unknown mode %s", mode)
+		return
+	}
+	logger.Debugf("sql returned %d rows", count)
+
+	if v, ok := args["save_rows"].(string); ok && v != "" {
+		if err := p.State.SetVariable(v, rows); err != nil {
+			r.Err = fmt.Errorf("save_rows: %w", err)
+			return
+		}
+	}
+	if v, ok := args["save_count"].(string); ok && v != "" {
+		if err := p.State.SetVariable(v, count); err != nil {
+			r.Err = fmt.Errorf("save_count: %w", err)
+			return
+		}
+	}
+
+	result, checked, err := s.Check(p, args, count, rows)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	if !checked {
+		r.Success = true
+		return
+	}
+	r.Success = result
+	advance := "advance_true"
+	if !result {
+		advance = "advance_false"
+	}
+	txn, ok := args[advance].(string)
+	if !ok || txn == "" {
+		if !result {
+			r.Err = errors.New("sql check failed, and advance_false not set")
+		}
+		return
+	}
+	r.Advance = true
+	r.NewTxn = txn
+	return
+}
+
+// DB returns the connection pool for the database or driver and dsn args.
+func (s *SQL) DB(args map[string]interface{}) (*sql.DB, error) {
+	name, _ := args["database"].(string)
+	driver, _ := args["driver"].(string)
+	dsn, _ := args["dsn"].(string)
+	if name != "" {
+		if driver != "" || dsn != "" {
+			return nil, errors.New("only one of database and driver/dsn can be set")
+		}
+		databases.Lock()
+		d, ok := databases.named[name]
+		databases.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown database %s", name)
+		}
+		driver, dsn = d.Driver, d.DSN
+	}
+	if driver == "" || dsn == "" {
+		return nil, errors.New("database, or driver and dsn, not set")
+	}
+	return OpenDatabase(driver, dsn)
+}
+
+// Query returns the query or the contents of query_file, templated.
+func (s *SQL) Query(p *plan.Plan, args map[string]interface{}) (string, error) {
+	query, hasQuery := args["query"].(string)
+	file, hasFile := args["query_file"].(string)
+	switch {
+	case hasQuery && hasFile:
+		return "", errors.New("only one of query and query_file can be set")
+	case hasFile:
+		q, err := ReadTemplateFile(p, file)
+		if err != nil {
+			return "", fmt.Errorf("query_file: %w", err)
+		}
+		return q, nil
+	case !hasQuery || query == "":
+		return "", errors.New("query or query_file not set")
+	}
+	return query, nil
+}
+
+// Params returns the query parameters.  Strings in the list are templated.
+func (s *SQL) Params(p *plan.Plan, args map[string]interface{}) ([]interface{}, error) {
+	out := make([]interface{}, 0)
+	switch l := args["params"].(type) {
+	case nil:
+	case []interface{}:
+		for i, v := range l {
+			if str, ok := v.(string); ok {
+				res, err := ParseStringTemplate(p, str)
+				if err != nil {
+					return nil, fmt.Errorf("params %d: %w", i, err)
+				}
+				v = res
+			}
+			out = append(out, v)
+		}
+	default:
+		return nil, errors.New("params is not a list")
+	}
+	return out, nil
+}
+
+// Check compares the results with the count and match_file args.  checked
+// is false if neither was given.
+func (s *SQL) Check(p *plan.Plan, args map[string]interface{}, count int, rows []interface{}) (result bool, checked bool, err error) {
+	result = true
+	if want, ok := args["count"]; ok {
+		checked = true
+		if str, ok := want.(string); ok {
+			want, err = strconv.Atoi(str)
+			if err != nil {
+				return false, true, fmt.Errorf("count: %w", err)
+			}
+		}
+		ops := NewConditionalOps()
+		ops.LeftOp = count
+		ops.RightOp = want
+		conditional, _ := args["conditional"].(string)
+		if conditional == "" {
+			conditional = "eq"
+		}
+		res, err := ops.Compare(conditional)
+		if err != nil {
+			return false, true, fmt.Errorf("count: %w", err)
+		}
+		result = result && res
+	}
+	if mf, ok := args["match_file"].(string); ok && mf != "" {
+		checked = true
+		mft, _ := args["match_file_type"].(string)
+		if mft == "" {
+			mft = "json"
+		}
+		str, err := ReadTemplateFile(p, mf)
+		if err != nil {
+			return false, true, err
+		}
+		expected, err := (&Match{}).LoadString(str, mft)
+		if err != nil {
+			return false, true, fmt.Errorf("match_file: %w", err)
+		}
+		actual, err := NormalizeRows(rows, mft)
+		if err != nil {
+			return false, true, err
+		}
+		// every row in the file has to be there, in order.  Extra rows are
+		// fine, the same as extra keys.
+		if l, ok := expected.([]interface{}); ok && len(l) > len(rows) {
+			result = false
+		} else {
+			result = result && MatchingInterfaces(StringKeys(expected), actual)
+		}
+	}
+	return result, checked, nil
+}
+
+// QueryRows runs a query and returns the rows as a list of maps, keyed by
+// column name.
+func QueryRows(ctx context.Context, db *sql.DB, query string, params ...interface{}) ([]interface{}, error) {
+	rs, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	cols, err := rs.Columns()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, 0)
+	for rs.Next() {
+		vals := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rs.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(cols))
+		for i, c := range cols {
+			row[c] = columnValue(vals[i])
+		}
+		out = append(out, row)
+	}
+	return out, rs.Err()
+}
+
+// columnValue converts what the driver returns into the types the rest of
+// trainer works with.
+func columnValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case []byte:
+		return string(t)
+	case int64:
+		return int(t)
+	case int32:
+		return int(t)
+	case float32:
+		return float64(t)
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+// NormalizeRows round trips the rows through json or yaml, so that they have
+// the same types as a match file of that type.
+func NormalizeRows(rows []interface{}, t string) (interface{}, error) {
+	var b []byte
+	var err error
+	switch t {
+	case "json":
+		b, err = json.Marshal(rows)
+	case "yaml":
+		b, err = yaml.Marshal(rows)
+	default:
+		return nil, fmt.Errorf("invalid match file type %s", t)
+	}
+	if err != nil {
+		return nil, err
+	}
+	i, err := (&Match{}).LoadString(string(b), t)
+	if err != nil {
+		return nil, err
+	}
+	return StringKeys(i), nil
+}
+
+func (s *SQL) SetArgs(i map[string]interface{}) {
+	s.Args.Args = i
+}
+
+func (s *SQL) Satisfy() (bool, error) {
+	return false, errors.New("cannot use satisfy_group for SQL action: there are no conditions to satisfy")
+}
+
+func (s *SQL) GetContext() (*context.Context, *context.CancelFunc) {
+	return nil, nil
+}
+
+func (s *SQL) CanBackground() bool {
+	return false
+}
+
+func (s *SQL) IsBackgrounded() bool {
+	return false
+}
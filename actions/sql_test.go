@@ -0,0 +1,213 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"github.com/homedepot/trainer/structs/database"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/state"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// sqlPlan makes a plan with an orders table to query.
+func sqlPlan(t *testing.T) (*plan.Plan, string) {
+	dsn := filepath.Join(t.TempDir(), "orders.db")
+	p := &plan.Plan{State: state.NewState("a"), Bases: map[string]string{"orders_db": dsn}}
+	p.State.Variables["customer"] = "bob"
+	for _, q := range []map[string]interface{}{
+		{"query": "create table orders (id integer, customer text, total real, note text)"},
+		{"query": "insert into orders values (1, 'bob', 9.5, null), (2, 'bob', 20, 'gift'), (3, 'alice', 5, null)"},
+	} {
+		q["driver"] = "sqlite"
+		q["dsn"] = "<<.Bases.orders_db>>"
+		q["mode"] = "exec"
+		s := &SQL{}
+		s.SetArgs(q)
+		if r := s.Execute(p); r.Err != nil {
+			t.Fatalf("setting up: %v", r.Err)
+		}
+	}
+	return p, dsn
+}
+
+func TestSQL_Execute(t *testing.T) {
+	dir := t.TempDir()
+	jsonfile := filepath.Join(dir, "expected.json")
+	os.WriteFile(jsonfile, []byte(`[{"id": 1, "customer": "<<.Variables.customer>>"}, {"id": 2, "total": 20}]`), 0644)
+	yamlfile := filepath.Join(dir, "expected.yaml")
+	os.WriteFile(yamlfile, []byte("- id: 1\n  total: 9.5\n"), 0644)
+	wrongfile := filepath.Join(dir, "wrong.json")
+	os.WriteFile(wrongfile, []byte(`[{"id": 1, "customer": "alice"}]`), 0644)
+	queryfile := filepath.Join(dir, "query.sql")
+	os.WriteFile(queryfile, []byte(`select id from orders where customer = '<<.Variables.customer>>' order by id`), 0644)
+
+	bob := "select id, customer, total from orders where customer = ? order by id"
+	tests := []struct {
+		name     string
+		args     map[string]interface{}
+		wantErr  bool
+		success  bool
+		advance  string
+		wantVars map[string]interface{}
+	}{
+		{
+			name: "save rows",
+			args: map[string]interface{}{"query": bob, "params": []interface{}{"<<.Variables.customer>>"}, "save_rows": "rows", "save_count": "n"},
+			wantVars: map[string]interface{}{
+				"rows": []interface{}{
+					map[string]interface{}{"id": 1, "customer": "bob", "total": 9.5},
+					map[string]interface{}{"id": 2, "customer": "bob", "total": 20.0},
+				},
+				"n": 2,
+			},
+			success: true,
+		},
+		{
+			name:     "query file",
+			args:     map[string]interface{}{"query_file": queryfile, "save_count": "n"},
+			wantVars: map[string]interface{}{"n": 2},
+			success:  true,
+		},
+		{
+			name:     "null column",
+			args:     map[string]interface{}{"query": "select note from orders where id = 1", "save_rows": "rows"},
+			wantVars: map[string]interface{}{"rows": []interface{}{map[string]interface{}{"note": nil}}},
+			success:  true,
+		},
+		{
+			name:    "count true",
+			args:    map[string]interface{}{"query": bob, "params": []interface{}{"bob"}, "count": 2, "advance_true": "yes", "advance_false": "no"},
+			success: true,
+			advance: "yes",
+		},
+		{
+			name:    "count false",
+			args:    map[string]interface{}{"query": bob, "params": []interface{}{"bob"}, "count": "1", "conditional": "le", "advance_true": "yes", "advance_false": "no"},
+			advance: "no",
+		},
+		{
+			name:    "count false without advance",
+			args:    map[string]interface{}{"query": bob, "params": []interface{}{"nobody"}, "count": 1},
+			wantErr: true,
+		},
+		{
+			name:    "count true without advance",
+			args:    map[string]interface{}{"query": bob, "params": []interface{}{"nobody"}, "count": 0},
+			success: true,
+		},
+		{
+			name:    "match json",
+			args:    map[string]interface{}{"query": bob, "params": []interface{}{"bob"}, "match_file": jsonfile, "advance_true": "yes"},
+			success: true,
+			advance: "yes",
+		},
+		{
+			name:    "match yaml",
+			args:    map[string]interface{}{"query": bob, "params": []interface{}{"bob"}, "match_file": yamlfile, "match_file_type": "yaml", "advance_true": "yes"},
+			success: true,
+			advance: "yes",
+		},
+		{
+			name:    "no match",
+			args:    map[string]interface{}{"query": bob, "params": []interface{}{"bob"}, "match_file": wrongfile, "advance_true": "yes", "advance_false": "no"},
+			advance: "no",
+		},
+		{
+			name:    "fewer rows than the match file",
+			args:    map[string]interface{}{"query": bob, "params": []interface{}{"alice"}, "match_file": jsonfile, "advance_false": "no"},
+			advance: "no",
+		},
+		{
+			name:     "exec",
+			args:     map[string]interface{}{"query": "update orders set note = 'x' where customer = ?", "params": []interface{}{"bob"}, "mode": "exec", "save_count": "n"},
+			wantVars: map[string]interface{}{"n": 2},
+			success:  true,
+		},
+		{
+			name:    "bad query",
+			args:    map[string]interface{}{"query": "select nothing from nowhere"},
+			wantErr: true,
+		},
+		{
+			name:    "no query",
+			args:    map[string]interface{}{},
+			wantErr: true,
+		},
+		{
+			name:    "bad mode",
+			args:    map[string]interface{}{"query": bob, "mode": "explode"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := sqlPlan(t)
+			args := map[string]interface{}{"driver": "sqlite", "dsn": "<<.Bases.orders_db>>"}
+			for k, v := range tt.args {
+				args[k] = v
+			}
+			s := &SQL{}
+			s.SetArgs(args)
+			r := s.Execute(p)
+			if (r.Err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", r.Err, tt.wantErr)
+			}
+			if !r.Complete {
+				t.Errorf("Execute() complete = false")
+			}
+			if r.Success != tt.success {
+				t.Errorf("Execute() success = %v, want %v", r.Success, tt.success)
+			}
+			if r.NewTxn != tt.advance || r.Advance != (tt.advance != "") {
+				t.Errorf("Execute() advance = %v %s, want %s", r.Advance, r.NewTxn, tt.advance)
+			}
+			for k, v := range tt.wantVars {
+				if !reflect.DeepEqual(p.State.Variables[k], v) {
+					t.Errorf("variable %s = %#v, want %#v", k, p.State.Variables[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestSQL_Database(t *testing.T) {
+	p, dsn := sqlPlan(t)
+	if err := RegisterDatabase("sql_test", database.Database{Driver: "sqlite", DSN: dsn}); err != nil {
+		t.Fatalf("RegisterDatabase() error = %v", err)
+	}
+	if err := RegisterDatabase("sql_test", database.Database{Driver: "sqlite", DSN: dsn}); err == nil {
+		t.Errorf("RegisterDatabase() expected error for a duplicate")
+	}
+	if err := RegisterDatabase("sql_test_nodsn", database.Database{Driver: "sqlite"}); err == nil {
+		t.Errorf("RegisterDatabase() expected error without a dsn")
+	}
+
+	s := &SQL{}
+	s.SetArgs(map[string]interface{}{"database": "sql_test", "query": "select count(*) as n from orders", "save_rows": "rows"})
+	r := s.Execute(p)
+	if r.Err != nil {
+		t.Fatalf("Execute() error = %v", r.Err)
+	}
+	want := []interface{}{map[string]interface{}{"n": 3}}
+	if !reflect.DeepEqual(p.State.Variables["rows"], want) {
+		t.Errorf("rows = %#v, want %#v", p.State.Variables["rows"], want)
+	}
+
+	for _, args := range []map[string]interface{}{
+		{"database": "nope", "query": "select 1"},
+		{"database": "sql_test", "driver": "sqlite", "query": "select 1"},
+		{"query": "select 1"},
+	} {
+		s := &SQL{}
+		s.SetArgs(args)
+		if r := s.Execute(p); r.Err == nil {
+			t.Errorf("Execute(%v) expected error", args)
+		}
+	}
+}
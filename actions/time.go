@@ -0,0 +1,199 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/templates"
+	"github.com/juju/loggo"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+type Time struct {
+	Action
+	Args ArgStruct
+}
+
+func (t *Time) GetName() string {
+	return "time"
+}
+func (t *Time) Abort() {
+	return
+}
+
+func (t *Time) Execute(p *plan.Plan) (r ExecuteResult) {
+	logger := loggo.GetLogger("default")
+	logger.Tracef("Executing time action")
+
+	r.Complete = true
+
+	args, err := ParseTemplate(p, t.Args.Args)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	a := ArgStruct{Args: args}
+
+	operation := "set"
+	if o, ok := args["operation"].(string); ok && o != "" {
+		operation = o
+	}
+
+	tm, err := t.Resolve(p, a, "source", "value")
+	if err != nil {
+		r.Err = err
+		return
+	}
+	if offset, ok := args["offset"].(string); ok && offset != "" {
+		d, err := templates.ParseOffset(offset)
+		if err != nil {
+			r.Err = fmt.Errorf("offset: %w", err)
+			return
+		}
+		tm = tm.Add(d)
+	}
+	if zone, ok := args["zone"].(string); ok && zone != "" {
+		tm, err = templates.InZone(zone, tm)
+		if err != nil {
+			r.Err = fmt.Errorf("zone: %w", err)
+			return
+		}
+	}
+
+	switch operation {
+	case "set":
+		variable, err := a.GetArg("variable", reflect.TypeOf(""), true)
+		if err != nil {
+			r.Err = fmt.Errorf("couldnt get variable: %w", err)
+			return
+		}
+		format := "rfc3339"
+		if f, ok := args["format"].(string); ok && f != "" {
+			format = f
+		}
+		var v interface{}
+		switch format {
+		case "epoch":
+			v = int(tm.Unix())
+		case "epoch_millis":
+			v = int(tm.UnixMilli())
+		default:
+			v, _ = templates.FormatTime(format, tm)
+		}
+		logger.Debugf("setting %s to %v", variable.(string), v)
+		delete(p.State.Variables, variable.(string))
+		err = p.State.SetVariable(variable.(string), v)
+		if err != nil {
+			r.Err = err
+			return
+		}
+		r.Success = true
+	case "compare":
+		other, err := t.Resolve(p, a, "compare_var", "compare_value")
+		if err != nil {
+			r.Err = err
+			return
+		}
+		conditional, err := a.GetArg("conditional", reflect.TypeOf(""), true)
+		if err != nil {
+			r.Err = fmt.Errorf("couldnt get conditional: %w", err)
+			return
+		}
+		var result bool
+		switch conditional.(string) {
+		case "before":
+			result = tm.Before(other)
+		case "after":
+			result = tm.After(other)
+		case "eq":
+			result = tm.Equal(other)
+		case "ne":
+			result = !tm.Equal(other)
+		default:
+			r.Err = fmt.Errorf("unknown conditional %s", conditional.(string))
+			return
+		}
+		logger.Tracef("Time compare: %v %s %v: %v", tm, conditional.(string), other, result)
+		advance := "advance_false"
+		if result {
+			advance = "advance_true"
+		}
+		advanceTxn, err := a.GetArg(advance, reflect.TypeOf(""), true)
+		if err != nil {
+			r.Err = fmt.Errorf("%s not set", advance)
+			return
+		}
+		r.Advance = true
+		r.NewTxn = advanceTxn.(string)
+		r.Success = result
+	default:
+		r.Err = fmt.Errorf("unknown operation %s", operation)
+	}
+	return
+}
+
+// Resolve gets a time from either the variable named in the varkey arg or
+// the value in the valkey arg, parsing it with parse_format if there is one.
+// With neither, it's now.
+func (t *Time) Resolve(p *plan.Plan, a ArgStruct, varkey string, valkey string) (time.Time, error) {
+	var i interface{}
+	if v, ok := a.Args[varkey].(string); ok && v != "" {
+		var err error
+		i, err = p.State.GetVariable(v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("couldnt get %s %s: %w", varkey, v, err)
+		}
+	} else if v, ok := a.Args[valkey]; ok && v != nil {
+		i = v
+	} else {
+		return time.Now(), nil
+	}
+
+	if pf, ok := a.Args["parse_format"].(string); ok && pf != "" {
+		s, ok := i.(string)
+		if !ok {
+			s = fmt.Sprint(i)
+		}
+		switch pf {
+		case "epoch", "epoch_millis":
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if pf == "epoch" {
+				return time.Unix(n, 0).UTC(), nil
+			}
+			return time.UnixMilli(n).UTC(), nil
+		}
+		return templates.ParseTime(pf, s)
+	}
+	return templates.ToTime(i)
+}
+
+func (t *Time) SetArgs(i map[string]interface{}) {
+	t.Args.Args = i
+}
+
+func (t *Time) Satisfy() (bool, error) {
+	return false, errors.New("cannot use satisfy_group for Time action: there are no conditions to satisfy")
+}
+
+func (t *Time) GetContext() (*context.Context, *context.CancelFunc) {
+	return nil, nil
+}
+
+func (t *Time) CanBackground() bool {
+	return false
+}
+
+func (t *Time) IsBackgrounded() bool {
+	return false
+}
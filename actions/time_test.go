@@ -0,0 +1,168 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/state"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTime_Execute(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    map[string]interface{}
+		vars    map[string]interface{}
+		wantR   ExecuteResult
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name: "offset and format",
+			args: map[string]interface{}{
+				"variable": "out",
+				"source":   "ordered",
+				"offset":   "2d",
+				"format":   "date",
+			},
+			vars:  map[string]interface{}{"ordered": "2021-06-01T12:30:00Z"},
+			wantR: ExecuteResult{Complete: true, Success: true},
+			want:  "2021-06-03",
+		},
+		{
+			name: "epoch millis",
+			args: map[string]interface{}{
+				"variable": "out",
+				"value":    "2021-06-01T12:30:00Z",
+				"format":   "epoch_millis",
+			},
+			wantR: ExecuteResult{Complete: true, Success: true},
+			want:  1622550600000,
+		},
+		{
+			name: "parse format and zone",
+			args: map[string]interface{}{
+				"variable":     "out",
+				"value":        "06/01/2021 12:30",
+				"parse_format": "01/02/2006 15:04",
+				"zone":         "Asia/Tokyo",
+				"format":       "2006-01-02T15:04:05-07:00",
+			},
+			wantR: ExecuteResult{Complete: true, Success: true},
+			want:  "2021-06-01T21:30:00+09:00",
+		},
+		{
+			name: "from epoch",
+			args: map[string]interface{}{
+				"variable":     "out",
+				"source":       "ts",
+				"parse_format": "epoch",
+			},
+			vars:  map[string]interface{}{"ts": 1622550600},
+			wantR: ExecuteResult{Complete: true, Success: true},
+			want:  "2021-06-01T12:30:00Z",
+		},
+		{
+			name: "compare after",
+			args: map[string]interface{}{
+				"operation":     "compare",
+				"source":        "delivered",
+				"compare_var":   "ordered",
+				"conditional":   "after",
+				"advance_true":  "late",
+				"advance_false": "on_time",
+			},
+			vars: map[string]interface{}{
+				"ordered":   "2021-06-01T12:30:00Z",
+				"delivered": "2021-06-03",
+			},
+			wantR: ExecuteResult{Complete: true, Success: true, Advance: true, NewTxn: "late"},
+		},
+		{
+			name: "compare with offset",
+			args: map[string]interface{}{
+				"operation":     "compare",
+				"source":        "ordered",
+				"offset":        "3d",
+				"compare_var":   "delivered",
+				"conditional":   "before",
+				"advance_true":  "late",
+				"advance_false": "on_time",
+			},
+			vars: map[string]interface{}{
+				"ordered":   "2021-06-01T12:30:00Z",
+				"delivered": "2021-06-03",
+			},
+			wantR: ExecuteResult{Complete: true, Advance: true, NewTxn: "on_time"},
+		},
+		{
+			name: "bad conditional",
+			args: map[string]interface{}{
+				"operation":     "compare",
+				"compare_value": "2021-06-03",
+				"conditional":   "around",
+				"advance_true":  "a",
+				"advance_false": "b",
+			},
+			wantErr: true,
+		},
+		{
+			name: "bad zone",
+			args: map[string]interface{}{
+				"variable": "out",
+				"zone":     "Nowhere/Special",
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing source",
+			args: map[string]interface{}{
+				"variable": "out",
+				"source":   "nope",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := tt.vars
+			if vars == nil {
+				vars = map[string]interface{}{}
+			}
+			p := &plan.Plan{State: &state.State{Variables: vars}}
+			tm := &Time{Args: ArgStruct{Args: tt.args}}
+			r := tm.Execute(p)
+			if (r.Err != nil) != tt.wantErr {
+				t.Errorf("Execute() error = %v, wantErr %v", r.Err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(r, tt.wantR) {
+				t.Errorf("Execute() = %v, want %v", r, tt.wantR)
+			}
+			if tt.want != nil && !reflect.DeepEqual(p.State.Variables["out"], tt.want) {
+				t.Errorf("Execute() out = %v, want %v", p.State.Variables["out"], tt.want)
+			}
+		})
+	}
+}
+
+func TestTime_ExecuteNow(t *testing.T) {
+	p := &plan.Plan{State: &state.State{Variables: map[string]interface{}{}}}
+	tm := &Time{Args: ArgStruct{Args: map[string]interface{}{"variable": "out", "format": "epoch"}}}
+	r := tm.Execute(p)
+	if r.Err != nil {
+		t.Fatalf("Execute() error = %v", r.Err)
+	}
+	got := p.State.Variables["out"].(int)
+	if now := int(time.Now().Unix()); got < now-5 || got > now {
+		t.Errorf("Execute() now = %d, want about %d", got, now)
+	}
+}
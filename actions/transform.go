@@ -0,0 +1,140 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/juju/loggo"
+	"reflect"
+)
+
+type Transform struct {
+	Action
+	Args ArgStruct
+}
+
+func (t *Transform) GetName() string {
+	return "transform"
+}
+func (t *Transform) Abort() {
+	return
+}
+
+func (t *Transform) Execute(p *plan.Plan) (r ExecuteResult) {
+	logger := loggo.GetLogger("default")
+	logger.Tracef("Executing transform action")
+
+	r.Complete = true
+
+	iargs, err := ParseTemplate(p, t.Args.Args)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	args := ArgStruct{Args: iargs}
+
+	variable, err := args.GetArg("variable", reflect.TypeOf(""), true)
+	if err != nil {
+		r.Err = fmt.Errorf("couldnt get variable: %w", err)
+		return
+	}
+
+	o := TransformOps{
+		State: p.State,
+	}
+
+	source, ok1 := args.Args["source"]
+	value, ok2 := args.Args["value"]
+	if ok1 && source != nil {
+		sourcestr, ok := source.(string)
+		if !ok {
+			r.Err = errors.New("source is not a string")
+			return
+		}
+		o.Value, err = p.State.GetVariable(sourcestr)
+		if err != nil {
+			r.Err = fmt.Errorf("couldnt get variable %s: %w", sourcestr, err)
+			return
+		}
+	} else if ok2 {
+		o.Value = StringKeys(value)
+	} else {
+		r.Err = errors.New("value or source not defined")
+		return
+	}
+
+	rawops, ok := args.Args["operations"]
+	if !ok {
+		r.Err = errors.New("operations not defined")
+		return
+	}
+	operations, ok := rawops.([]interface{})
+	if !ok {
+		r.Err = errors.New("operations is not a list")
+		return
+	}
+
+	for i, v := range operations {
+		// an operation is either the bare name of the operation, or a map
+		// with the name in "op" and any arguments it takes alongside it.
+		var op string
+		var opargs map[string]interface{}
+		switch rawop := StringKeys(v).(type) {
+		case string:
+			op = rawop
+		case map[string]interface{}:
+			op, ok = rawop["op"].(string)
+			if !ok {
+				r.Err = fmt.Errorf("operation %d has no op", i)
+				return
+			}
+			opargs = rawop
+		default:
+			r.Err = fmt.Errorf("operation %d is not a string or a map", i)
+			return
+		}
+		logger.Tracef("transform operation %s on %v", op, o.Value)
+		err = o.Execute(op, opargs)
+		if err != nil {
+			r.Err = err
+			return
+		}
+	}
+
+	// the result may not be the same type as whatever was in the variable before,
+	// so don't let SetVariable try to cast it back.
+	delete(p.State.Variables, variable.(string))
+	err = p.State.SetVariable(variable.(string), o.Value)
+	if err != nil {
+		r.Err = fmt.Errorf("couldnt set variable %s: %w", variable.(string), err)
+		return
+	}
+	r.Success = true
+	return
+}
+
+func (t *Transform) SetArgs(i map[string]interface{}) {
+	t.Args.Args = i
+}
+
+func (t *Transform) Satisfy() (bool, error) {
+	return false, errors.New("cannot use satisfy_group for Transform action: there are no conditions to satisfy")
+}
+
+func (t *Transform) GetContext() (*context.Context, *context.CancelFunc) {
+	return nil, nil
+}
+
+func (t *Transform) CanBackground() bool {
+	return false
+}
+
+func (t *Transform) IsBackgrounded() bool {
+	return false
+}
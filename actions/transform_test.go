@@ -0,0 +1,167 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/state"
+	"reflect"
+	"testing"
+)
+
+func TestTransform_Execute(t *testing.T) {
+	type fields struct {
+		Args ArgStruct
+	}
+	type args struct {
+		p *plan.Plan
+	}
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		variable string
+		want     interface{}
+		wantErr  bool
+	}{
+		{
+			name: "pipeline from source",
+			fields: fields{
+				Args: ArgStruct{
+					Args: map[string]interface{}{
+						"variable": "token",
+						"source":   "credentials",
+						"operations": []interface{}{
+							"trim",
+							map[interface{}]interface{}{
+								"op":      "concat",
+								"value":   "Basic ",
+								"prepend": true,
+							},
+						},
+					},
+				},
+			},
+			args: args{
+				p: &plan.Plan{
+					State: &state.State{
+						Variables: map[string]interface{}{
+							"credentials": "  user:pass  ",
+						},
+					},
+				},
+			},
+			variable: "token",
+			want:     "Basic user:pass",
+		},
+		{
+			name: "templated value changes type",
+			fields: fields{
+				Args: ArgStruct{
+					Args: map[string]interface{}{
+						"variable": "ids",
+						"value":    `<<index .Variables "first">>,b`,
+						"operations": []interface{}{
+							map[interface{}]interface{}{
+								"op":        "split",
+								"separator": ",",
+							},
+						},
+					},
+				},
+			},
+			args: args{
+				p: &plan.Plan{
+					State: &state.State{
+						Variables: map[string]interface{}{
+							"first": "a",
+							"ids":   "",
+						},
+					},
+				},
+			},
+			variable: "ids",
+			want:     []interface{}{"a", "b"},
+		},
+		{
+			name: "no value or source",
+			fields: fields{
+				Args: ArgStruct{
+					Args: map[string]interface{}{
+						"variable":   "out",
+						"operations": []interface{}{"upper"},
+					},
+				},
+			},
+			args: args{
+				p: &plan.Plan{
+					State: &state.State{Variables: map[string]interface{}{}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "operation without op",
+			fields: fields{
+				Args: ArgStruct{
+					Args: map[string]interface{}{
+						"variable": "out",
+						"value":    "a",
+						"operations": []interface{}{
+							map[interface{}]interface{}{"separator": ","},
+						},
+					},
+				},
+			},
+			args: args{
+				p: &plan.Plan{
+					State: &state.State{Variables: map[string]interface{}{}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "failing operation",
+			fields: fields{
+				Args: ArgStruct{
+					Args: map[string]interface{}{
+						"variable":   "out",
+						"value":      "!!",
+						"operations": []interface{}{"base64_decode"},
+					},
+				},
+			},
+			args: args{
+				p: &plan.Plan{
+					State: &state.State{Variables: map[string]interface{}{}},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &Transform{
+				Args: tt.fields.Args,
+			}
+			r := tr.Execute(tt.args.p)
+			if (r.Err != nil) != tt.wantErr {
+				t.Errorf("Execute() error = %v, wantErr %v", r.Err, tt.wantErr)
+				return
+			}
+			if !r.Complete {
+				t.Errorf("Execute() did not complete")
+			}
+			if tt.wantErr {
+				return
+			}
+			got := tt.args.p.State.Variables[tt.variable]
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Execute() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
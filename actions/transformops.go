@@ -0,0 +1,429 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/homedepot/trainer/structs/state"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// TransformOps holds the value being worked on by a transform pipeline.
+// Each operation replaces Value with its result.
+type TransformOps struct {
+	Value      interface{}
+	State      *state.State
+	operations map[string]func(map[string]interface{}) (interface{}, error)
+}
+
+func (c *TransformOps) Execute(op string, args map[string]interface{}) error {
+	if c.operations == nil {
+		c.operations = map[string]func(map[string]interface{}) (interface{}, error){
+			"concat":        c.concat,
+			"substring":     c.substring,
+			"upper":         c.upper,
+			"lower":         c.lower,
+			"trim":          c.trim,
+			"regex_extract": c.regexExtract,
+			"regex_replace": c.regexReplace,
+			"split":         c.split,
+			"join":          c.join,
+			"base64_encode": c.base64Encode,
+			"base64_decode": c.base64Decode,
+			"url_encode":    c.urlEncode,
+			"url_decode":    c.urlDecode,
+			"hex_encode":    c.hexEncode,
+			"hex_decode":    c.hexDecode,
+			"sha256":        c.sha256,
+			"md5":           c.md5,
+			"json_encode":   c.jsonEncode,
+			"json_decode":   c.jsonDecode,
+		}
+	}
+
+	f, ok := c.operations[op]
+	if !ok {
+		return fmt.Errorf("transform: invalid operation %s", op)
+	}
+	if args == nil {
+		args = make(map[string]interface{}, 0)
+	}
+	v, err := f(args)
+	if err != nil {
+		return fmt.Errorf("transform: %s: %w", op, err)
+	}
+	c.Value = v
+	return nil
+}
+
+// str returns the current value as a string.  Scalars are formatted, since
+// building an id out of a counter is a perfectly reasonable thing to do, but
+// maps and lists have no obvious string form and are refused.
+func (c *TransformOps) str() (string, error) {
+	return TransformString(c.Value)
+}
+
+// TransformString formats a scalar value as a string.
+func TransformString(i interface{}) (string, error) {
+	switch v := i.(type) {
+	case string:
+		return v, nil
+	case int, int64, float32, float64, bool:
+		return fmt.Sprint(v), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("cannot use %s as a string", reflect.TypeOf(i).String())
+	}
+}
+
+func (c *TransformOps) stringArg(args map[string]interface{}, n string, required bool) (string, error) {
+	a, ok := args[n]
+	if !ok || a == nil {
+		if required {
+			return "", fmt.Errorf("argument %s not found", n)
+		}
+		return "", nil
+	}
+	s, ok := a.(string)
+	if !ok {
+		return "", fmt.Errorf("argument %s is not a string", n)
+	}
+	return s, nil
+}
+
+func (c *TransformOps) intArg(args map[string]interface{}, n string) (int, bool, error) {
+	a, ok := args[n]
+	if !ok || a == nil {
+		return 0, false, nil
+	}
+	i, ok := a.(int)
+	if !ok {
+		return 0, false, fmt.Errorf("argument %s is not an int", n)
+	}
+	return i, true, nil
+}
+
+func (c *TransformOps) concat(args map[string]interface{}) (interface{}, error) {
+	s, err := c.str()
+	if err != nil {
+		return nil, err
+	}
+	var add interface{}
+	if v, ok := args["variable"]; ok {
+		vs, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("argument variable is not a string")
+		}
+		if c.State == nil {
+			return nil, fmt.Errorf("no state to read variable %s from", vs)
+		}
+		add, err = c.State.GetVariable(vs)
+		if err != nil {
+			return nil, err
+		}
+	} else if v, ok := args["value"]; ok {
+		add = v
+	} else {
+		return nil, fmt.Errorf("value or variable not defined")
+	}
+	as, err := TransformString(add)
+	if err != nil {
+		return nil, err
+	}
+	prepend, _ := args["prepend"].(bool)
+	if prepend {
+		return as + s, nil
+	}
+	return s + as, nil
+}
+
+func (c *TransformOps) substring(args map[string]interface{}) (interface{}, error) {
+	s, err := c.str()
+	if err != nil {
+		return nil, err
+	}
+	r := []rune(s)
+	start, _, err := c.intArg(args, "start")
+	if err != nil {
+		return nil, err
+	}
+	if start < 0 {
+		start = len(r) + start
+	}
+	end := len(r)
+	if e, ok, err := c.intArg(args, "end"); err != nil {
+		return nil, err
+	} else if ok {
+		end = e
+		if end < 0 {
+			end = len(r) + end
+		}
+	}
+	if l, ok, err := c.intArg(args, "length"); err != nil {
+		return nil, err
+	} else if ok {
+		end = start + l
+	}
+	if start < 0 || start > len(r) || end < start || end > len(r) {
+		return nil, fmt.Errorf("range %d:%d out of bounds for length %d", start, end, len(r))
+	}
+	return string(r[start:end]), nil
+}
+
+func (c *TransformOps) upper(args map[string]interface{}) (interface{}, error) {
+	s, err := c.str()
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToUpper(s), nil
+}
+
+func (c *TransformOps) lower(args map[string]interface{}) (interface{}, error) {
+	s, err := c.str()
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToLower(s), nil
+}
+
+func (c *TransformOps) trim(args map[string]interface{}) (interface{}, error) {
+	s, err := c.str()
+	if err != nil {
+		return nil, err
+	}
+	cutset, err := c.stringArg(args, "cutset", false)
+	if err != nil {
+		return nil, err
+	}
+	if cutset == "" {
+		return strings.TrimSpace(s), nil
+	}
+	return strings.Trim(s, cutset), nil
+}
+
+func (c *TransformOps) regexExtract(args map[string]interface{}) (interface{}, error) {
+	s, err := c.str()
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := c.stringArg(args, "pattern", true)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	group, _, err := c.intArg(args, "group")
+	if err != nil {
+		return nil, err
+	}
+	if group < 0 || group > re.NumSubexp() {
+		return nil, fmt.Errorf("group %d out of range", group)
+	}
+	m := re.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("pattern %s did not match", pattern)
+	}
+	return m[group], nil
+}
+
+func (c *TransformOps) regexReplace(args map[string]interface{}) (interface{}, error) {
+	s, err := c.str()
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := c.stringArg(args, "pattern", true)
+	if err != nil {
+		return nil, err
+	}
+	replacement, err := c.stringArg(args, "replacement", false)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.ReplaceAllString(s, replacement), nil
+}
+
+func (c *TransformOps) split(args map[string]interface{}) (interface{}, error) {
+	s, err := c.str()
+	if err != nil {
+		return nil, err
+	}
+	sep, err := c.stringArg(args, "separator", true)
+	if err != nil {
+		return nil, err
+	}
+	// lists in variables are always []interface{}, so keep it that way.
+	out := make([]interface{}, 0)
+	for _, v := range strings.Split(s, sep) {
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (c *TransformOps) join(args map[string]interface{}) (interface{}, error) {
+	l, ok := c.Value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot join %s, not a list", reflect.TypeOf(c.Value))
+	}
+	sep, err := c.stringArg(args, "separator", false)
+	if err != nil {
+		return nil, err
+	}
+	strs := make([]string, 0)
+	for _, v := range l {
+		s, err := TransformString(v)
+		if err != nil {
+			return nil, err
+		}
+		strs = append(strs, s)
+	}
+	return strings.Join(strs, sep), nil
+}
+
+func (c *TransformOps) base64Encode(args map[string]interface{}) (interface{}, error) {
+	s, err := c.str()
+	if err != nil {
+		return nil, err
+	}
+	if urlsafe, _ := args["url_safe"].(bool); urlsafe {
+		return base64.URLEncoding.EncodeToString([]byte(s)), nil
+	}
+	return base64.StdEncoding.EncodeToString([]byte(s)), nil
+}
+
+func (c *TransformOps) base64Decode(args map[string]interface{}) (interface{}, error) {
+	s, err := c.str()
+	if err != nil {
+		return nil, err
+	}
+	enc := base64.StdEncoding
+	if urlsafe, _ := args["url_safe"].(bool); urlsafe {
+		enc = base64.URLEncoding
+	}
+	out, err := enc.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(out), nil
+}
+
+func (c *TransformOps) urlEncode(args map[string]interface{}) (interface{}, error) {
+	s, err := c.str()
+	if err != nil {
+		return nil, err
+	}
+	if path, _ := args["path"].(bool); path {
+		return url.PathEscape(s), nil
+	}
+	return url.QueryEscape(s), nil
+}
+
+func (c *TransformOps) urlDecode(args map[string]interface{}) (interface{}, error) {
+	s, err := c.str()
+	if err != nil {
+		return nil, err
+	}
+	if path, _ := args["path"].(bool); path {
+		return url.PathUnescape(s)
+	}
+	return url.QueryUnescape(s)
+}
+
+func (c *TransformOps) hexEncode(args map[string]interface{}) (interface{}, error) {
+	s, err := c.str()
+	if err != nil {
+		return nil, err
+	}
+	return hex.EncodeToString([]byte(s)), nil
+}
+
+func (c *TransformOps) hexDecode(args map[string]interface{}) (interface{}, error) {
+	s, err := c.str()
+	if err != nil {
+		return nil, err
+	}
+	out, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(out), nil
+}
+
+func (c *TransformOps) sha256(args map[string]interface{}) (interface{}, error) {
+	s, err := c.str()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (c *TransformOps) md5(args map[string]interface{}) (interface{}, error) {
+	s, err := c.str()
+	if err != nil {
+		return nil, err
+	}
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (c *TransformOps) jsonEncode(args map[string]interface{}) (interface{}, error) {
+	out, err := json.Marshal(StringKeys(c.Value))
+	if err != nil {
+		return nil, err
+	}
+	return string(out), nil
+}
+
+func (c *TransformOps) jsonDecode(args map[string]interface{}) (interface{}, error) {
+	s, err := c.str()
+	if err != nil {
+		return nil, err
+	}
+	return LoadJSON(s)
+}
+
+// StringKeys converts the map[interface{}]interface{} maps the yaml parser
+// produces into map[string]interface{}, recursively, so that they can be
+// stored as variables and marshaled as JSON.
+func StringKeys(i interface{}) interface{} {
+	switch v := i.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, 0)
+		for k, e := range v {
+			m[fmt.Sprint(k)] = StringKeys(e)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, 0)
+		for k, e := range v {
+			m[k] = StringKeys(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, 0)
+		for _, e := range v {
+			l = append(l, StringKeys(e))
+		}
+		return l
+	default:
+		return i
+	}
+}
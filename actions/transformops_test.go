@@ -0,0 +1,215 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"github.com/homedepot/trainer/structs/state"
+	"reflect"
+	"testing"
+)
+
+func TestTransformOps_Execute(t *testing.T) {
+	type fields struct {
+		Value interface{}
+		State *state.State
+	}
+	type args struct {
+		op   string
+		args map[string]interface{}
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:   "concat value",
+			fields: fields{Value: "order-"},
+			args:   args{op: "concat", args: map[string]interface{}{"value": 12}},
+			want:   "order-12",
+		},
+		{
+			name: "concat variable prepended",
+			fields: fields{
+				Value: "1234",
+				State: &state.State{Variables: map[string]interface{}{"prefix": "ORD"}},
+			},
+			args: args{op: "concat", args: map[string]interface{}{"variable": "prefix", "prepend": true}},
+			want: "ORD1234",
+		},
+		{
+			name:    "concat nothing",
+			fields:  fields{Value: "a"},
+			args:    args{op: "concat"},
+			wantErr: true,
+		},
+		{
+			name:   "substring length",
+			fields: fields{Value: "abcdef"},
+			args:   args{op: "substring", args: map[string]interface{}{"start": 1, "length": 3}},
+			want:   "bcd",
+		},
+		{
+			name:   "substring negative start",
+			fields: fields{Value: "4111111111110002"},
+			args:   args{op: "substring", args: map[string]interface{}{"start": -4}},
+			want:   "0002",
+		},
+		{
+			name:    "substring out of range",
+			fields:  fields{Value: "abc"},
+			args:    args{op: "substring", args: map[string]interface{}{"start": 1, "end": 5}},
+			wantErr: true,
+		},
+		{
+			name:   "upper",
+			fields: fields{Value: "abc"},
+			args:   args{op: "upper"},
+			want:   "ABC",
+		},
+		{
+			name:   "lower",
+			fields: fields{Value: "ABC"},
+			args:   args{op: "lower"},
+			want:   "abc",
+		},
+		{
+			name:   "trim cutset",
+			fields: fields{Value: "--abc--"},
+			args:   args{op: "trim", args: map[string]interface{}{"cutset": "-"}},
+			want:   "abc",
+		},
+		{
+			name:   "regex extract group",
+			fields: fields{Value: "id=42;name=bob"},
+			args:   args{op: "regex_extract", args: map[string]interface{}{"pattern": "id=([0-9]+)", "group": 1}},
+			want:   "42",
+		},
+		{
+			name:    "regex extract no match",
+			fields:  fields{Value: "name=bob"},
+			args:    args{op: "regex_extract", args: map[string]interface{}{"pattern": "id=([0-9]+)"}},
+			wantErr: true,
+		},
+		{
+			name:   "regex replace",
+			fields: fields{Value: "a1b2"},
+			args:   args{op: "regex_replace", args: map[string]interface{}{"pattern": "[0-9]", "replacement": "#"}},
+			want:   "a#b#",
+		},
+		{
+			name:   "split",
+			fields: fields{Value: "a,b,c"},
+			args:   args{op: "split", args: map[string]interface{}{"separator": ","}},
+			want:   []interface{}{"a", "b", "c"},
+		},
+		{
+			name:   "join",
+			fields: fields{Value: []interface{}{"a", 1, true}},
+			args:   args{op: "join", args: map[string]interface{}{"separator": "-"}},
+			want:   "a-1-true",
+		},
+		{
+			name:    "join not a list",
+			fields:  fields{Value: "a"},
+			args:    args{op: "join"},
+			wantErr: true,
+		},
+		{
+			name:   "base64 encode",
+			fields: fields{Value: "user:pass"},
+			args:   args{op: "base64_encode"},
+			want:   "dXNlcjpwYXNz",
+		},
+		{
+			name:   "base64 decode",
+			fields: fields{Value: "dXNlcjpwYXNz"},
+			args:   args{op: "base64_decode"},
+			want:   "user:pass",
+		},
+		{
+			name:   "url encode",
+			fields: fields{Value: "a b&c"},
+			args:   args{op: "url_encode"},
+			want:   "a+b%26c",
+		},
+		{
+			name:   "url decode",
+			fields: fields{Value: "a+b%26c"},
+			args:   args{op: "url_decode"},
+			want:   "a b&c",
+		},
+		{
+			name:   "hex encode",
+			fields: fields{Value: "hi"},
+			args:   args{op: "hex_encode"},
+			want:   "6869",
+		},
+		{
+			name:    "hex decode invalid",
+			fields:  fields{Value: "zz"},
+			args:    args{op: "hex_decode"},
+			wantErr: true,
+		},
+		{
+			name:   "sha256",
+			fields: fields{Value: "abc"},
+			args:   args{op: "sha256"},
+			want:   "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		},
+		{
+			name:   "md5",
+			fields: fields{Value: "abc"},
+			args:   args{op: "md5"},
+			want:   "900150983cd24fb0d6963f7d28e17f72",
+		},
+		{
+			name:   "json encode",
+			fields: fields{Value: map[interface{}]interface{}{"a": []interface{}{1, "b"}}},
+			args:   args{op: "json_encode"},
+			want:   `{"a":[1,"b"]}`,
+		},
+		{
+			name:   "json decode",
+			fields: fields{Value: `{"a":"b"}`},
+			args:   args{op: "json_decode"},
+			want:   map[string]interface{}{"a": "b"},
+		},
+		{
+			name:    "map is not a string",
+			fields:  fields{Value: map[string]interface{}{}},
+			args:    args{op: "upper"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid operation",
+			fields:  fields{Value: "a"},
+			args:    args{op: "frobnicate"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &TransformOps{
+				Value: tt.fields.Value,
+				State: tt.fields.State,
+			}
+			err := c.Execute(tt.args.op, tt.args.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(c.Value, tt.want) {
+				t.Errorf("Execute() got = %v, want %v", c.Value, tt.want)
+			}
+		})
+	}
+}
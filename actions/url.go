@@ -8,11 +8,12 @@ package actions
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/gofrs/uuid"
 	"github.com/homedepot/trainer/structs/plan"
 	"github.com/juju/loggo"
-	"io"
 	"reflect"
+	"strings"
 )
 
 type URL struct {
@@ -36,9 +37,34 @@ func (u *URL) URLMatches(ctx *QueueContext) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	logger.Tracef("comparing %s and %s", ctx.Ctx.Request.URL.Path, url.(string))
-	if ctx.Ctx.Request.URL.Path != url.(string) {
-		logger.Warningf("unexpected URL %s", ctx.Ctx.Request.URL.Path)
+	req := ctx.Ctx.Request
+	logger.Tracef("comparing %s and %s", req.URL.Path, url.(string))
+	matched, _, err := MatchPath(url.(string), req.URL.Path)
+	if err != nil {
+		return false, err
+	}
+	if !matched {
+		logger.Warningf("unexpected URL %s", req.URL.Path)
+		return false, nil
+	}
+	if m, ok := u.Args.Args["method"].(string); ok && m != "" && !strings.EqualFold(m, req.Method) {
+		logger.Warningf("unexpected method %s for %s", req.Method, req.URL.Path)
+		return false, nil
+	}
+	headers, err := LoadValueMatches(u.Args.Args["headers"])
+	if err != nil {
+		return false, fmt.Errorf("headers: %w", err)
+	}
+	if h := MatchHeaders(headers, req.Header); h != "" {
+		logger.Warningf("header %s doesn't match for %s", h, req.URL.Path)
+		return false, nil
+	}
+	query, err := LoadValueMatches(u.Args.Args["query"])
+	if err != nil {
+		return false, fmt.Errorf("query: %w", err)
+	}
+	if q := MatchQuery(query, req.URL.Query()); q != "" {
+		logger.Warningf("query parameter %s doesn't match for %s", q, req.URL.Path)
 		return false, nil
 	}
 	return true, nil
@@ -64,7 +90,13 @@ func (u *URL) Execute(p *plan.Plan) (r ExecuteResult) {
 		r.Complete = true
 		return
 	}
-	body, err := io.ReadAll(ctx.Ctx.Request.Body)
+	r.Fault = u.Args.Args["fault"]
+	if err := u.SaveParams(p, ctx); err != nil {
+		r.Complete = true
+		r.Err = err
+		return
+	}
+	body, err := ctx.ReadBody()
 	if err != nil {
 		logger.Criticalf("Couldn't read request body, Failing test. (%s)", err.Error())
 		r.Err = err
@@ -141,6 +173,37 @@ func (u *URL) Execute(p *plan.Plan) (r ExecuteResult) {
 		r.Complete = true
 		return
 	}
+	if u.Args.Args["rules"] != nil && u.Args.Args["responses"] != nil {
+		r.Complete = true
+		r.Err = errors.New("only one of rules and responses can be given")
+		return
+	}
+	if rules, ok := u.Args.Args["rules"]; ok {
+		l, err := LoadResponseRules(rules)
+		if err != nil {
+			r.Complete = true
+			r.Err = fmt.Errorf("rules: %w", err)
+			return
+		}
+		rule, err := MatchRule(l, ctx)
+		if err != nil {
+			r.Complete = true
+			r.Err = err
+			return
+		}
+		if rule == nil {
+			logger.Warningf("no rule matched %s", ctx.Ctx.Request.URL.Path)
+			r.Complete = true
+			return
+		}
+		logger.Debugf("rule %s matched %s", rule.Name, ctx.Ctx.Request.URL.Path)
+		r.OnExpected = rule.OnExpected
+	}
+	if err := u.Sequence(p, ctx, &r); err != nil {
+		r.Complete = true
+		r.Err = err
+		return
+	}
 	logger.Tracef("finished...")
 	r.Complete = true
 	r.Success = true
@@ -148,6 +211,56 @@ func (u *URL) Execute(p *plan.Plan) (r ExecuteResult) {
 	return
 }
 
+// SaveParams saves the parameters captured from the path into variables,
+// with param_prefix in front of their names if it's set.
+func (u *URL) SaveParams(p *plan.Plan, ctx *QueueContext) error {
+	url, _ := u.Args.Args["url"].(string)
+	_, params, err := MatchPath(url, ctx.Ctx.Request.URL.Path)
+	if err != nil {
+		return err
+	}
+	ctx.Params = params
+	prefix, _ := u.Args.Args["param_prefix"].(string)
+	for k, v := range params {
+		if err := p.State.SetVariable(prefix+k, v); err != nil {
+			return fmt.Errorf("saving parameter %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// Sequence counts the call, and if the action has responses, picks the one
+// for this call.  Every call before the last response is answered without
+// moving on.
+func (u *URL) Sequence(p *plan.Plan, ctx *QueueContext, r *ExecuteResult) error {
+	url, _ := u.Args.Args["url"].(string)
+	method, _ := u.Args.Args["method"].(string)
+	n := p.State.CountCall(CallKey(p.State.Transaction, p.State.TxnActionIdx, strings.ToUpper(method), url))
+	if v, ok := u.Args.Args["save_count"].(string); ok && v != "" {
+		if err := p.State.SetVariable(v, n); err != nil {
+			return fmt.Errorf("save_count: %w", err)
+		}
+	}
+	responses, ok := u.Args.Args["responses"]
+	if !ok {
+		return nil
+	}
+	l, err := LoadResponses(responses)
+	if err != nil {
+		return err
+	}
+	mode, _ := u.Args.Args["sequence"].(string)
+	i, final, err := SequenceIndex(n, len(l), mode)
+	if err != nil {
+		return err
+	}
+	logger := loggo.GetLogger("default")
+	logger.Debugf("call %d to %s gets response %d of %d", n, ctx.Ctx.Request.URL.Path, i+1, len(l))
+	r.OnExpected = l[i]
+	r.Repeat = !final
+	return nil
+}
+
 func (u *URL) SetArgs(i map[string]interface{}) {
 	u.Args.Args = i
 }
@@ -0,0 +1,298 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/state"
+)
+
+// testRequest makes the queue context a url action gets for a request.
+func testRequest(method, target string, headers map[string]string, body string) *QueueContext {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(method, target, strings.NewReader(body))
+	for k, v := range headers {
+		c.Request.Header.Set(k, v)
+	}
+	return &QueueContext{Ctx: c, Finished: make(chan bool, 1)}
+}
+
+func TestURL_URLMatches(t *testing.T) {
+	auth := map[string]string{"Authorization": "Bearer abc", "X-Tenant": "a"}
+	tests := []struct {
+		name    string
+		args    map[string]interface{}
+		method  string
+		target  string
+		headers map[string]string
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:   "path only",
+			args:   map[string]interface{}{"url": "/orders"},
+			method: "DELETE", target: "/orders",
+			want: true,
+		},
+		{
+			name:   "wrong path",
+			args:   map[string]interface{}{"url": "/orders"},
+			method: "GET", target: "/items",
+		},
+		{
+			name:   "method",
+			args:   map[string]interface{}{"url": "/orders", "method": "get"},
+			method: "GET", target: "/orders",
+			want: true,
+		},
+		{
+			name:   "wrong method",
+			args:   map[string]interface{}{"url": "/orders", "method": "GET"},
+			method: "DELETE", target: "/orders",
+		},
+		{
+			name: "headers",
+			args: map[string]interface{}{"url": "/orders", "headers": map[interface{}]interface{}{
+				"x-tenant":      "a",
+				"Authorization": map[interface{}]interface{}{"regex": "^Bearer .+"},
+				"X-Debug":       map[interface{}]interface{}{"present": false},
+			}},
+			method: "GET", target: "/orders", headers: auth,
+			want: true,
+		},
+		{
+			name: "header missing",
+			args: map[string]interface{}{"url": "/orders", "headers": map[interface{}]interface{}{
+				"Authorization": map[interface{}]interface{}{"present": true},
+			}},
+			method: "GET", target: "/orders",
+		},
+		{
+			name: "header wrong",
+			args: map[string]interface{}{"url": "/orders", "headers": map[interface{}]interface{}{
+				"X-Tenant": map[interface{}]interface{}{"value": "b"},
+			}},
+			method: "GET", target: "/orders", headers: auth,
+		},
+		{
+			name: "header there but shouldn't be",
+			args: map[string]interface{}{"url": "/orders", "headers": map[interface{}]interface{}{
+				"X-Tenant": map[interface{}]interface{}{"present": false},
+			}},
+			method: "GET", target: "/orders", headers: auth,
+		},
+		{
+			name: "query",
+			args: map[string]interface{}{"url": "/orders", "query": map[interface{}]interface{}{
+				"status": "open",
+				"page":   map[interface{}]interface{}{"regex": `^\d+$`},
+			}},
+			method: "GET", target: "/orders?status=closed&status=open&page=2",
+			want: true,
+		},
+		{
+			name: "query wrong",
+			args: map[string]interface{}{"url": "/orders", "query": map[interface{}]interface{}{
+				"page": map[interface{}]interface{}{"regex": `^\d+$`},
+			}},
+			method: "GET", target: "/orders?page=last",
+		},
+		{
+			name: "bad regex",
+			args: map[string]interface{}{"url": "/orders", "headers": map[interface{}]interface{}{
+				"X-Tenant": map[interface{}]interface{}{"regex": "("},
+			}},
+			method: "GET", target: "/orders",
+			wantErr: true,
+		},
+		{
+			name: "unknown match",
+			args: map[string]interface{}{"url": "/orders", "query": map[interface{}]interface{}{
+				"page": map[interface{}]interface{}{"like": "1"},
+			}},
+			method: "GET", target: "/orders",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &URL{}
+			u.SetArgs(tt.args)
+			got, err := u.URLMatches(testRequest(tt.method, tt.target, tt.headers, ""))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("URLMatches() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("URLMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestURL_Satisfy(t *testing.T) {
+	get := &URL{}
+	get.SetArgs(map[string]interface{}{"url": "/orders", "method": "GET", "_context": testRequest("DELETE", "/orders", nil, "")})
+	del := &URL{}
+	del.SetArgs(map[string]interface{}{"url": "/orders", "method": "DELETE", "_context": testRequest("DELETE", "/orders", nil, "")})
+	if ok, err := get.Satisfy(); ok || err != nil {
+		t.Errorf("Satisfy() = %v, %v for the wrong method", ok, err)
+	}
+	if ok, err := del.Satisfy(); !ok || err != nil {
+		t.Errorf("Satisfy() = %v, %v for the right method", ok, err)
+	}
+}
+
+func TestURL_Execute(t *testing.T) {
+	p := &plan.Plan{State: state.NewState("a")}
+	u := &URL{}
+	u.SetArgs(map[string]interface{}{"url": "/orders", "method": "POST", "save_body": "body",
+		"_context": testRequest("POST", "/orders", nil, "hello")})
+	if r := u.Execute(p); !r.Complete || !r.Success || r.Err != nil {
+		t.Errorf("Execute() = %+v, want success", r)
+	}
+	if p.State.Variables["body"] != "hello" {
+		t.Errorf("body = %v, want hello", p.State.Variables["body"])
+	}
+
+	u = &URL{}
+	u.SetArgs(map[string]interface{}{"url": "/orders", "method": "POST",
+		"_context": testRequest("GET", "/orders", nil, "")})
+	if r := u.Execute(p); !r.Complete || r.Success || r.Err != nil {
+		t.Errorf("Execute() = %+v, want unexpected", r)
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		path    string
+		want    bool
+		params  map[string]string
+		wantErr bool
+	}{
+		{name: "literal", url: "/orders", path: "/orders", want: true},
+		{name: "literal mismatch", url: "/orders", path: "/orders/1"},
+		{
+			name: "colon params", url: "/orders/:id/items/:sku", path: "/orders/42/items/abc-1",
+			want: true, params: map[string]string{"id": "42", "sku": "abc-1"},
+		},
+		{
+			name: "brace params", url: "/orders/{id}/items/{sku}", path: "/orders/42/items/abc-1",
+			want: true, params: map[string]string{"id": "42", "sku": "abc-1"},
+		},
+		{name: "one segment only", url: "/orders/:id", path: "/orders/42/items"},
+		{name: "empty segment", url: "/orders/:id", path: "/orders/"},
+		{name: "literal parts are literal", url: "/orders.v1/:id", path: "/ordersXv1/42"},
+		{
+			name: "regex", url: `^/orders/(?P<id>\d+)(/items)?$`, path: "/orders/42/items",
+			want: true, params: map[string]string{"id": "42"},
+		},
+		{name: "regex mismatch", url: `^/orders/(?P<id>\d+)$`, path: "/orders/abc"},
+		{name: "bad regex", url: "^/orders/(", path: "/orders/", wantErr: true},
+		{name: "bad param", url: "/orders/:1d", path: "/orders/1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, params, err := MatchPath(tt.url, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MatchPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("MatchPath() = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.params {
+				if params[k] != v {
+					t.Errorf("param %s = %q, want %q", k, params[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestURL_SaveParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		want   map[string]interface{}
+	}{
+		{name: "no prefix", want: map[string]interface{}{"id": "42", "sku": "abc"}},
+		{name: "prefix", prefix: "order_", want: map[string]interface{}{"order_id": "42", "order_sku": "abc"}},
+		{name: "map prefix", prefix: "req.", want: map[string]interface{}{"req": map[string]interface{}{"id": "42", "sku": "abc"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &plan.Plan{State: state.NewState("a")}
+			u := &URL{}
+			u.SetArgs(map[string]interface{}{"url": "/orders/:id/items/:sku", "param_prefix": tt.prefix,
+				"_context": testRequest("GET", "/orders/42/items/abc", nil, "")})
+			if r := u.Execute(p); !r.Success || r.Err != nil {
+				t.Fatalf("Execute() = %+v, want success", r)
+			}
+			if !reflect.DeepEqual(p.State.Variables, tt.want) {
+				t.Errorf("variables = %v, want %v", p.State.Variables, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueContext_TemplateRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		body    string
+		want    interface{}
+	}{
+		{name: "json", headers: map[string]string{"Content-Type": "application/json"}, body: `{"amount": 10}`,
+			want: map[string]interface{}{"amount": float64(10)}},
+		{name: "yaml", headers: map[string]string{"Content-Type": "application/x-yaml"}, body: "amount: 10\n",
+			want: map[string]interface{}{"amount": 10}},
+		{name: "json without a content type", body: `[1]`, want: []interface{}{float64(1)}},
+		{name: "not json", body: "hello"},
+		{name: "no body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &plan.Plan{State: state.NewState("a")}
+			ctx := testRequest("POST", "/orders/42?page=2&page=3", tt.headers, tt.body)
+			u := &URL{}
+			u.SetArgs(map[string]interface{}{"url": "/orders/:id", "save_body": "body", "_context": ctx})
+			if r := u.Execute(p); !r.Success || r.Err != nil {
+				t.Fatalf("Execute() = %+v, want success", r)
+			}
+			req, err := ctx.TemplateRequest()
+			if err != nil {
+				t.Fatalf("TemplateRequest() error = %v", err)
+			}
+			if req.Method != "POST" || req.Path != "/orders/42" {
+				t.Errorf("request = %s %s, want POST /orders/42", req.Method, req.Path)
+			}
+			if req.Params["id"] != "42" {
+				t.Errorf("id = %q, want 42", req.Params["id"])
+			}
+			if req.Query["page"] != "2" {
+				t.Errorf("page = %q, want 2", req.Query["page"])
+			}
+			for k, v := range tt.headers {
+				if req.Headers[k] != v {
+					t.Errorf("header %s = %q, want %q", k, req.Headers[k], v)
+				}
+			}
+			if req.RawBody != tt.body {
+				t.Errorf("raw body = %q, want %q, even after the url action read it", req.RawBody, tt.body)
+			}
+			if !reflect.DeepEqual(req.Body, tt.want) {
+				t.Errorf("body = %#v, want %#v", req.Body, tt.want)
+			}
+		})
+	}
+}
@@ -8,10 +8,9 @@ package actions
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/homedepot/trainer/structs/plan"
 	"github.com/juju/loggo"
-	"reflect"
-	"strconv"
 	"time"
 )
 
@@ -35,45 +34,100 @@ func (w *Wait) Execute(p *plan.Plan) (r ExecuteResult) {
 	logger.Tracef("Executing wait action")
 
 	if p.State.AbortRunningAction {
+		FinishWait(p)
 		r.Complete = true
 		r.Err = errors.New("aborted")
 		return
 	}
-	if p.State.WaitActionStartTime.IsZero() {
-		p.State.WaitActionStartTime = time.Now()
-	}
-	starttime := p.State.WaitActionStartTime
+	starttime := StartWait(p)
 
-	duration, err := w.Args.GetArg("duration", reflect.TypeOf(0), true)
-	if err != nil {
-		logger.Warningf("%s", err)
-		r.Err = err
-		return
+	// the duration is only worked out once per wait, otherwise the jitter
+	// would be different every time around.
+	if p.State.WaitActionDuration == 0 {
+		durat, err := w.Duration(p)
+		if err != nil {
+			logger.Warningf("%s", err)
+			FinishWait(p)
+			r.Complete = true
+			r.Err = err
+			return
+		}
+		p.State.WaitActionDuration = durat
 	}
-	durint := duration.(int)
+	durat := p.State.WaitActionDuration
 
 	// Manage sleep and reset cycle.
 
 	// if reset is true, something called abort.
-	seconds := time.Since(starttime)
-	durstr := strconv.Itoa(durint) + "s"
-	durat, err := time.ParseDuration(durstr)
-	if err != nil {
-		r.Err = err
-		return
-	}
-	if seconds >= durat {
+	elapsed := time.Since(starttime)
+	if elapsed >= durat {
 		logger.Debugf("Wait completed!")
-		p.State.WaitActionStartTime = time.Time{}
+		FinishWait(p)
 		r.Success = true
 		r.Complete = true
 		return
 	} else {
-		logger.Tracef("Wait not completed (%v %v)", seconds, durint)
+		p.State.WaitRemaining = (durat - elapsed).Round(time.Millisecond).String()
+		logger.Tracef("Wait not completed (%v %v)", elapsed, durat)
 		return
 	}
 }
 
+// Duration works out how long to wait, either the duration arg or a random
+// time between min and max.
+func (w *Wait) Duration(p *plan.Plan) (time.Duration, error) {
+	args, err := ParseTemplate(p, w.Args.Args)
+	if err != nil {
+		return 0, err
+	}
+	if d, ok := args["duration"]; ok {
+		return ParseDuration(d)
+	}
+	mn, ok := args["min"]
+	if !ok {
+		return 0, errors.New("argument duration not present")
+	}
+	mx, ok := args["max"]
+	if !ok {
+		return 0, errors.New("argument max not present")
+	}
+	min, err := ParseDuration(mn)
+	if err != nil {
+		return 0, fmt.Errorf("min: %w", err)
+	}
+	max, err := ParseDuration(mx)
+	if err != nil {
+		return 0, fmt.Errorf("max: %w", err)
+	}
+	if max < min {
+		return 0, errors.New("max is less than min")
+	}
+	if max == min {
+		return min, nil
+	}
+	return min + time.Duration(p.State.Random().Int63n(int64(max-min))), nil
+}
+
+// StartWait returns when the current wait started, starting it if there isn't
+// one.  A wait left behind by another transaction (because something
+// advanced out of it) doesn't count.
+func StartWait(p *plan.Plan) time.Time {
+	if p.State.WaitActionStartTime.IsZero() || p.State.WaitActionTxn != p.State.Transaction {
+		FinishWait(p)
+		p.State.WaitActionStartTime = time.Now()
+		p.State.WaitActionTxn = p.State.Transaction
+	}
+	return p.State.WaitActionStartTime
+}
+
+// FinishWait clears out the wait, so the next one starts fresh.
+func FinishWait(p *plan.Plan) {
+	p.State.WaitActionStartTime = time.Time{}
+	p.State.WaitActionTxn = ""
+	p.State.WaitActionDuration = 0
+	p.State.WaitRemaining = ""
+}
+
 func (w *Wait) SetArgs(i map[string]interface{}) {
 	w.Args.Args = i
 }
@@ -141,6 +141,111 @@ func TestWait_Execute(t *testing.T) {
 	}
 }
 
+func TestWait_ExecuteRemaining(t *testing.T) {
+	p := &plan.Plan{State: &state.State{}}
+	w := &Wait{Args: ArgStruct{Args: map[string]interface{}{"duration": "1m"}}}
+	r := w.Execute(p)
+	if r.Complete || r.Err != nil {
+		t.Fatalf("Execute() = %v, want still waiting", r)
+	}
+	if p.State.WaitRemaining == "" {
+		t.Errorf("Execute() didn't set the remaining time")
+	}
+	p.State.WaitActionStartTime = time.Now().Add(-time.Minute)
+	r = w.Execute(p)
+	if !r.Complete || !r.Success {
+		t.Fatalf("Execute() = %v, want complete", r)
+	}
+	if p.State.WaitRemaining != "" || p.State.WaitActionDuration != 0 || !p.State.WaitActionStartTime.IsZero() {
+		t.Errorf("Execute() didn't clear the wait: %+v", p.State)
+	}
+}
+
+func TestWait_Duration(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    map[string]interface{}
+		vars    map[string]interface{}
+		min     time.Duration
+		max     time.Duration
+		wantErr bool
+	}{
+		{
+			name: "int seconds",
+			args: map[string]interface{}{"duration": 2},
+			min:  2 * time.Second,
+			max:  2 * time.Second,
+		},
+		{
+			name: "float seconds",
+			args: map[string]interface{}{"duration": 0.5},
+			min:  500 * time.Millisecond,
+			max:  500 * time.Millisecond,
+		},
+		{
+			name: "duration string",
+			args: map[string]interface{}{"duration": "250ms"},
+			min:  250 * time.Millisecond,
+			max:  250 * time.Millisecond,
+		},
+		{
+			name: "templated",
+			args: map[string]interface{}{"duration": "<<.Variables.delay>>"},
+			vars: map[string]interface{}{"delay": "2m"},
+			min:  2 * time.Minute,
+			max:  2 * time.Minute,
+		},
+		{
+			name: "jitter",
+			args: map[string]interface{}{"min": "100ms", "max": 1},
+			min:  100 * time.Millisecond,
+			max:  time.Second,
+		},
+		{
+			name:    "max less than min",
+			args:    map[string]interface{}{"min": "2s", "max": "1s"},
+			wantErr: true,
+		},
+		{
+			name:    "missing max",
+			args:    map[string]interface{}{"min": "2s"},
+			wantErr: true,
+		},
+		{
+			name:    "missing duration",
+			args:    map[string]interface{}{},
+			wantErr: true,
+		},
+		{
+			name:    "bad string",
+			args:    map[string]interface{}{"duration": "soon"},
+			wantErr: true,
+		},
+		{
+			name:    "negative",
+			args:    map[string]interface{}{"duration": -1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &plan.Plan{State: &state.State{Variables: tt.vars}}
+			w := &Wait{Args: ArgStruct{Args: tt.args}}
+			got, err := w.Duration(p)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Duration() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if got < tt.min || got > tt.max {
+				t.Errorf("Duration() = %v, want between %v and %v", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
 func TestWait_GetName(t *testing.T) {
 	type fields struct {
 		Action       Action
@@ -0,0 +1,138 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/juju/loggo"
+	"reflect"
+	"time"
+)
+
+type WaitUntil struct {
+	Action
+	Args ArgStruct
+}
+
+func (w *WaitUntil) GetName() string {
+	return "wait_until"
+}
+func (w *WaitUntil) Abort() {
+	return
+}
+
+func (w *WaitUntil) Execute(p *plan.Plan) (r ExecuteResult) {
+	logger := loggo.GetLogger("default")
+	logger.Tracef("Executing wait_until action")
+
+	if p.State.AbortRunningAction {
+		FinishWait(p)
+		r.Complete = true
+		r.Err = errors.New("aborted")
+		return
+	}
+
+	term, err := ParseTerm(w.Args.Args["term"])
+	if err != nil {
+		r.Complete = true
+		r.Err = err
+		return
+	}
+	advanceTrue, err := w.Args.GetArg("advance_true", reflect.TypeOf(""), true)
+	if err != nil {
+		r.Complete = true
+		r.Err = errors.New("advance_true not set")
+		return
+	}
+	advanceFalse, err := w.Args.GetArg("advance_false", reflect.TypeOf(""), true)
+	if err != nil {
+		r.Complete = true
+		r.Err = errors.New("advance_false not set")
+		return
+	}
+
+	starttime := StartWait(p)
+	if p.State.WaitActionDuration == 0 {
+		args, err := ParseTemplate(p, w.Args.Args)
+		if err != nil {
+			FinishWait(p)
+			r.Complete = true
+			r.Err = err
+			return
+		}
+		timeout, ok := args["timeout"]
+		if !ok {
+			FinishWait(p)
+			r.Complete = true
+			r.Err = errors.New("argument timeout not present")
+			return
+		}
+		p.State.WaitActionDuration, err = ParseDuration(timeout)
+		if err != nil {
+			FinishWait(p)
+			r.Complete = true
+			r.Err = fmt.Errorf("timeout: %w", err)
+			return
+		}
+	}
+	timeout := p.State.WaitActionDuration
+
+	// a variable that hasn't been set yet is the usual reason for waiting,
+	// so that's just false for now.
+	result, err := term.Evaluate(p)
+	if err != nil && !errors.Is(err, ErrVariableNotSet) {
+		FinishWait(p)
+		r.Complete = true
+		r.Err = err
+		return
+	}
+
+	if result {
+		logger.Debugf("wait_until condition met, advancing to %s", advanceTrue.(string))
+		FinishWait(p)
+		r.Complete = true
+		r.Success = true
+		r.Advance = true
+		r.NewTxn = advanceTrue.(string)
+		return
+	}
+
+	elapsed := time.Since(starttime)
+	if elapsed >= timeout {
+		logger.Debugf("wait_until timed out after %v, advancing to %s", elapsed, advanceFalse.(string))
+		FinishWait(p)
+		r.Complete = true
+		r.Advance = true
+		r.NewTxn = advanceFalse.(string)
+		return
+	}
+	p.State.WaitRemaining = (timeout - elapsed).Round(time.Millisecond).String()
+	logger.Tracef("wait_until not met (%v %v)", elapsed, timeout)
+	return
+}
+
+func (w *WaitUntil) SetArgs(i map[string]interface{}) {
+	w.Args.Args = i
+}
+
+func (w *WaitUntil) Satisfy() (bool, error) {
+	return false, errors.New("cannot use satisfy for WaitUntil action: it runs when none of the url actions in its group are satisfied")
+}
+
+func (w *WaitUntil) GetContext() (*context.Context, *context.CancelFunc) {
+	return nil, nil
+}
+
+func (w *WaitUntil) CanBackground() bool {
+	return false
+}
+
+func (w *WaitUntil) IsBackgrounded() bool {
+	return false
+}
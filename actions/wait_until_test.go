@@ -0,0 +1,163 @@
+package actions
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/state"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWaitUntil_Execute(t *testing.T) {
+	term := map[interface{}]interface{}{
+		"variable":          "status",
+		"conditional":       "eq",
+		"conditional_value": "paid",
+	}
+	tests := []struct {
+		name    string
+		args    map[string]interface{}
+		vars    map[string]interface{}
+		started time.Duration
+		wantR   ExecuteResult
+		wantErr bool
+	}{
+		{
+			name: "condition met",
+			args: map[string]interface{}{
+				"term":          term,
+				"timeout":       "30s",
+				"advance_true":  "paid",
+				"advance_false": "unpaid",
+			},
+			vars:  map[string]interface{}{"status": "paid"},
+			wantR: ExecuteResult{Complete: true, Success: true, Advance: true, NewTxn: "paid"},
+		},
+		{
+			name: "variable not set yet",
+			args: map[string]interface{}{
+				"term":          term,
+				"timeout":       "30s",
+				"advance_true":  "paid",
+				"advance_false": "unpaid",
+			},
+			vars:  map[string]interface{}{},
+			wantR: ExecuteResult{},
+		},
+		{
+			name: "condition not met yet",
+			args: map[string]interface{}{
+				"term":          term,
+				"timeout":       30,
+				"advance_true":  "paid",
+				"advance_false": "unpaid",
+			},
+			vars:    map[string]interface{}{"status": "pending"},
+			started: 10 * time.Second,
+			wantR:   ExecuteResult{},
+		},
+		{
+			name: "timed out",
+			args: map[string]interface{}{
+				"term":          term,
+				"timeout":       "<<.Variables.timeout>>",
+				"advance_true":  "paid",
+				"advance_false": "unpaid",
+			},
+			vars:    map[string]interface{}{"status": "pending", "timeout": "5s"},
+			started: 10 * time.Second,
+			wantR:   ExecuteResult{Complete: true, Advance: true, NewTxn: "unpaid"},
+		},
+		{
+			name: "no timeout",
+			args: map[string]interface{}{
+				"term":          term,
+				"advance_true":  "paid",
+				"advance_false": "unpaid",
+			},
+			vars:    map[string]interface{}{},
+			wantErr: true,
+		},
+		{
+			name: "no advance_false",
+			args: map[string]interface{}{
+				"term":         term,
+				"timeout":      "30s",
+				"advance_true": "paid",
+			},
+			vars:    map[string]interface{}{},
+			wantErr: true,
+		},
+		{
+			name: "bad term",
+			args: map[string]interface{}{
+				"term":          map[interface{}]interface{}{"variable": "status"},
+				"timeout":       "30s",
+				"advance_true":  "paid",
+				"advance_false": "unpaid",
+			},
+			vars:    map[string]interface{}{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &plan.Plan{State: &state.State{Transaction: "waiting", Variables: tt.vars}}
+			if tt.started != 0 {
+				p.State.WaitActionStartTime = time.Now().Add(-tt.started)
+				p.State.WaitActionTxn = "waiting"
+			}
+			w := &WaitUntil{Args: ArgStruct{Args: tt.args}}
+			r := w.Execute(p)
+			if (r.Err != nil) != tt.wantErr {
+				t.Errorf("Execute() error = %v, wantErr %v", r.Err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(r, tt.wantR) {
+				t.Errorf("Execute() = %v, want %v", r, tt.wantR)
+			}
+			if r.Complete && !p.State.WaitActionStartTime.IsZero() {
+				t.Errorf("Execute() didn't clear the wait")
+			}
+			if !r.Complete && p.State.WaitRemaining == "" {
+				t.Errorf("Execute() didn't set the remaining time")
+			}
+		})
+	}
+}
+
+func TestWaitUntil_ExecuteStaleWait(t *testing.T) {
+	// a wait left over from another transaction doesn't time this one out.
+	p := &plan.Plan{State: &state.State{
+		Transaction:         "waiting",
+		Variables:           map[string]interface{}{},
+		WaitActionStartTime: time.Now().Add(-time.Hour),
+		WaitActionTxn:       "elsewhere",
+		WaitActionDuration:  time.Second,
+	}}
+	w := &WaitUntil{Args: ArgStruct{Args: map[string]interface{}{
+		"term": map[interface{}]interface{}{
+			"variable":          "status",
+			"conditional":       "eq",
+			"conditional_value": "paid",
+		},
+		"timeout":       "30s",
+		"advance_true":  "paid",
+		"advance_false": "unpaid",
+	}}}
+	r := w.Execute(p)
+	if r.Complete || r.Err != nil {
+		t.Errorf("Execute() = %v, want still waiting", r)
+	}
+	if p.State.WaitActionDuration != 30*time.Second {
+		t.Errorf("Execute() timeout = %v, want 30s", p.State.WaitActionDuration)
+	}
+}
@@ -31,6 +31,7 @@ func (v *V1) AddHandlers(o cli.Options, c *config.Config, g *gin.Engine, h *hand
 		group.POST("/remove", v.Remove(c, h))
 		group.POST("/status", v.Status(c))
 		group.POST("/config", v.ConfigAPI(c))
+		group.POST("/stubs", v.Stubs())
 
 	}
 }
@@ -116,6 +117,17 @@ func (v *V1) Status(cfg *config.Config) func(*gin.Context) {
 	}
 }
 
+// Stubs returns how many times each stub has been called: the global ones
+// since trainer started, and the running plan's in this run.
+func (v *V1) Stubs() func(*gin.Context) {
+	return func(c *gin.Context) {
+		global, pl := handler.StubCalls()
+		out, _ := json.Marshal(map[string]map[string]int{"global": global, "plan": pl})
+		c.Writer.WriteHeader(200)
+		_, _ = c.Writer.Write(out)
+	}
+}
+
 // Remove removes a test
 func (v *V1) Remove(cfg *config.Config, h *handler.Handler) func(*gin.Context) {
 	return func(c *gin.Context) {
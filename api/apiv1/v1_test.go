@@ -113,6 +113,28 @@ func TestV1_Status_NoChange(t *testing.T) {
 	})
 }
 
+func TestV1_Stubs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Stubs returns the calls to the stubs", func(t *testing.T) {
+		v := &V1{}
+
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		stubsHandler := v.Stubs()
+		stubsHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]map[string]int
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Contains(t, response, "global")
+		assert.Contains(t, response, "plan")
+	})
+}
+
 func TestV1_ConfigAPI(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -0,0 +1,136 @@
+package broker
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/juju/loggo"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// AMQPTransport publishes to and consumes from an amqp broker.  The topic
+// is the routing key on the configured exchange; with no exchange, it's the
+// name of a queue.  The message key is carried as the correlation id.
+type AMQPTransport struct {
+	name     string
+	url      string
+	exchange string
+	mu       sync.Mutex
+	conn     *amqp.Connection
+	pub      *amqp.Channel
+}
+
+// NewAMQPTransport makes an amqp transport.  It connects the first time
+// it's used.
+func NewAMQPTransport(name string, c Config) (Transport, error) {
+	if c.URL == "" {
+		return nil, errors.New("amqp needs a url")
+	}
+	return &AMQPTransport{name: name, url: c.URL, exchange: c.Exchange}, nil
+}
+
+// connection returns the connection, dialing (again) if needed.
+func (t *AMQPTransport) connection() (*amqp.Connection, error) {
+	if t.conn != nil && !t.conn.IsClosed() {
+		return t.conn, nil
+	}
+	conn, err := amqp.Dial(t.url)
+	if err != nil {
+		return nil, err
+	}
+	t.conn = conn
+	t.pub = nil
+	return conn, nil
+}
+
+func (t *AMQPTransport) Publish(ctx context.Context, m Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	conn, err := t.connection()
+	if err != nil {
+		return err
+	}
+	if t.pub == nil || t.pub.IsClosed() {
+		t.pub, err = conn.Channel()
+		if err != nil {
+			return err
+		}
+	}
+	hdrs := amqp.Table{}
+	for k, v := range m.Headers {
+		hdrs[k] = v
+	}
+	return t.pub.PublishWithContext(ctx, t.exchange, m.Topic, false, false, amqp.Publishing{
+		Headers:       hdrs,
+		CorrelationId: m.Key,
+		Timestamp:     m.Time,
+		Body:          m.Body,
+	})
+}
+
+func (t *AMQPTransport) Subscribe(topic string, deliver func(Message)) error {
+	logger := loggo.GetLogger("default")
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	conn, err := t.connection()
+	if err != nil {
+		return err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	queue := topic
+	if t.exchange != "" {
+		q, err := ch.QueueDeclare("", false, true, true, false, nil)
+		if err != nil {
+			ch.Close()
+			return err
+		}
+		err = ch.QueueBind(q.Name, topic, t.exchange, false, nil)
+		if err != nil {
+			ch.Close()
+			return fmt.Errorf("binding to %s: %w", t.exchange, err)
+		}
+		queue = q.Name
+	}
+	deliveries, err := ch.Consume(queue, "", true, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return err
+	}
+
+	go func() {
+		for d := range deliveries {
+			m := Message{
+				Topic:   topic,
+				Key:     d.CorrelationId,
+				Body:    d.Body,
+				Headers: make(map[string]string),
+				Time:    d.Timestamp,
+			}
+			for k, v := range d.Headers {
+				m.Headers[k] = fmt.Sprint(v)
+			}
+			deliver(m)
+		}
+		logger.Debugf("broker %s: stopped consuming %s", t.name, topic)
+	}()
+	return nil
+}
+
+func (t *AMQPTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil || t.conn.IsClosed() {
+		return nil
+	}
+	return t.conn.Close()
+}
@@ -0,0 +1,299 @@
+package broker
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+/*
+Package broker connects trainer to message brokers, so that tests can
+publish messages and wait for the ones a service sends.
+
+A Broker wraps a Transport (kafka, amqp, or an in-memory one for tests)
+and keeps the messages it receives on each topic it's subscribed to until
+they're consumed.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/juju/loggo"
+)
+
+// DefaultBufferSize is how many unconsumed messages are kept for each
+// topic, unless told otherwise.  When it's full, the oldest are dropped.
+const DefaultBufferSize = 1000
+
+// Message is a message sent to or received from a broker.
+type Message struct {
+	Topic   string
+	Key     string
+	Body    []byte
+	Headers map[string]string
+	Time    time.Time
+}
+
+// Config is a broker, as declared in the config file.
+type Config struct {
+	Type       string   `yaml:"type" json:"type"`               // kafka, amqp or memory
+	URL        string   `yaml:"url" json:"url"`                 // amqp
+	Addresses  []string `yaml:"addresses" json:"addresses"`     // kafka
+	Group      string   `yaml:"group" json:"group"`             // kafka consumer group
+	Exchange   string   `yaml:"exchange" json:"exchange"`       // amqp
+	Topics     []string `yaml:"topics" json:"topics"`           // subscribed to at startup
+	BufferSize int      `yaml:"buffer_size" json:"buffer_size"` // unconsumed messages kept per topic
+}
+
+// Redacted returns the config with the password in the url hidden, so that
+// it can be shown.  A url that can't be parsed is left out altogether.
+func (c Config) Redacted() Config {
+	if c.URL == "" {
+		return c
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		c.URL = ""
+		return c
+	}
+	c.URL = u.Redacted()
+	return c
+}
+
+// brokerConfig is a Config without the marshalers, so they don't call
+// themselves.
+type brokerConfig Config
+
+// MarshalYAML hides the password in the url, so the config endpoint doesn't
+// give it away.
+func (c Config) MarshalYAML() (interface{}, error) {
+	return brokerConfig(c.Redacted()), nil
+}
+
+// MarshalJSON does the same for json.
+func (c Config) MarshalJSON() ([]byte, error) {
+	return json.Marshal(brokerConfig(c.Redacted()))
+}
+
+// Transport is what actually talks to the broker.  Subscribe delivers the
+// messages it receives to deliver, in the background, until the transport is
+// closed.
+type Transport interface {
+	Publish(ctx context.Context, m Message) error
+	Subscribe(topic string, deliver func(Message)) error
+	Close() error
+}
+
+// TransportFactory makes a transport from a broker's config.
+type TransportFactory func(name string, c Config) (Transport, error)
+
+var transports = struct {
+	sync.RWMutex
+	m map[string]TransportFactory
+}{m: map[string]TransportFactory{
+	"memory": NewMemoryTransport,
+	"kafka":  NewKafkaTransport,
+	"amqp":   NewAMQPTransport,
+}}
+
+// RegisterTransport adds a kind of transport, for brokers other than the
+// ones trainer knows about.
+func RegisterTransport(t string, f TransportFactory) error {
+	transports.Lock()
+	defer transports.Unlock()
+	if _, ok := transports.m[t]; ok {
+		return fmt.Errorf("transport %s is already registered", t)
+	}
+	transports.m[t] = f
+	return nil
+}
+
+// Broker is a connection to a broker, along with the messages that have
+// been received on its topics and not consumed yet.
+type Broker struct {
+	Name      string
+	transport Transport
+	size      int
+	mu        sync.Mutex
+	topics    map[string][]Message
+}
+
+// New makes a broker from a transport.
+func New(name string, t Transport, size int) *Broker {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	return &Broker{
+		Name:      name,
+		transport: t,
+		size:      size,
+		topics:    make(map[string][]Message),
+	}
+}
+
+// Publish sends a message.
+func (b *Broker) Publish(ctx context.Context, m Message) error {
+	if m.Time.IsZero() {
+		m.Time = time.Now()
+	}
+	return b.transport.Publish(ctx, m)
+}
+
+// Subscribe starts keeping the messages received on a topic.  It's fine to
+// call it more than once.
+func (b *Broker) Subscribe(topic string) error {
+	b.mu.Lock()
+	if _, ok := b.topics[topic]; ok {
+		b.mu.Unlock()
+		return nil
+	}
+	b.topics[topic] = make([]Message, 0)
+	b.mu.Unlock()
+
+	err := b.transport.Subscribe(topic, b.receive)
+	if err != nil {
+		b.mu.Lock()
+		delete(b.topics, topic)
+		b.mu.Unlock()
+		return fmt.Errorf("subscribing to %s: %w", topic, err)
+	}
+	return nil
+}
+
+func (b *Broker) receive(m Message) {
+	logger := loggo.GetLogger("default")
+	if m.Time.IsZero() {
+		m.Time = time.Now()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	l := append(b.topics[m.Topic], m)
+	if len(l) > b.size {
+		logger.Warningf("broker %s: dropping %d messages from %s", b.Name, len(l)-b.size, m.Topic)
+		l = l[len(l)-b.size:]
+	}
+	b.topics[m.Topic] = l
+	logger.Tracef("broker %s: received message on %s", b.Name, m.Topic)
+}
+
+// Take removes and returns the oldest message on a topic that matches.  It
+// returns nil if there isn't one yet.
+func (b *Broker) Take(topic string, match func(Message) (bool, error)) (*Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	l, ok := b.topics[topic]
+	if !ok {
+		return nil, fmt.Errorf("not subscribed to %s", topic)
+	}
+	for i, m := range l {
+		ok, err := match(m)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			b.topics[topic] = append(l[:i:i], l[i+1:]...)
+			return &m, nil
+		}
+	}
+	return nil, nil
+}
+
+// Pending returns how many messages are waiting on a topic.
+func (b *Broker) Pending(topic string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.topics[topic])
+}
+
+// Close closes the transport.
+func (b *Broker) Close() error {
+	return b.transport.Close()
+}
+
+var brokers = struct {
+	sync.RWMutex
+	m map[string]*Broker
+}{m: make(map[string]*Broker)}
+
+// Open makes a broker from its config, subscribes to its topics and makes
+// it available to the actions by name.
+func Open(name string, c Config) (*Broker, error) {
+	transports.RLock()
+	f, ok := transports.m[c.Type]
+	transports.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("broker %s: unknown type %s", name, c.Type)
+	}
+	t, err := f(name, c)
+	if err != nil {
+		return nil, fmt.Errorf("broker %s: %w", name, err)
+	}
+	b := New(name, t, c.BufferSize)
+	for _, topic := range c.Topics {
+		if err := b.Subscribe(topic); err != nil {
+			b.Close()
+			return nil, fmt.Errorf("broker %s: %w", name, err)
+		}
+	}
+	if err := Register(b); err != nil {
+		b.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// Register makes a broker available to the actions by name.
+func Register(b *Broker) error {
+	brokers.Lock()
+	defer brokers.Unlock()
+	if _, ok := brokers.m[b.Name]; ok {
+		return fmt.Errorf("broker %s is already registered", b.Name)
+	}
+	brokers.m[b.Name] = b
+	return nil
+}
+
+// Get returns a broker by name.
+func Get(name string) (*Broker, error) {
+	if name == "" {
+		return nil, errors.New("broker name is empty")
+	}
+	brokers.RLock()
+	defer brokers.RUnlock()
+	b, ok := brokers.m[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown broker %s", name)
+	}
+	return b, nil
+}
+
+// Names returns the names of the registered brokers, sorted.
+func Names() []string {
+	brokers.RLock()
+	defer brokers.RUnlock()
+	out := make([]string, 0, len(brokers.m))
+	for k := range brokers.m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// CloseAll closes and forgets every broker.
+func CloseAll() {
+	logger := loggo.GetLogger("default")
+	brokers.Lock()
+	defer brokers.Unlock()
+	for k, b := range brokers.m {
+		if err := b.Close(); err != nil {
+			logger.Warningf("closing broker %s: %s", k, err)
+		}
+		delete(brokers.m, k)
+	}
+}
@@ -0,0 +1,121 @@
+package broker
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/juju/loggo"
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaTransport publishes to and consumes from kafka.  Consumers join the
+// configured group (trainer-<broker name> by default), and start from the
+// newest messages the first time the group is used.
+type KafkaTransport struct {
+	name    string
+	group   string
+	addrs   []string
+	writer  *kafka.Writer
+	mu      sync.Mutex
+	readers []*kafka.Reader
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// NewKafkaTransport makes a kafka transport.  Nothing is connected until
+// it's used.
+func NewKafkaTransport(name string, c Config) (Transport, error) {
+	if len(c.Addresses) == 0 {
+		return nil, errors.New("kafka needs addresses")
+	}
+	group := c.Group
+	if group == "" {
+		group = "trainer-" + name
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &KafkaTransport{
+		name:  name,
+		group: group,
+		addrs: c.Addresses,
+		writer: &kafka.Writer{
+			Addr:     kafka.TCP(c.Addresses...),
+			Balancer: &kafka.Hash{},
+		},
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+func (t *KafkaTransport) Publish(ctx context.Context, m Message) error {
+	km := kafka.Message{
+		Topic: m.Topic,
+		Value: m.Body,
+		Time:  m.Time,
+	}
+	if m.Key != "" {
+		km.Key = []byte(m.Key)
+	}
+	for k, v := range m.Headers {
+		km.Headers = append(km.Headers, kafka.Header{Key: k, Value: []byte(v)})
+	}
+	return t.writer.WriteMessages(ctx, km)
+}
+
+func (t *KafkaTransport) Subscribe(topic string, deliver func(Message)) error {
+	logger := loggo.GetLogger("default")
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     t.addrs,
+		GroupID:     t.group,
+		Topic:       topic,
+		StartOffset: kafka.LastOffset,
+	})
+	t.mu.Lock()
+	t.readers = append(t.readers, r)
+	t.mu.Unlock()
+
+	go func() {
+		for {
+			km, err := r.ReadMessage(t.ctx)
+			if err != nil {
+				if t.ctx.Err() != nil {
+					return
+				}
+				logger.Warningf("broker %s: reading %s: %s", t.name, topic, err)
+				time.Sleep(time.Second)
+				continue
+			}
+			m := Message{
+				Topic:   km.Topic,
+				Key:     string(km.Key),
+				Body:    km.Value,
+				Headers: make(map[string]string),
+				Time:    km.Time,
+			}
+			for _, h := range km.Headers {
+				m.Headers[h.Key] = string(h.Value)
+			}
+			deliver(m)
+		}
+	}()
+	return nil
+}
+
+func (t *KafkaTransport) Close() error {
+	t.cancel()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var errs []error
+	for _, r := range t.readers {
+		errs = append(errs, r.Close())
+	}
+	t.readers = nil
+	errs = append(errs, t.writer.Close())
+	return errors.Join(errs...)
+}
@@ -0,0 +1,56 @@
+package broker
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// MemoryTransport delivers messages within the process.  It's meant for
+// tests, where the code under test publishes to (or consumes from) the
+// broker directly.
+type MemoryTransport struct {
+	mu     sync.RWMutex
+	subs   map[string][]func(Message)
+	closed bool
+}
+
+// NewMemoryTransport makes an in-memory transport.  The config is ignored.
+func NewMemoryTransport(name string, c Config) (Transport, error) {
+	return &MemoryTransport{subs: make(map[string][]func(Message))}, nil
+}
+
+func (t *MemoryTransport) Publish(ctx context.Context, m Message) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return errors.New("transport is closed")
+	}
+	for _, f := range t.subs[m.Topic] {
+		f(m)
+	}
+	return nil
+}
+
+func (t *MemoryTransport) Subscribe(topic string, deliver func(Message)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return errors.New("transport is closed")
+	}
+	t.subs[topic] = append(t.subs[topic], deliver)
+	return nil
+}
+
+func (t *MemoryTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	t.subs = make(map[string][]func(Message))
+	return nil
+}
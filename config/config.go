@@ -7,9 +7,13 @@ package config
 
 import (
 	"errors"
+	"github.com/homedepot/trainer/broker"
 	"github.com/homedepot/trainer/security"
+	"github.com/homedepot/trainer/structs/database"
 	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/plugin"
 	"github.com/homedepot/trainer/structs/state"
+	"github.com/homedepot/trainer/structs/stub"
 	"github.com/homedepot/trainer/structs/transaction"
 	"github.com/juju/loggo"
 	"github.com/mohae/deepcopy"
@@ -23,10 +27,14 @@ import (
 // be added to Bases, whether the Config data contains
 // additional base URLs in its Bases map or not.
 type Config struct {
-	DefaultPlan  string            `yaml:"default_plan" json:"default_plan"`
-	Plans        []plan.Plan       `yaml:"plan" json:"plan"`
-	PlanIncludes []string          `yaml:"planinclude" json:"planinclude"`
-	Bases        map[string]string `yaml:"bases" json:"bases"`
+	DefaultPlan  string                       `yaml:"default_plan" json:"default_plan"`
+	Plans        []plan.Plan                  `yaml:"plan" json:"plan"`
+	PlanIncludes []string                     `yaml:"planinclude" json:"planinclude"`
+	Bases        map[string]string            `yaml:"bases" json:"bases"`
+	Plugins      []plugin.Plugin              `yaml:"plugins" json:"plugins"`
+	Brokers      map[string]broker.Config     `yaml:"brokers" json:"brokers"`
+	Databases    map[string]database.Database `yaml:"databases" json:"databases"`
+	Stubs        []stub.Stub                  `yaml:"stubs" json:"stubs"`
 }
 
 // NewConfig creates a new configuration given
@@ -84,6 +92,16 @@ func NewConfig(cfile string, tm bool, tURL string, bases map[string]string) (*Co
 	return &config, nil
 }
 
+// validators check the parts of a config that the config package doesn't
+// know about, like action types.  They're run at the end of ValidateConfig.
+var validators []func(*Config) error
+
+// AddValidator adds a check that's run on every config that's loaded.  It's
+// meant to be called from an init function.
+func AddValidator(f func(*Config) error) {
+	validators = append(validators, f)
+}
+
 // Validate config validates Config.
 // See Issue #21
 // TODO resolve issues (based upon schema file of some kind)
@@ -115,10 +133,10 @@ func (c *Config) ValidateConfig() error {
 			// response data, we're currently just skipping
 			// them. Iteratively, we will add validation to
 			// the yaml to ensure this is handled eloquently.
-			if c.Plans[i].Txn[j].OnExpected.Response == "" {
+			if !c.Plans[i].Txn[j].OnExpected.HasBody() {
 				continue
 			}
-			if c.Plans[i].Txn[j].OnUnexpected.Response == "" {
+			if !c.Plans[i].Txn[j].OnUnexpected.HasBody() {
 				continue
 			}
 
@@ -127,6 +145,11 @@ func (c *Config) ValidateConfig() error {
 
 		}
 	}
+	for _, f := range validators {
+		if err := f(c); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,88 @@
+package config_test
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/homedepot/trainer/actions"
+	"github.com/homedepot/trainer/config"
+)
+
+func TestNewConfig_ValidatesActions(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "known action",
+			config: `plan:
+  - name: ok
+    txn:
+      - name: first
+        init_action:
+          - type: log
+            args:
+              value: hello
+`,
+		},
+		{
+			name: "unknown action",
+			config: `plan:
+  - name: bad
+    txn:
+      - name: first
+        init_action:
+          - type: frobnicate
+`,
+			wantErr: "unknown action type frobnicate",
+		},
+		{
+			name: "plugin action",
+			config: `plugins:
+  - name: config_test_plugin
+    command: "true"
+plan:
+  - name: ok
+    txn:
+      - name: first
+        init_action:
+          - type: config_test_plugin
+`,
+		},
+		{
+			name: "bad stub",
+			config: `stubs:
+  - name: health
+    response_code: "200"
+    body: ok
+`,
+			wantErr: "no url",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := filepath.Join(t.TempDir(), "config.yml")
+			if err := os.WriteFile(f, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := config.NewConfig(f, false, "", nil)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("NewConfig() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewConfig() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
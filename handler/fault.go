@@ -0,0 +1,98 @@
+package handler
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"github.com/homedepot/trainer/actions"
+	"github.com/homedepot/trainer/structs/expected"
+	"github.com/juju/loggo"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// PickFault works out the fault for a response, if there is one.  A fault
+// in the on_expected or on_unexpected wins over the url action's.
+func PickFault(e expected.Expected, arg interface{}, r *rand.Rand) (*expected.Injection, error) {
+	f := e.Fault
+	if f == nil {
+		var err error
+		f, err = actions.LoadFault(arg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if f == nil {
+		return nil, nil
+	}
+	return f.Pick(r)
+}
+
+// WriteFault sends the response with the fault injected into it.  It can
+// take a while, so it shouldn't be run from the runner.
+func (r *Response) WriteFault(w http.ResponseWriter, in *expected.Injection) {
+	logger := loggo.GetLogger("default")
+	time.Sleep(in.Delay)
+
+	if in.Reset || in.Empty {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			logger.Warningf("can't take over the connection, sending the response instead")
+			r.Write(w)
+			return
+		}
+		conn, _, err := hj.Hijack()
+		if err != nil {
+			logger.Warningf("can't take over the connection, sending the response instead: %s", err)
+			r.Write(w)
+			return
+		}
+		if tc, ok := conn.(*net.TCPConn); ok && in.Reset {
+			// closing without lingering sends a reset instead of a fin.
+			tc.SetLinger(0)
+		}
+		conn.Close()
+		return
+	}
+
+	code, body := r.Code, r.Body
+	if in.ErrorCode != 0 {
+		code, body = in.ErrorCode, nil
+	}
+	for k, v := range r.Headers {
+		w.Header().Set(k, v)
+	}
+	if in.Truncate >= 0 {
+		// promising the whole body and sending less makes the server drop
+		// the connection, so the client sees the body cut off.
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		if in.Truncate < len(body) {
+			body = body[:in.Truncate]
+		}
+	}
+	w.WriteHeader(code)
+	if in.ChunkSize == 0 {
+		w.Write(body)
+		return
+	}
+	// without a Content-Length, the pieces go out as http chunks.
+	for len(body) > 0 {
+		n := in.ChunkSize
+		if n > len(body) {
+			n = len(body)
+		}
+		w.Write(body[:n])
+		body = body[n:]
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		if len(body) > 0 {
+			time.Sleep(in.ChunkDelay)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package handler
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homedepot/trainer/actions"
+	"github.com/homedepot/trainer/structs/expected"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/planaction"
+	"github.com/homedepot/trainer/structs/state"
+	"github.com/homedepot/trainer/structs/transaction"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponse_WriteFault(t *testing.T) {
+	resp := &Response{Code: 200, Headers: map[string]string{"Content-Type": "text/plain"}, Body: []byte("hello, world")}
+	tests := []struct {
+		name     string
+		in       expected.Injection
+		wantCode int
+		wantBody string
+		chunked  bool
+		minTime  time.Duration
+		wantErr  bool
+	}{
+		{name: "none", in: expected.Injection{Truncate: -1}, wantCode: 200, wantBody: "hello, world"},
+		{name: "delay", in: expected.Injection{Truncate: -1, Delay: 50 * time.Millisecond}, wantCode: 200, wantBody: "hello, world", minTime: 50 * time.Millisecond},
+		{name: "error code", in: expected.Injection{Truncate: -1, ErrorCode: 503}, wantCode: 503},
+		{
+			name: "slow chunks", in: expected.Injection{Truncate: -1, ChunkSize: 5, ChunkDelay: 20 * time.Millisecond},
+			wantCode: 200, wantBody: "hello, world", chunked: true, minTime: 40 * time.Millisecond,
+		},
+		{name: "truncate", in: expected.Injection{Truncate: 5}, wantCode: 200, wantBody: "hello", wantErr: true},
+		{name: "reset", in: expected.Injection{Truncate: -1, Reset: true}, wantErr: true},
+		{name: "empty", in: expected.Injection{Truncate: -1, Empty: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				resp.WriteFault(w, &tt.in)
+			}))
+			defer srv.Close()
+
+			start := time.Now()
+			res, err := http.Get(srv.URL)
+			if err != nil {
+				if !tt.wantErr {
+					t.Fatalf("Get() error = %v", err)
+				}
+				return
+			}
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("reading the body error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.wantCode, res.StatusCode, "Should send the right code")
+			assert.Equal(t, tt.wantBody, string(body), "Should send the right body")
+			assert.Equal(t, tt.chunked, len(res.TransferEncoding) > 0, "Should only chunk when asked")
+			assert.GreaterOrEqual(t, time.Since(start), tt.minTime, "Should take long enough")
+		})
+	}
+}
+
+func TestProcessTests_Fault(t *testing.T) {
+	// Save original state
+	originalTst := tst.tst
+	originalProcessing := tst.processing
+	defer func() {
+		tst.tst = originalTst
+		tst.processing = originalProcessing
+	}()
+	gin.SetMode(gin.TestMode)
+
+	done := []planaction.PlanAction{{Type: "advance", Args: map[string]interface{}{"txn": "done"}}}
+	tests := []struct {
+		name      string
+		args      map[string]interface{}
+		e         expected.Expected
+		wantCode  int
+		wantFault string
+	}{
+		{
+			name:      "url action",
+			args:      map[string]interface{}{"url": "/orders", "fault": map[interface{}]interface{}{"error_code": 503}},
+			e:         expected.Expected{ResponseCode: "200", Body: "ok", Action: done},
+			wantCode:  503,
+			wantFault: "error_code 503",
+		},
+		{
+			name:      "on_expected wins",
+			args:      map[string]interface{}{"url": "/orders", "fault": map[interface{}]interface{}{"error_code": 503}},
+			e:         expected.Expected{ResponseCode: "200", Body: "ok", Action: done, Fault: &expected.Fault{ErrorCode: 429}},
+			wantCode:  429,
+			wantFault: "error_code 429",
+		},
+		{
+			name:     "never",
+			args:     map[string]interface{}{"url": "/orders", "fault": map[interface{}]interface{}{"error_code": 503, "probability": 0}},
+			e:        expected.Expected{ResponseCode: "200", Body: "ok", Action: done},
+			wantCode: 200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tst.tst = &plan.Plan{
+				State: &state.State{
+					Transaction: "a",
+					Seed:        1,
+					Variables:   map[string]interface{}{},
+					States:      []state.StateEntry{{TxnName: "a", Status: "running"}},
+				},
+				Txn: []transaction.Transaction{{
+					Name:         "a",
+					InitAction:   []planaction.PlanAction{{Type: "url", Args: tt.args}},
+					OnExpected:   tt.e,
+					OnUnexpected: expected.Expected{ResponseCode: "400", Body: "", Action: done},
+				}, {Name: "done"}},
+			}
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "/orders", strings.NewReader(""))
+			qc := &actions.QueueContext{Ctx: c, Finished: make(chan bool, 1)}
+			q.Add(qc)
+
+			ProcessTests(make(chan *bool, 1))
+			select {
+			case <-qc.Finished:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Should finish the request")
+			}
+
+			assert.Nil(t, tst.tst.State.Err, "Should not error")
+			assert.Equal(t, "done", tst.tst.State.Transaction, "Should advance")
+			assert.Equal(t, tt.wantCode, w.Code, "Should send the right code")
+			if tt.wantFault == "" {
+				assert.Empty(t, tst.tst.State.Faults, "Should not note a fault")
+				return
+			}
+			if assert.Len(t, tst.tst.State.Faults, 1, "Should note the fault") {
+				f := tst.tst.State.Faults[0]
+				assert.Equal(t, tt.wantFault, f.Fault, "Should describe the fault")
+				assert.Equal(t, "a", f.Txn, "Should note the transaction")
+				assert.Equal(t, "/orders", f.Path, "Should note the path")
+			}
+		})
+	}
+}
@@ -37,6 +37,11 @@ func (h *Handler) Add(c *gin.Context) {
 		return
 	}
 
+	// stubs are answered straight away, whether there's a test or not.
+	if ServeStub(c) {
+		return
+	}
+
 	if tst.tst == nil {
 		c.Writer.WriteHeader(500)
 		c.Writer.Write([]byte("no test in progress"))
@@ -65,18 +70,25 @@ func (h *Handler) Stop() {
 
 func (h *Handler) Reset() {
 	logger := loggo.GetLogger("default")
-	for {
-		if tst.processing == true {
-			time.Sleep(50 * time.Millisecond)
-			continue
-		}
-		break
-	}
+	// wait for the runner to finish what it's doing.
+	tst.run.Lock()
+	tst.run.Unlock()
 	logger.Tracef("resetting...")
 	abort := true
 	h.abort <- &abort
 	// TODO:  need a better way to make sure the abort has completed, this is terrible.
 	logger.Tracef("reset.")
 	time.Sleep(2 * time.Second)
+	if tst.tst != nil && len(tst.tst.Teardown) > 0 {
+		// the runner does the teardown, this just waits for it.
+		select {
+		case <-tst.startRemove():
+		case <-time.After(TeardownTimeout):
+			logger.Warningf("teardown didn't finish in %s, removing anyway", TeardownTimeout)
+			tst.finishRemove()
+		}
+	}
+	tst.run.Lock()
 	tst.tst = nil
+	tst.run.Unlock()
 }
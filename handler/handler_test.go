@@ -146,7 +146,7 @@ func TestHandler_Reset_WaitsForProcessing(t *testing.T) {
 	tst.tst = &plan.Plan{
 		State: &state.State{},
 	}
-	tst.processing = true
+	tst.run.Lock()
 
 	// Start reset in a goroutine
 	done := make(chan bool)
@@ -157,7 +157,12 @@ func TestHandler_Reset_WaitsForProcessing(t *testing.T) {
 
 	// Simulate processing finishing
 	time.Sleep(100 * time.Millisecond)
-	tst.processing = false
+	select {
+	case <-done:
+		t.Fatal("Reset should wait for the processing to finish")
+	default:
+	}
+	tst.run.Unlock()
 
 	// Wait for reset to complete
 	select {
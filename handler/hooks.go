@@ -0,0 +1,143 @@
+package handler
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"fmt"
+	"github.com/homedepot/trainer/actions"
+	"github.com/homedepot/trainer/structs/state"
+	"github.com/homedepot/trainer/structs/transaction"
+	"github.com/juju/loggo"
+	"time"
+)
+
+// TeardownTimeout is how long a remove waits for the teardown transactions
+// to finish before giving up on them.
+var TeardownTimeout = 30 * time.Second
+
+// RunHooks runs setup or teardown transactions, picking up where it left off
+// last time.  It returns true once they've all been run.  An error stops the
+// setup, but the teardown carries on with the next transaction, so that as
+// much as possible gets cleaned up.
+func RunHooks(kind string, txns []transaction.Transaction, hs *state.HookState, stopOnError bool) bool {
+	logger := loggo.GetLogger("default")
+	for hs.Index < len(txns) {
+		t := &txns[hs.Index]
+		if len(hs.States) == hs.Index {
+			logger.Infof("Running %s transaction %s", kind, t.Name)
+			hs.States = append(hs.States, state.StateEntry{TxnName: t.Name, Status: "pending"})
+		}
+		entry := &hs.States[hs.Index]
+		for hs.ActionIdx < len(t.InitAction) {
+			pa := &t.InitAction[hs.ActionIdx]
+			action, res := actions.Execute(pa.Type, pa.Args, tst.tst)
+			if res.Err != nil {
+				logger.Warningf("Error running %s action %s: %s", kind, pa.Type, res.Err)
+				entry.Status = "errored"
+				if hs.Err == "" {
+					hs.Err = fmt.Sprintf("%s: %s: %s", t.Name, pa.Type, res.Err)
+				}
+				actions.FinishWait(tst.tst)
+				if stopOnError {
+					hs.Status = "errored"
+					return true
+				}
+				break
+			}
+			if action.CanBackground() {
+				tst.bgActions = append(tst.bgActions, action)
+			}
+			if !res.Complete {
+				entry.Status = "waiting"
+				return false
+			}
+			if res.Advance {
+				logger.Debugf("%s transactions run in order, not advancing to %s", kind, res.NewTxn)
+			}
+			hs.ActionIdx++
+		}
+		if entry.Status != "errored" {
+			entry.Status = "completed"
+		}
+		hs.Index++
+		hs.ActionIdx = 0
+	}
+	if hs.Err != "" {
+		hs.Status = "errored"
+	} else {
+		hs.Status = "completed"
+	}
+	return true
+}
+
+// ProcessSetup runs the setup transactions, then starts the main run.  If
+// the setup fails, the main run is skipped and it's straight on to the
+// teardown.
+func ProcessSetup() {
+	s := tst.tst.State
+	if !RunHooks("setup", tst.tst.Setup, s.Setup, true) {
+		return
+	}
+	if s.Setup.Status == "errored" {
+		EndRun(state.ResultSkipped)
+		return
+	}
+	s.StartRun()
+}
+
+// EndRun records how the main run ended, and starts the teardown if there
+// is one.
+func EndRun(result string) {
+	logger := loggo.GetLogger("default")
+	p := tst.tst
+	s := p.State
+	if result == state.ResultStopped {
+		// a run that got to the end still fails if its stubs weren't
+		// called the way it expected.
+		SyncStubs()
+		if err := CheckStubs(p); err != nil {
+			logger.Warningf("%s", err)
+			s.Err = err
+			result = state.ResultErrored
+		}
+	}
+	logger.Infof("Run ended: %s", result)
+	s.Result = result
+	if len(p.Teardown) == 0 {
+		s.Phase = state.PhaseFinished
+		return
+	}
+	for _, v := range tst.bgActions {
+		logger.Debugf("aborting action %s before teardown", v.GetName())
+		v.Abort()
+	}
+	tst.bgActions = make([]actions.Action, 0)
+	s.ClearInFlight()
+	s.Phase = state.PhaseTeardown
+	s.Teardown = &state.HookState{Status: "running"}
+}
+
+// ProcessTeardown runs the teardown transactions.
+func ProcessTeardown() {
+	s := tst.tst.State
+	if RunHooks("teardown", tst.tst.Teardown, s.Teardown, false) {
+		s.Phase = state.PhaseFinished
+	}
+}
+
+// TimedOut returns whether the main run has gone on longer than the plan's
+// timeout.
+func TimedOut() bool {
+	p := tst.tst
+	if p.Timeout == "" || p.State.Started.IsZero() {
+		return false
+	}
+	d, err := time.ParseDuration(p.Timeout)
+	if err != nil {
+		return false
+	}
+	return time.Since(p.State.Started) > d
+}
@@ -0,0 +1,214 @@
+package handler
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"testing"
+	"time"
+
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/planaction"
+	"github.com/homedepot/trainer/structs/state"
+	"github.com/homedepot/trainer/structs/transaction"
+	"github.com/stretchr/testify/assert"
+)
+
+func hookTxn(name, variable string) transaction.Transaction {
+	return transaction.Transaction{Name: name, InitAction: []planaction.PlanAction{
+		{Type: "set", Args: map[string]interface{}{"variable": variable, "value": true}},
+	}}
+}
+
+func TestProcessTests_SetupTeardown(t *testing.T) {
+	// Save original state
+	originalTst := tst.tst
+	originalProcessing := tst.processing
+	defer func() {
+		tst.tst = originalTst
+		tst.processing = originalProcessing
+		tst.finishRemove()
+	}()
+
+	fail := transaction.Transaction{Name: "broken", InitAction: []planaction.PlanAction{{Type: "log"}}}
+	wait := transaction.Transaction{Name: "slow", InitAction: []planaction.PlanAction{
+		{Type: "wait", Args: map[string]interface{}{"duration": "10ms"}},
+	}}
+	tests := []struct {
+		name         string
+		setup        []transaction.Transaction
+		teardown     []transaction.Transaction
+		main         []planaction.PlanAction
+		timeout      string
+		removing     bool
+		passes       int
+		wantPhase    string
+		wantResult   string
+		wantSetup    string
+		wantTeardown string
+		wantVars     []string
+	}{
+		{
+			name:      "setup then run",
+			setup:     []transaction.Transaction{hookTxn("create", "created")},
+			passes:    1,
+			wantPhase: state.PhaseRun,
+			wantSetup: "completed",
+			wantVars:  []string{"created"},
+		},
+		{
+			name:         "stop runs teardown",
+			setup:        []transaction.Transaction{hookTxn("create", "created")},
+			teardown:     []transaction.Transaction{hookTxn("clean", "cleaned")},
+			main:         []planaction.PlanAction{{Type: "set", Args: map[string]interface{}{"variable": "finished", "value": true}}},
+			passes:       4,
+			wantPhase:    state.PhaseFinished,
+			wantResult:   state.ResultStopped,
+			wantSetup:    "completed",
+			wantTeardown: "completed",
+			wantVars:     []string{"created", "cleaned"},
+		},
+		{
+			name:         "error runs teardown",
+			teardown:     []transaction.Transaction{hookTxn("clean", "cleaned")},
+			main:         []planaction.PlanAction{{Type: "log"}},
+			passes:       3,
+			wantPhase:    state.PhaseFinished,
+			wantResult:   state.ResultErrored,
+			wantTeardown: "completed",
+			wantVars:     []string{"cleaned"},
+		},
+		{
+			name:         "failed setup skips the run",
+			setup:        []transaction.Transaction{fail, hookTxn("create", "created")},
+			teardown:     []transaction.Transaction{hookTxn("clean", "cleaned")},
+			passes:       2,
+			wantPhase:    state.PhaseFinished,
+			wantResult:   state.ResultSkipped,
+			wantSetup:    "errored",
+			wantTeardown: "completed",
+			wantVars:     []string{"cleaned"},
+		},
+		{
+			name:         "failed teardown carries on",
+			teardown:     []transaction.Transaction{fail, hookTxn("clean", "cleaned")},
+			main:         []planaction.PlanAction{{Type: "log"}},
+			passes:       3,
+			wantPhase:    state.PhaseFinished,
+			wantResult:   state.ResultErrored,
+			wantTeardown: "errored",
+			wantVars:     []string{"cleaned"},
+		},
+		{
+			name:         "teardown waits",
+			teardown:     []transaction.Transaction{wait, hookTxn("clean", "cleaned")},
+			main:         []planaction.PlanAction{{Type: "log"}},
+			passes:       3,
+			wantPhase:    state.PhaseTeardown,
+			wantResult:   state.ResultErrored,
+			wantTeardown: "running",
+		},
+		{
+			name:         "timeout",
+			teardown:     []transaction.Transaction{hookTxn("clean", "cleaned")},
+			timeout:      "1ns",
+			passes:       2,
+			wantPhase:    state.PhaseFinished,
+			wantResult:   state.ResultTimedOut,
+			wantTeardown: "completed",
+			wantVars:     []string{"cleaned"},
+		},
+		{
+			name:         "removed",
+			teardown:     []transaction.Transaction{hookTxn("clean", "cleaned")},
+			removing:     true,
+			passes:       2,
+			wantPhase:    state.PhaseFinished,
+			wantResult:   state.ResultRemoved,
+			wantTeardown: "completed",
+			wantVars:     []string{"cleaned"},
+		},
+		{
+			name:       "no teardown",
+			main:       []planaction.PlanAction{{Type: "log"}},
+			passes:     2,
+			wantPhase:  state.PhaseFinished,
+			wantResult: state.ResultErrored,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tst.tst = &plan.Plan{
+				StopVar:     "finished",
+				Timeout:     tt.timeout,
+				Setup:       tt.setup,
+				Teardown:    tt.teardown,
+				DefaultVars: map[string]interface{}{},
+				Txn: []transaction.Transaction{
+					{Name: "a", InitAction: tt.main},
+				},
+			}
+			if !assert.NoError(t, tst.tst.Reset()) {
+				return
+			}
+			var removed chan struct{}
+			if tt.removing {
+				removed = tst.startRemove()
+			}
+			abort := make(chan *bool, 1)
+			for i := 0; i < tt.passes; i++ {
+				ProcessTests(abort)
+			}
+			s := tst.tst.State
+			if removed != nil {
+				select {
+				case <-removed:
+				default:
+					t.Errorf("Should tell the remove the run has finished")
+				}
+			}
+			assert.Equal(t, tt.wantPhase, s.Phase, "Should be in the right phase")
+			assert.Equal(t, tt.wantResult, s.Result, "Should have the right result")
+			if tt.wantSetup != "" && assert.NotNil(t, s.Setup, "Should report the setup") {
+				assert.Equal(t, tt.wantSetup, s.Setup.Status, "Should have the right setup status")
+			}
+			if tt.wantTeardown != "" && assert.NotNil(t, s.Teardown, "Should report the teardown") {
+				assert.Equal(t, tt.wantTeardown, s.Teardown.Status, "Should have the right teardown status")
+			}
+			for _, v := range tt.wantVars {
+				assert.Equal(t, true, s.Variables[v], "Should have set %s", v)
+			}
+		})
+	}
+}
+
+func TestHandler_Reset_Teardown(t *testing.T) {
+	// Save original state
+	originalTst := tst.tst
+	originalTimeout := TeardownTimeout
+	defer func() {
+		tst.tst = originalTst
+		TeardownTimeout = originalTimeout
+	}()
+	TeardownTimeout = 5 * time.Second
+
+	p := &plan.Plan{
+		Teardown:    []transaction.Transaction{hookTxn("clean", "cleaned")},
+		Txn:         []transaction.Transaction{{Name: "a"}},
+		DefaultVars: map[string]interface{}{},
+	}
+	tst.tst = p
+	assert.NoError(t, p.Reset())
+
+	h := &Handler{}
+	h.Start()
+	defer h.Stop()
+	h.Reset()
+
+	assert.Nil(t, tst.tst, "Should remove the test")
+	assert.Equal(t, state.PhaseFinished, p.State.Phase, "Should finish the teardown first")
+	assert.Equal(t, state.ResultRemoved, p.State.Result, "Should record the remove")
+	assert.Equal(t, true, p.State.Variables["cleaned"], "Should run the teardown")
+}
@@ -0,0 +1,204 @@
+package handler
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/homedepot/trainer/actions"
+	"github.com/homedepot/trainer/security"
+	"github.com/homedepot/trainer/structs/expected"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/templates"
+	"github.com/juju/loggo"
+	"github.com/mitchellh/mapstructure"
+	"github.com/mohae/deepcopy"
+	"gopkg.in/yaml.v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Response is what gets sent back for a request, worked out from an
+// on_expected or on_unexpected.
+type Response struct {
+	Code    int
+	Headers map[string]string
+	Body    []byte
+}
+
+// BuildResponse works out the response for e to req.  The body and the
+// headers are templated with the plan's variables and the request.
+func BuildResponse(p *plan.Plan, e expected.Expected, req *templates.Request) (*Response, error) {
+	code, err := strconv.Atoi(e.ResponseCode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response code %s: %w", e.ResponseCode, err)
+	}
+	r := &Response{Code: code, Headers: make(map[string]string)}
+	render := func(in string) (string, error) {
+		return p.ParseRequestTemplate(in, req)
+	}
+	for k, v := range e.ResponseHeaders {
+		hv, err := render(v)
+		if err != nil {
+			return nil, fmt.Errorf("response header %s: %w", k, err)
+		}
+		r.Headers[k] = hv
+	}
+	// the content type wins over a Content-Type in the headers.
+	if e.ResponseType != "" {
+		ct, err := render(e.ResponseType)
+		if err != nil {
+			return nil, fmt.Errorf("response content type: %w", err)
+		}
+		r.Headers["Content-Type"] = ct
+	}
+
+	body, err := r.buildBody(p, e, render)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = body
+	return r, nil
+}
+
+// buildBody works out the body from whichever of the response file, body
+// and body_from_var was given.  Anything that isn't a string is written out
+// as yaml if the content type says so, and as json otherwise.
+func (r *Response) buildBody(p *plan.Plan, e expected.Expected, render func(string) (string, error)) ([]byte, error) {
+	n := 0
+	for _, set := range []bool{e.Response != "", e.Body != nil, e.BodyFromVar != ""} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		return nil, errors.New("only one of response, body and body_from_var can be given")
+	}
+
+	switch {
+	case e.Body != nil:
+		if s, ok := e.Body.(string); ok {
+			body, err := render(s)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't template response body: %w", err)
+			}
+			return []byte(body), nil
+		}
+		v, err := actions.TemplateValue(render, deepcopy.Copy(e.Body))
+		if err != nil {
+			return nil, fmt.Errorf("couldn't template response body: %w", err)
+		}
+		return r.marshal(v)
+	case e.BodyFromVar != "":
+		v, err := p.State.GetVariable(e.BodyFromVar)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get response body from %s: %w", e.BodyFromVar, err)
+		}
+		if s, ok := v.(string); ok {
+			return []byte(s), nil
+		}
+		return r.marshal(actions.StringKeys(v))
+	}
+
+	// Validate response file path to prevent path traversal
+	if err := security.ValidatePath(e.Response, ""); err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(e.Response)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read response file %s: %w", e.Response, err)
+	}
+	body, err := render(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't template response file %s: %w", e.Response, err)
+	}
+	return []byte(body), nil
+}
+
+// marshal writes out a structured body to suit the content type, and sets
+// the content type to json if there wasn't one.
+func (r *Response) marshal(v interface{}) ([]byte, error) {
+	ct := r.Headers["Content-Type"]
+	if strings.Contains(strings.ToLower(ct), "yaml") {
+		return yaml.Marshal(v)
+	}
+	if ct == "" {
+		r.Headers["Content-Type"] = "application/json"
+	}
+	return json.Marshal(v)
+}
+
+// Write sends the response.
+func (r *Response) Write(w http.ResponseWriter) {
+	for k, v := range r.Headers {
+		w.Header().Set(k, v)
+	}
+	w.WriteHeader(r.Code)
+	w.Write(r.Body)
+}
+
+// AnswerError answers a request that has been taken off the queue but
+// can't be answered the usual way, so that the caller isn't left waiting.
+func AnswerError(ctx *actions.QueueContext, err error) {
+	r := &Response{
+		Code:    http.StatusInternalServerError,
+		Headers: map[string]string{"Content-Type": "text/plain"},
+		Body:    []byte(err.Error()),
+	}
+	r.Write(ctx.Ctx.Writer)
+	ctx.Finished <- true
+}
+
+// OverrideExpected decodes an on_expected override, from a satisfy group or
+// a url rule, over e.  A bad override is logged and leaves e as it was.
+func OverrideExpected(e *expected.Expected, o interface{}) {
+	logger := loggo.GetLogger("default")
+	var m mapstructure.Metadata
+	// e is usually a copy of the transaction's on_expected, so the override
+	// mustn't write into the transaction's headers.
+	e.ResponseHeaders = CopyHeaders(e.ResponseHeaders)
+	if om, ok := actions.StringKeys(o).(map[string]interface{}); ok {
+		// a body in the override replaces the transaction's, whichever kind
+		// it is.
+		for _, k := range []string{"response", "body", "body_from_var"} {
+			if _, ok := om[k]; ok {
+				e.Response, e.Body, e.BodyFromVar = "", nil, ""
+				break
+			}
+		}
+		// and so do actions and faults, which would otherwise be decoded into
+		// the transaction's own.
+		if _, ok := om["action"]; ok {
+			e.Action = nil
+		}
+		if _, ok := om["fault"]; ok {
+			e.Fault = nil
+		}
+	}
+	err := mapstructure.DecodeMetadata(o, e, &m)
+	if err != nil {
+		logger.Warningf("Could not decode on_expected, defaulting to transaction: %s", err)
+	}
+	if len(m.Unused) > 0 {
+		logger.Warningf("Unused keys in mapstructure decode: %+v", m.Unused)
+	}
+}
+
+// CopyHeaders returns a copy of a header map, so that it can be changed
+// without changing the original.
+func CopyHeaders(h map[string]string) map[string]string {
+	if h == nil {
+		return nil
+	}
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		out[k] = v
+	}
+	return out
+}
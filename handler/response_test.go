@@ -0,0 +1,530 @@
+package handler
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homedepot/trainer/actions"
+	"github.com/homedepot/trainer/structs/expected"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/planaction"
+	"github.com/homedepot/trainer/structs/state"
+	"github.com/homedepot/trainer/structs/transaction"
+	"github.com/homedepot/trainer/templates"
+	"github.com/stretchr/testify/assert"
+)
+
+// responseFile writes a response file for a test.
+func responseFile(t *testing.T, body string) string {
+	f := filepath.Join(t.TempDir(), "response.json")
+	if err := os.WriteFile(f, []byte(body), 0644); err != nil {
+		t.Fatalf("couldn't write response file: %s", err)
+	}
+	return f
+}
+
+func TestBuildResponse(t *testing.T) {
+	file := responseFile(t, `{"id": "<<.Variables.id>>"}`)
+	tests := []struct {
+		name     string
+		e        expected.Expected
+		wantCode int
+		wantBody string
+		headers  map[string]string
+		req      *templates.Request
+		wantErr  bool
+	}{
+		{
+			name:     "code and body",
+			e:        expected.Expected{ResponseCode: "200", Response: file},
+			wantCode: 200,
+			wantBody: `{"id": "42"}`,
+			headers:  map[string]string{},
+		},
+		{
+			name: "headers and content type",
+			e: expected.Expected{ResponseCode: "201", Response: file, ResponseType: "application/json",
+				ResponseHeaders: map[string]string{
+					"Location":     "/orders/<<.Variables.id>>",
+					"Retry-After":  "5",
+					"Content-Type": "text/plain",
+				}},
+			wantCode: 201,
+			wantBody: `{"id": "42"}`,
+			headers: map[string]string{
+				"Location":     "/orders/42",
+				"Retry-After":  "5",
+				"Content-Type": "application/json",
+			},
+		},
+		{
+			name:     "templated content type",
+			e:        expected.Expected{ResponseCode: "200", Response: file, ResponseType: "<<.Variables.type>>"},
+			wantCode: 200,
+			wantBody: `{"id": "42"}`,
+			headers:  map[string]string{"Content-Type": "application/vnd.orders+json"},
+		},
+		{
+			name:    "bad code",
+			e:       expected.Expected{ResponseCode: "OK", Response: file},
+			wantErr: true,
+		},
+		{
+			name:    "bad header",
+			e:       expected.Expected{ResponseCode: "200", Response: file, ResponseHeaders: map[string]string{"X-Id": "<<.Variables.id"}},
+			wantErr: true,
+		},
+		{
+			name:    "no file",
+			e:       expected.Expected{ResponseCode: "200", Response: filepath.Join(t.TempDir(), "missing.json")},
+			wantErr: true,
+		},
+		{
+			name:     "inline string",
+			e:        expected.Expected{ResponseCode: "200", Body: `{"ok": true, "id": "<<.Variables.id>>"}`},
+			wantCode: 200,
+			wantBody: `{"ok": true, "id": "42"}`,
+			headers:  map[string]string{},
+		},
+		{
+			name: "inline structure",
+			e: expected.Expected{ResponseCode: "200", Body: map[interface{}]interface{}{
+				"id":    "<<.Variables.id>>",
+				"items": []interface{}{map[interface{}]interface{}{"sku": "<<.Variables.id>>-1"}},
+				"ok":    true,
+			}},
+			wantCode: 200,
+			wantBody: `{"id":"42","items":[{"sku":"42-1"}],"ok":true}`,
+			headers:  map[string]string{"Content-Type": "application/json"},
+		},
+		{
+			name:     "inline structure as yaml",
+			e:        expected.Expected{ResponseCode: "200", ResponseType: "application/x-yaml", Body: map[interface{}]interface{}{"id": "<<.Variables.id>>"}},
+			wantCode: 200,
+			wantBody: "id: \"42\"\n",
+			headers:  map[string]string{"Content-Type": "application/x-yaml"},
+		},
+		{
+			name:    "bad inline template",
+			e:       expected.Expected{ResponseCode: "200", Body: map[interface{}]interface{}{"id": "<<.Variables.id"}},
+			wantErr: true,
+		},
+		{
+			name:     "string variable",
+			e:        expected.Expected{ResponseCode: "200", BodyFromVar: "payload"},
+			wantCode: 200,
+			wantBody: `{"amount": 10}`,
+			headers:  map[string]string{},
+		},
+		{
+			name:     "structured variable",
+			e:        expected.Expected{ResponseCode: "200", BodyFromVar: "order.items"},
+			wantCode: 200,
+			wantBody: `[{"sku":"a"}]`,
+			headers:  map[string]string{"Content-Type": "application/json"},
+		},
+		{
+			name:    "missing variable",
+			e:       expected.Expected{ResponseCode: "200", BodyFromVar: "nothing.here"},
+			wantErr: true,
+		},
+		{
+			name: "request",
+			e: expected.Expected{ResponseCode: "200",
+				ResponseHeaders: map[string]string{"X-Correlation-Id": `<<index .Request.Headers "X-Correlation-Id">>`},
+				Body: map[interface{}]interface{}{
+					"order":  "<<.Request.Params.id>>",
+					"amount": "<<.Request.Body.amount>>",
+					"page":   "<<.Request.Query.page>>",
+					"echo":   "<<.Request.Method>> <<.Request.Path>>",
+				}},
+			req: &templates.Request{Method: "POST", Path: "/orders/7",
+				Params:  map[string]string{"id": "7"},
+				Query:   map[string]string{"page": "2"},
+				Headers: map[string]string{"X-Correlation-Id": "abc"},
+				Body:    map[string]interface{}{"amount": 10}},
+			wantCode: 200,
+			wantBody: `{"amount":"10","echo":"POST /orders/7","order":"7","page":"2"}`,
+			headers:  map[string]string{"Content-Type": "application/json", "X-Correlation-Id": "abc"},
+		},
+		{
+			name:    "more than one body",
+			e:       expected.Expected{ResponseCode: "200", Response: file, Body: "{}"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &plan.Plan{State: state.NewState("a")}
+			p.State.Variables["id"] = "42"
+			p.State.Variables["type"] = "application/vnd.orders+json"
+			p.State.Variables["payload"] = `{"amount": 10}`
+			p.State.Variables["order"] = map[string]interface{}{"items": []interface{}{map[interface{}]interface{}{"sku": "a"}}}
+			r, err := BuildResponse(p, tt.e, tt.req)
+			if tt.wantErr {
+				assert.Error(t, err, "Should fail")
+				return
+			}
+			if !assert.NoError(t, err, "Should build the response") {
+				return
+			}
+			assert.Equal(t, tt.wantCode, r.Code, "Should have the right code")
+			assert.Equal(t, tt.wantBody, string(r.Body), "Should have the right body")
+			assert.Equal(t, tt.headers, r.Headers, "Should have the right headers")
+
+			w := httptest.NewRecorder()
+			r.Write(w)
+			assert.Equal(t, tt.wantCode, w.Code, "Should write the code")
+			assert.Equal(t, tt.wantBody, w.Body.String(), "Should write the body")
+			for k, v := range tt.headers {
+				assert.Equal(t, v, w.Header().Get(k), "Should write header %s", k)
+			}
+		})
+	}
+}
+
+func TestProcessTests_ResponseHeaders(t *testing.T) {
+	// Save original state
+	originalTst := tst.tst
+	originalProcessing := tst.processing
+	defer func() {
+		tst.tst = originalTst
+		tst.processing = originalProcessing
+	}()
+	gin.SetMode(gin.TestMode)
+
+	file := responseFile(t, `{"ok": true}`)
+	done := []planaction.PlanAction{{Type: "advance", Args: map[string]interface{}{"txn": "done"}}}
+	txn := transaction.Transaction{
+		Name: "a",
+		InitAction: []planaction.PlanAction{
+			{Type: "url", SatisfyGroup: "orders", Args: map[string]interface{}{"url": "/orders", "method": "GET"}},
+			{Type: "url", SatisfyGroup: "orders", Args: map[string]interface{}{"url": "/orders", "method": "POST",
+				"on_expected": map[interface{}]interface{}{
+					"response_code":    "201",
+					"response_headers": map[interface{}]interface{}{"Location": "/orders/<<.Variables.id>>"},
+				}}},
+		},
+		OnExpected: expected.Expected{ResponseCode: "200", Response: file, ResponseType: "application/json",
+			ResponseHeaders: map[string]string{"X-Source": "trainer"}, Action: done},
+		OnUnexpected: expected.Expected{ResponseCode: "400", Response: file, Action: done},
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		wantCode int
+		headers  map[string]string
+	}{
+		{
+			name:     "override",
+			method:   "POST",
+			wantCode: 201,
+			headers:  map[string]string{"Location": "/orders/42", "X-Source": "trainer", "Content-Type": "application/json"},
+		},
+		{
+			name:     "transaction",
+			method:   "GET",
+			wantCode: 200,
+			headers:  map[string]string{"Location": "", "X-Source": "trainer", "Content-Type": "application/json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tst.tst = &plan.Plan{
+				State: &state.State{
+					Transaction: "a",
+					Variables:   map[string]interface{}{"id": "42"},
+					States:      []state.StateEntry{{TxnName: "a", Status: "running"}},
+				},
+				Txn: []transaction.Transaction{txn, {Name: "done"}},
+			}
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(tt.method, "/orders", strings.NewReader(""))
+			qc := &actions.QueueContext{Ctx: c, Finished: make(chan bool, 1)}
+			q.Add(qc)
+
+			ProcessTests(make(chan *bool, 1))
+
+			assert.Nil(t, tst.tst.State.Err, "Should not error")
+			assert.Equal(t, "done", tst.tst.State.Transaction, "Should advance")
+			assert.Equal(t, tt.wantCode, w.Code, "Should send the right code")
+			for k, v := range tt.headers {
+				assert.Equal(t, v, w.Header().Get(k), "Should send header %s", k)
+			}
+		})
+	}
+	assert.Equal(t, map[string]string{"X-Source": "trainer"}, txn.OnExpected.ResponseHeaders, "Should leave the transaction's headers alone")
+}
+
+func TestProcessTests_RequestTemplate(t *testing.T) {
+	// Save original state
+	originalTst := tst.tst
+	originalProcessing := tst.processing
+	defer func() {
+		tst.tst = originalTst
+		tst.processing = originalProcessing
+	}()
+	gin.SetMode(gin.TestMode)
+
+	done := []planaction.PlanAction{{Type: "advance", Args: map[string]interface{}{"txn": "done"}}}
+	tst.tst = &plan.Plan{
+		State: &state.State{
+			Transaction: "a",
+			Variables:   map[string]interface{}{},
+			States:      []state.StateEntry{{TxnName: "a", Status: "running"}},
+		},
+		Txn: []transaction.Transaction{{
+			Name: "a",
+			InitAction: []planaction.PlanAction{
+				{Type: "url", Args: map[string]interface{}{"url": "/payments/:id", "save_body": "payload"}},
+			},
+			OnExpected: expected.Expected{ResponseCode: "200", Action: done,
+				Body: `{"id": "<<.Request.Params.id>>", "amount": <<.Request.Body.amount>>}`},
+			OnUnexpected: expected.Expected{ResponseCode: "400", Body: "", Action: done},
+		}, {Name: "done"}},
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/payments/p1", strings.NewReader(`{"amount": 25}`))
+	q.Add(&actions.QueueContext{Ctx: c, Finished: make(chan bool, 1)})
+
+	ProcessTests(make(chan *bool, 1))
+
+	assert.Nil(t, tst.tst.State.Err, "Should not error")
+	assert.Equal(t, 200, w.Code, "Should send the right code")
+	assert.Equal(t, `{"id": "p1", "amount": 25}`, w.Body.String(), "Should template the request into the response")
+	assert.Equal(t, `{"amount": 25}`, tst.tst.State.Variables["payload"], "Should still save the body")
+}
+
+func TestProcessTests_ResponseError(t *testing.T) {
+	// Save original state
+	originalTst := tst.tst
+	originalProcessing := tst.processing
+	defer func() {
+		tst.tst = originalTst
+		tst.processing = originalProcessing
+	}()
+	gin.SetMode(gin.TestMode)
+
+	done := []planaction.PlanAction{{Type: "advance", Args: map[string]interface{}{"txn": "done"}}}
+	tests := []struct {
+		name     string
+		expected expected.Expected
+		wantBody string
+	}{
+		{
+			name:     "broken template",
+			expected: expected.Expected{ResponseCode: "200", Body: "<<.Variables.id", Action: done},
+			wantBody: "parsing template",
+		},
+		{
+			name:     "bad response code",
+			expected: expected.Expected{ResponseCode: "<<.Variables.code>>", Body: "ok", Action: done},
+			wantBody: "invalid response code",
+		},
+		{
+			name: "bad fault",
+			expected: expected.Expected{ResponseCode: "200", Body: "ok", Action: done,
+				Fault: &expected.Fault{Delay: "soon"}},
+			wantBody: "delay",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tst.tst = &plan.Plan{
+				State: &state.State{
+					Transaction: "a",
+					Variables:   map[string]interface{}{},
+					States:      []state.StateEntry{{TxnName: "a", Status: "running"}},
+				},
+				Txn: []transaction.Transaction{{
+					Name:         "a",
+					InitAction:   []planaction.PlanAction{{Type: "url", Args: map[string]interface{}{"url": "/orders"}}},
+					OnExpected:   tt.expected,
+					OnUnexpected: expected.Expected{ResponseCode: "400", Body: "", Action: done},
+				}, {Name: "done"}},
+			}
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "/orders", nil)
+
+			// the request goes through Add, which waits for it to be answered.
+			answered := make(chan bool)
+			go func() {
+				(&Handler{}).Add(c)
+				close(answered)
+			}()
+			for i := 0; i < 100; i++ {
+				ProcessTests(make(chan *bool, 1))
+				select {
+				case <-answered:
+					assert.Equal(t, 500, w.Code, "Should send a server error")
+					assert.Contains(t, w.Body.String(), tt.wantBody, "Should send the error")
+					assert.NotNil(t, tst.tst.State.Err, "Should error the test")
+					return
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+			t.Fatal("the request was never answered")
+		})
+	}
+}
+
+func TestProcessTests_Rules(t *testing.T) {
+	// Save original state
+	originalTst := tst.tst
+	originalProcessing := tst.processing
+	defer func() {
+		tst.tst = originalTst
+		tst.processing = originalProcessing
+	}()
+	gin.SetMode(gin.TestMode)
+
+	file := responseFile(t, `{"status": "approved"}`)
+	rules := []interface{}{
+		map[interface{}]interface{}{
+			"name": "declined",
+			"body": map[interface{}]interface{}{"card": map[interface{}]interface{}{"regex": "0002$"}},
+			"on_expected": map[interface{}]interface{}{
+				"response_code": "402",
+				"body":          map[interface{}]interface{}{"status": "declined", "card": "<<.Request.Body.card>>"},
+				"action":        []interface{}{map[interface{}]interface{}{"type": "advance", "args": map[interface{}]interface{}{"txn": "declined"}}},
+			},
+		},
+	}
+	txn := transaction.Transaction{
+		Name:       "a",
+		InitAction: []planaction.PlanAction{{Type: "url", Args: map[string]interface{}{"url": "/pay", "rules": rules}}},
+		OnExpected: expected.Expected{ResponseCode: "200", Response: file,
+			Action: []planaction.PlanAction{{Type: "advance", Args: map[string]interface{}{"txn": "approved"}}}},
+		OnUnexpected: expected.Expected{ResponseCode: "400", Body: "", Action: []planaction.PlanAction{{Type: "advance", Args: map[string]interface{}{"txn": "approved"}}}},
+	}
+
+	tests := []struct {
+		name     string
+		rules    []interface{}
+		body     string
+		wantCode int
+		wantBody string
+		wantTxn  string
+	}{
+		{
+			name:     "rule",
+			rules:    rules,
+			body:     `{"card": "4000000000000002"}`,
+			wantCode: 402,
+			wantBody: `{"card":"4000000000000002","status":"declined"}`,
+			wantTxn:  "declined",
+		},
+		{
+			name:     "default",
+			rules:    append(append([]interface{}{}, rules...), map[interface{}]interface{}{"name": "default"}),
+			body:     `{"card": "4000000000000001"}`,
+			wantCode: 200,
+			wantBody: `{"status": "approved"}`,
+			wantTxn:  "approved",
+		},
+		{
+			name:     "no rule",
+			rules:    rules,
+			body:     `{"card": "4000000000000001"}`,
+			wantCode: 400,
+			wantTxn:  "approved",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := txn
+			a.InitAction = []planaction.PlanAction{{Type: "url", Args: map[string]interface{}{"url": "/pay", "rules": tt.rules}}}
+			tst.tst = &plan.Plan{
+				State: &state.State{
+					Transaction: "a",
+					Variables:   map[string]interface{}{},
+					States:      []state.StateEntry{{TxnName: "a", Status: "running"}},
+				},
+				Txn: []transaction.Transaction{a, {Name: "approved"}, {Name: "declined"}},
+			}
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("POST", "/pay", strings.NewReader(tt.body))
+			q.Add(&actions.QueueContext{Ctx: c, Finished: make(chan bool, 1)})
+
+			ProcessTests(make(chan *bool, 1))
+
+			assert.Nil(t, tst.tst.State.Err, "Should not error")
+			assert.Equal(t, tt.wantCode, w.Code, "Should send the rule's code")
+			assert.Equal(t, tt.wantBody, w.Body.String(), "Should send the rule's body")
+			assert.Equal(t, tt.wantTxn, tst.tst.State.Transaction, "Should run the rule's actions")
+		})
+	}
+}
+
+func TestProcessTests_Sequence(t *testing.T) {
+	// Save original state
+	originalTst := tst.tst
+	originalProcessing := tst.processing
+	defer func() {
+		tst.tst = originalTst
+		tst.processing = originalProcessing
+	}()
+	gin.SetMode(gin.TestMode)
+
+	responses := []interface{}{
+		map[interface{}]interface{}{"response_code": "503", "body": "busy"},
+		map[interface{}]interface{}{"response_code": "503", "body": "busy",
+			"action": []interface{}{map[interface{}]interface{}{"type": "set", "args": map[interface{}]interface{}{"variable": "retried", "value": true}}}},
+		map[interface{}]interface{}{"response_code": "200"},
+	}
+	tst.tst = &plan.Plan{
+		State: &state.State{
+			Transaction: "a",
+			Variables:   map[string]interface{}{},
+			States:      []state.StateEntry{{TxnName: "a", Status: "running"}},
+		},
+		Txn: []transaction.Transaction{{
+			Name:       "a",
+			InitAction: []planaction.PlanAction{{Type: "url", Args: map[string]interface{}{"url": "/orders", "responses": responses}}},
+			OnExpected: expected.Expected{ResponseCode: "200", Body: "ok",
+				Action: []planaction.PlanAction{{Type: "advance", Args: map[string]interface{}{"txn": "done"}}}},
+			OnUnexpected: expected.Expected{ResponseCode: "400", Body: ""},
+		}, {Name: "done"}},
+	}
+
+	want := []struct {
+		code    int
+		body    string
+		txn     string
+		retried interface{}
+	}{
+		{code: 503, body: "busy", txn: "a"},
+		{code: 503, body: "busy", txn: "a", retried: true},
+		{code: 200, body: "ok", txn: "done", retried: true},
+	}
+	for n, w := range want {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest("GET", "/orders", strings.NewReader(""))
+		q.Add(&actions.QueueContext{Ctx: c, Finished: make(chan bool, 1)})
+
+		ProcessTests(make(chan *bool, 1))
+
+		assert.Nil(t, tst.tst.State.Err, "Should not error on call %d", n+1)
+		assert.Equal(t, w.code, rec.Code, "Should send the right code for call %d", n+1)
+		assert.Equal(t, w.body, rec.Body.String(), "Should send the right body for call %d", n+1)
+		assert.Equal(t, w.txn, tst.tst.State.Transaction, "Should only advance after the last response, call %d", n+1)
+		assert.Equal(t, w.retried, tst.tst.State.Variables["retried"], "Should run a response's own actions, call %d", n+1)
+	}
+	assert.Equal(t, 3, tst.tst.State.Calls["a[0] /orders"], "Should count the calls")
+}
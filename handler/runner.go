@@ -21,7 +21,9 @@ func Runner(b chan *bool, abort chan *bool) {
 			pticker.Stop()
 			return
 		case <-pTickChan:
+			tst.run.Lock()
 			ProcessTests(abort)
+			tst.run.Unlock()
 		}
 	}
 }
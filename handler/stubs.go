@@ -0,0 +1,289 @@
+package handler
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/homedepot/trainer/actions"
+	"github.com/homedepot/trainer/structs/expected"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/state"
+	"github.com/homedepot/trainer/structs/stub"
+	"github.com/juju/loggo"
+	"github.com/mohae/deepcopy"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stubSet holds the stubs.  They're answered by Add as soon as a request
+// comes in, not by the runner, so everything here is behind the lock, and
+// the runner copies what it needs into the run's state with SyncStubs.
+type stubSet struct {
+	sync.Mutex
+	global      []stub.Stub
+	globalBases map[string]string
+	globalCalls map[string]int
+	plan        *plan.Plan // the plan the plan calls and faults are for
+	planCalls   map[string]int
+	faults      []state.FaultEntry // faults not yet noted in the run's state
+	waiting     []stub.Stub        // the url actions the plan is waiting on, which stubs don't answer for
+	rand        *rand.Rand
+}
+
+var stubs = stubSet{globalCalls: make(map[string]int), planCalls: make(map[string]int)}
+
+// SetStubs sets the global stubs, which are answered whether there's a test
+// running or not.
+func SetStubs(s []stub.Stub, bases map[string]string) {
+	stubs.Lock()
+	defer stubs.Unlock()
+	stubs.global = s
+	stubs.globalBases = bases
+	stubs.globalCalls = make(map[string]int)
+}
+
+// use starts counting for p, if it isn't the plan being counted for
+// already.  A plan's seed makes its stubs' faults repeatable.
+func (ss *stubSet) use(p *plan.Plan) {
+	if p == ss.plan && ss.rand != nil {
+		return
+	}
+	ss.plan = p
+	ss.planCalls = make(map[string]int)
+	ss.faults = nil
+	ss.waiting = nil
+	seed := time.Now().UnixNano()
+	if p != nil && p.Seed != 0 {
+		seed = p.Seed
+	}
+	ss.rand = rand.New(rand.NewSource(seed))
+}
+
+// watch notes the url actions of the run's current transaction, so stubs
+// leave the requests for them to the plan.  The runner calls it after each
+// pass, since only the runner can look at the plan's actions.
+func (ss *stubSet) watch(p *plan.Plan) {
+	ss.Lock()
+	defer ss.Unlock()
+	ss.use(p)
+	ss.waiting = nil
+	if p == nil || p.State == nil {
+		return
+	}
+	switch p.State.Phase {
+	case state.PhaseSetup, state.PhaseTeardown, state.PhaseFinished:
+		return
+	}
+	txn, err := p.FindTransaction(p.State.Transaction)
+	if err != nil {
+		return
+	}
+	for _, pa := range txn.InitAction {
+		if pa.Type != "url" {
+			continue
+		}
+		u, _ := pa.Args["url"].(string)
+		m, _ := pa.Args["method"].(string)
+		h, _ := actions.StringKeys(deepcopy.Copy(pa.Args["headers"])).(map[string]interface{})
+		qu, _ := actions.StringKeys(deepcopy.Copy(pa.Args["query"])).(map[string]interface{})
+		ss.waiting = append(ss.waiting, stub.Stub{URL: u, Method: m, Headers: h, Query: qu})
+	}
+}
+
+// MatchStub checks a request against a stub, and returns the parameters
+// from its path if it matches.
+func MatchStub(s stub.Stub, c *gin.Context) (bool, map[string]string, error) {
+	req := c.Request
+	ok, params, err := actions.MatchPath(s.URL, req.URL.Path)
+	if err != nil || !ok {
+		return false, nil, err
+	}
+	if s.Method != "" && !strings.EqualFold(s.Method, req.Method) {
+		return false, nil, nil
+	}
+	headers, err := actions.LoadValueMatches(s.Headers)
+	if err != nil {
+		return false, nil, err
+	}
+	query, err := actions.LoadValueMatches(s.Query)
+	if err != nil {
+		return false, nil, err
+	}
+	if actions.MatchHeaders(headers, req.Header) != "" || actions.MatchQuery(query, req.URL.Query()) != "" {
+		return false, nil, nil
+	}
+	return true, params, nil
+}
+
+// stubMatch is the stub a request matched, and what's needed to answer it.
+type stubMatch struct {
+	stub   *stub.Stub
+	params map[string]string
+	bases  map[string]string
+	fault  *expected.Injection
+}
+
+// find looks for the stub for a request, the running plan's first and then
+// the global ones, and counts the call.  It picks the fault to inject too,
+// if the stub has one.
+func (ss *stubSet) find(c *gin.Context) (*stubMatch, error) {
+	ss.Lock()
+	defer ss.Unlock()
+	p := tst.tst
+	ss.use(p)
+	// a request the plan is waiting on is the plan's, even if a stub matches
+	// it too.
+	for _, w := range ss.waiting {
+		if ok, _, err := MatchStub(w, c); err == nil && ok {
+			loggo.GetLogger("default").Debugf("%s %s is for url action %s, not the stubs", c.Request.Method, c.Request.URL.Path, w.Key())
+			return nil, nil
+		}
+	}
+	type group struct {
+		stubs []stub.Stub
+		calls map[string]int
+		bases map[string]string
+	}
+	var groups []group
+	if p != nil {
+		groups = append(groups, group{p.Stubs, ss.planCalls, p.Bases})
+	}
+	groups = append(groups, group{ss.global, ss.globalCalls, ss.globalBases})
+	for _, g := range groups {
+		for i := range g.stubs {
+			s := &g.stubs[i]
+			ok, params, err := MatchStub(*s, c)
+			if err != nil {
+				return nil, fmt.Errorf("stub %s: %w", s.Key(), err)
+			}
+			if !ok {
+				continue
+			}
+			g.calls[s.Key()]++
+			m := &stubMatch{stub: s, params: params, bases: g.bases}
+			if s.Fault != nil {
+				m.fault, err = s.Fault.Pick(ss.rand)
+				if err != nil {
+					return nil, fmt.Errorf("stub %s: %w", s.Key(), err)
+				}
+			}
+			if m.fault != nil && p != nil {
+				ss.faults = append(ss.faults, state.FaultEntry{Time: time.Now(), Txn: "stub " + s.Key(), Path: c.Request.URL.Path, Fault: m.fault.String()})
+			}
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+// ServeStub answers a request from a stub, if one matches it, and returns
+// whether it did.  Stubs are templated with the request, the bases and Now,
+// but not with any plan's variables, which only the runner can use.
+func ServeStub(c *gin.Context) bool {
+	logger := loggo.GetLogger("default")
+	m, err := stubs.find(c)
+	if err == nil && m == nil {
+		return false
+	}
+	var resp *Response
+	if err == nil {
+		resp, err = m.response(c)
+	}
+	if err != nil {
+		logger.Warningf("couldn't answer %s from a stub: %s", c.Request.URL.Path, err)
+		c.Writer.WriteHeader(500)
+		c.Writer.Write([]byte(err.Error()))
+		return true
+	}
+	logger.Debugf("stub %s answering %s %s", m.stub.Key(), c.Request.Method, c.Request.URL.Path)
+	if m.fault != nil {
+		logger.Infof("injecting %s into stub %s", m.fault, m.stub.Key())
+		resp.WriteFault(c.Writer, m.fault)
+		return true
+	}
+	resp.Write(c.Writer)
+	return true
+}
+
+func (m *stubMatch) response(c *gin.Context) (*Response, error) {
+	qc := &actions.QueueContext{Ctx: c, Params: m.params}
+	req, err := qc.TemplateRequest()
+	if err != nil {
+		return nil, fmt.Errorf("stub %s: %w", m.stub.Key(), err)
+	}
+	p := &plan.Plan{Bases: m.bases, State: state.NewState("")}
+	resp, err := BuildResponse(p, m.stub.Expected, req)
+	if err != nil {
+		return nil, fmt.Errorf("stub %s: %w", m.stub.Key(), err)
+	}
+	return resp, nil
+}
+
+// SyncStubs copies the stubs' calls and faults into the run's state, and
+// the plan stubs' calls into their save_count variables.
+func SyncStubs() {
+	p := tst.tst
+	if p == nil || p.State == nil {
+		return
+	}
+	stubs.Lock()
+	defer stubs.Unlock()
+	stubs.use(p)
+	s := p.State
+	s.Stubs = make(map[string]int, len(stubs.planCalls))
+	for k, v := range stubs.planCalls {
+		s.Stubs[k] = v
+	}
+	s.GlobalStubs = make(map[string]int, len(stubs.globalCalls))
+	for k, v := range stubs.globalCalls {
+		s.GlobalStubs[k] = v
+	}
+	s.Faults = append(s.Faults, stubs.faults...)
+	stubs.faults = nil
+	for _, st := range p.Stubs {
+		if st.SaveCount == "" {
+			continue
+		}
+		if err := s.SetVariable(st.SaveCount, stubs.planCalls[st.Key()]); err != nil {
+			loggo.GetLogger("default").Warningf("stub %s: save_count: %s", st.Key(), err)
+		}
+	}
+}
+
+// CheckStubs checks the plan stubs' min_calls and max_calls, once SyncStubs
+// has brought the counts up to date.
+func CheckStubs(p *plan.Plan) error {
+	for _, st := range p.Stubs {
+		n := p.State.Stubs[st.Key()]
+		if st.MinCalls != nil && n < *st.MinCalls {
+			return fmt.Errorf("stub %s was called %d times, expected at least %d", st.Key(), n, *st.MinCalls)
+		}
+		if st.MaxCalls != nil && n > *st.MaxCalls {
+			return fmt.Errorf("stub %s was called %d times, expected at most %d", st.Key(), n, *st.MaxCalls)
+		}
+	}
+	return nil
+}
+
+// StubCalls returns the calls to the global stubs, and to the running
+// plan's stubs, for the stubs endpoint.
+func StubCalls() (map[string]int, map[string]int) {
+	stubs.Lock()
+	defer stubs.Unlock()
+	stubs.use(tst.tst)
+	global := make(map[string]int, len(stubs.globalCalls))
+	for k, v := range stubs.globalCalls {
+		global[k] = v
+	}
+	pl := make(map[string]int, len(stubs.planCalls))
+	for k, v := range stubs.planCalls {
+		pl[k] = v
+	}
+	return global, pl
+}
@@ -0,0 +1,210 @@
+package handler
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/homedepot/trainer/actions"
+	"github.com/homedepot/trainer/structs/expected"
+	"github.com/homedepot/trainer/structs/plan"
+	"github.com/homedepot/trainer/structs/planaction"
+	"github.com/homedepot/trainer/structs/state"
+	"github.com/homedepot/trainer/structs/stub"
+	"github.com/homedepot/trainer/structs/transaction"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubRequest sends a request through Handler.Add.
+func stubRequest(method, target string, headers map[string]string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, strings.NewReader(""))
+	for k, v := range headers {
+		c.Request.Header.Set(k, v)
+	}
+	h := Handler{}
+	h.Add(c)
+	return w
+}
+
+func TestHandler_Add_Stubs(t *testing.T) {
+	originalTst := tst.tst
+	defer func() {
+		tst.tst = originalTst
+		SetStubs(nil, nil)
+	}()
+	gin.SetMode(gin.TestMode)
+
+	one := 1.0
+	SetStubs([]stub.Stub{
+		{Name: "flags", URL: "/flags/:app", Method: "GET",
+			Expected: expected.Expected{ResponseCode: "200", ResponseType: "application/json",
+				Body: map[interface{}]interface{}{"app": "<<.Request.Params.app>>", "env": "<<.Bases.env>>"}}},
+		{URL: "/token", Method: "POST", Headers: map[string]interface{}{"Authorization": map[interface{}]interface{}{"present": true}},
+			Expected: expected.Expected{ResponseCode: "200", Body: "global token"}},
+		{URL: "/down", Expected: expected.Expected{ResponseCode: "200", Body: "up",
+			Fault: &expected.Fault{ErrorCode: 503, Probability: &one}}},
+	}, map[string]string{"env": "test"})
+
+	tests := []struct {
+		name     string
+		plan     *plan.Plan
+		method   string
+		target   string
+		headers  map[string]string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:   "global with no test",
+			method: "GET", target: "/flags/orders",
+			wantCode: 200, wantBody: `{"app":"orders","env":"test"}`,
+		},
+		{
+			name:   "headers don't match",
+			method: "POST", target: "/token",
+			wantCode: 500, wantBody: "no test in progress",
+		},
+		{
+			name:   "headers match",
+			method: "POST", target: "/token", headers: map[string]string{"Authorization": "Basic abc"},
+			wantCode: 200, wantBody: "global token",
+		},
+		{
+			name:   "fault",
+			method: "GET", target: "/down",
+			wantCode: 503,
+		},
+		{
+			name: "plan stub first",
+			plan: &plan.Plan{Seed: 1, State: state.NewState("a"), Stubs: []stub.Stub{
+				{URL: "/token", Expected: expected.Expected{ResponseCode: "201", Body: "plan token"}},
+			}},
+			method: "POST", target: "/token", headers: map[string]string{"Authorization": "Basic abc"},
+			wantCode: 201, wantBody: "plan token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tst.tst = tt.plan
+			w := stubRequest(tt.method, tt.target, tt.headers)
+			assert.Equal(t, tt.wantCode, w.Code, "Should send the right code")
+			assert.Equal(t, tt.wantBody, w.Body.String(), "Should send the right body")
+		})
+	}
+
+	global, pl := StubCalls()
+	assert.Equal(t, map[string]int{"flags": 1, "POST /token": 1, "/down": 1}, global, "Should count the global stubs")
+	assert.Equal(t, map[string]int{"/token": 1}, pl, "Should count the plan's stubs")
+}
+
+func TestProcessTests_Stubs(t *testing.T) {
+	originalTst := tst.tst
+	originalProcessing := tst.processing
+	defer func() {
+		tst.tst = originalTst
+		tst.processing = originalProcessing
+	}()
+	gin.SetMode(gin.TestMode)
+
+	two, one := 2, 1
+	tests := []struct {
+		name       string
+		min, max   *int
+		calls      int
+		wantResult string
+	}{
+		{name: "enough calls", min: &one, max: &two, calls: 2, wantResult: state.ResultStopped},
+		{name: "too few calls", min: &two, calls: 1, wantResult: state.ResultErrored},
+		{name: "too many calls", max: &one, calls: 2, wantResult: state.ResultErrored},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tst.tst = &plan.Plan{
+				StopVar:     "finished",
+				DefaultVars: map[string]interface{}{},
+				Stubs: []stub.Stub{{Name: "config", URL: "/config", SaveCount: "config_calls", MinCalls: tt.min, MaxCalls: tt.max,
+					Expected: expected.Expected{ResponseCode: "200", Body: "{}"}}},
+				Txn: []transaction.Transaction{{Name: "a", InitAction: []planaction.PlanAction{
+					{Type: "set", Args: map[string]interface{}{"variable": "finished", "value": true}},
+				}}},
+			}
+			if !assert.NoError(t, tst.tst.Reset()) {
+				return
+			}
+			for i := 0; i < tt.calls; i++ {
+				assert.Equal(t, 200, stubRequest("GET", "/config", nil).Code, "Should answer from the stub")
+			}
+			abort := make(chan *bool, 1)
+			ProcessTests(abort)
+			assert.Equal(t, tt.calls, tst.tst.State.Variables["config_calls"], "Should save the count")
+			assert.Equal(t, tt.calls, tst.tst.State.Stubs["config"], "Should put the count in the status")
+			ProcessTests(abort)
+			assert.Equal(t, tt.wantResult, tst.tst.State.Result, "Should check the calls when the run stops")
+		})
+	}
+}
+
+func TestHandler_Add_StubsLeaveWaitingURLs(t *testing.T) {
+	originalTst := tst.tst
+	defer func() {
+		tst.tst = originalTst
+		SetStubs(nil, nil)
+		stubs.watch(nil)
+	}()
+	gin.SetMode(gin.TestMode)
+
+	SetStubs([]stub.Stub{
+		{URL: "/orders", Method: "POST", Expected: expected.Expected{ResponseCode: "200", Body: "stub order"}},
+		{URL: "/flags", Expected: expected.Expected{ResponseCode: "200", Body: "stub flags"}},
+	}, nil)
+	tst.tst = &plan.Plan{
+		State: state.NewState("a"),
+		Txn: []transaction.Transaction{{Name: "a", InitAction: []planaction.PlanAction{
+			{Type: "url", Args: map[string]interface{}{"url": "/orders", "method": "POST",
+				"headers": map[interface{}]interface{}{"X-Tenant": "t1"}}},
+		}}},
+	}
+	stubs.watch(tst.tst)
+
+	// the stubs still answer what the plan isn't waiting on.
+	w := stubRequest("POST", "/orders", map[string]string{"X-Tenant": "t2"})
+	assert.Equal(t, "stub order", w.Body.String(), "Should answer from the stub when the url action doesn't match")
+	w = stubRequest("GET", "/flags", nil)
+	assert.Equal(t, "stub flags", w.Body.String(), "Should answer from the stub for another url")
+
+	// the request the url action is waiting on is queued for the plan.
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- stubRequest("POST", "/orders", map[string]string{"X-Tenant": "t1"})
+	}()
+	var ctx *actions.QueueContext
+	for i := 0; i < 100 && ctx == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		ctx = q.GetUrl()
+	}
+	if !assert.NotNil(t, ctx, "Should queue the request for the url action") {
+		return
+	}
+	ctx.Ctx.Writer.WriteHeader(201)
+	ctx.Ctx.Writer.Write([]byte("plan order"))
+	ctx.Finished <- true
+	w = <-done
+	assert.Equal(t, 201, w.Code, "Should be answered by the plan")
+	assert.Equal(t, "plan order", w.Body.String(), "Should be answered by the plan")
+
+	// once the plan has moved on, the stub answers again.
+	tst.tst.State.Transaction = "b"
+	tst.tst.Txn = append(tst.tst.Txn, transaction.Transaction{Name: "b"})
+	stubs.watch(tst.tst)
+	w = stubRequest("POST", "/orders", map[string]string{"X-Tenant": "t1"})
+	assert.Equal(t, "stub order", w.Body.String(), "Should answer from the stub once the plan isn't waiting")
+}
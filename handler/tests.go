@@ -6,23 +6,18 @@ package handler
 // See LICENSE for further details.
 
 import (
-	"bytes"
 	"errors"
 	"github.com/gofrs/uuid"
 	"github.com/homedepot/trainer/actions"
 	"github.com/homedepot/trainer/config"
-	"github.com/homedepot/trainer/security"
 	"github.com/homedepot/trainer/structs/expected"
 	"github.com/homedepot/trainer/structs/plan"
 	"github.com/homedepot/trainer/structs/planaction"
+	"github.com/homedepot/trainer/structs/state"
+	"github.com/homedepot/trainer/structs/transaction"
 	"github.com/juju/loggo"
-	"github.com/mitchellh/mapstructure"
 	"github.com/mohae/deepcopy"
-	"os"
-	"reflect"
-	"strconv"
-	"text/template"
-	"time"
+	"sync"
 )
 
 type test struct {
@@ -30,10 +25,41 @@ type test struct {
 	processing bool
 	action     actions.Action
 	bgActions  []actions.Action // actions that could be, but not necessarily are, backgrounded.
+	run        sync.Mutex // held by the runner while it processes the test
+	removeMu   sync.Mutex
+	removed    chan struct{} // set while a remove waits for the teardown, closed when it's done
 }
 
 var tst test
 
+// startRemove asks the runner to end the run and do the teardown.  The
+// channel it returns is closed once the run has finished.
+func (t *test) startRemove() chan struct{} {
+	t.removeMu.Lock()
+	defer t.removeMu.Unlock()
+	if t.removed == nil {
+		t.removed = make(chan struct{})
+	}
+	return t.removed
+}
+
+// removing returns whether a remove is waiting for the teardown.
+func (t *test) removing() bool {
+	t.removeMu.Lock()
+	defer t.removeMu.Unlock()
+	return t.removed != nil
+}
+
+// finishRemove lets a remove that's waiting know the run has finished.
+func (t *test) finishRemove() {
+	t.removeMu.Lock()
+	defer t.removeMu.Unlock()
+	if t.removed != nil {
+		close(t.removed)
+		t.removed = nil
+	}
+}
+
 type SatisfyGroup struct {
 	name   string
 	action []*planaction.PlanAction
@@ -49,11 +75,13 @@ func LaunchTest(cfg *config.Config, p string) error {
 	}
 	pln := deepcopy.Copy(pl)
 	tst.tst = pln.(*plan.Plan)
+	tst.tst.Library = cfg.Plans
 
 	err = tst.tst.Reset()
 	if err != nil {
 		return err
 	}
+	stubs.watch(tst.tst)
 	return nil
 }
 
@@ -74,6 +102,32 @@ func ProcessTests(kill chan *bool) {
 	if tst.tst == nil {
 		return
 	}
+	defer func() {
+		if tst.tst.State.Phase == state.PhaseFinished {
+			tst.finishRemove()
+		}
+		stubs.watch(tst.tst)
+	}()
+	SyncStubs()
+	switch tst.tst.State.Phase {
+	case state.PhaseSetup:
+		if tst.removing() {
+			tst.tst.State.Setup.Status = "removed"
+			EndRun(state.ResultRemoved)
+			return
+		}
+		ProcessSetup()
+		return
+	case state.PhaseTeardown:
+		ProcessTeardown()
+		return
+	case state.PhaseFinished:
+		return
+	}
+	if tst.removing() {
+		EndRun(state.ResultRemoved)
+		return
+	}
 	if tst.tst.StopVar != "" {
 		sv, ok := tst.tst.State.Variables[tst.tst.StopVar]
 		if ok {
@@ -81,12 +135,20 @@ func ProcessTests(kill chan *bool) {
 			if ok1 {
 				if svb == true {
 					tst.tst.State.States[len(tst.tst.State.States)-1].Status = "stopped"
+					EndRun(state.ResultStopped)
 					return
 				}
 			}
 		}
 	}
 	if tst.tst.State.Err != nil {
+		EndRun(state.ResultErrored)
+		return
+	}
+	if TimedOut() {
+		logger.Warningf("plan timed out after %s", tst.tst.Timeout)
+		tst.tst.State.States[len(tst.tst.State.States)-1].Status = "timed_out"
+		EndRun(state.ResultTimedOut)
 		return
 	}
 	txn, err := tst.tst.FindTransaction(tst.tst.State.Transaction)
@@ -124,7 +186,11 @@ func ProcessTests(kill chan *bool) {
 					break
 				}
 			} else {
-				ctx = nil
+				// an action that runs while a group waits for a request
+				// leaves the request for the group's urls.
+				if len(g.action) == 1 || !actions.RunsWhileWaiting(v.Type) {
+					ctx = nil
+				}
 				delete(g.action[i].Args, "_context")
 			}
 		}
@@ -135,9 +201,25 @@ func ProcessTests(kill chan *bool) {
 			logger.Debugf("Only one action in group, skipping satisfy test")
 			pa = g.action[0]
 		} else {
-			// we have a choice.
+			// we have a choice.  An action that runs while waiting (wait_until)
+			// is picked when there's no request for any of the urls.
+			var waiting *planaction.PlanAction
 			for _, v := range g.action {
+				if v.Type != "url" && actions.RunsWhileWaiting(v.Type) {
+					waiting = v
+					break
+				}
+			}
+			for _, v := range g.action {
+				if v == waiting {
+					continue
+				}
 				if v.Type == "url" && ctx == nil {
+					if waiting != nil {
+						logger.Tracef("No URL received for URL group, running %s instead.", waiting.Type)
+						pa = waiting
+						break
+					}
 					// no url received.
 					logger.Debugf("No URL received for URL group, skipping.")
 					return
@@ -146,17 +228,10 @@ func ProcessTests(kill chan *bool) {
 				ac, _ := actions.Satisfy(v.Type, v.Args)
 				logger.Tracef("satisfy returned %v", ac)
 				if ac == true {
-					var m mapstructure.Metadata
 					pa = v
 					e1, ok := v.Args["on_expected"]
 					if ok {
-						err = mapstructure.DecodeMetadata(e1, &ex, &m)
-						if err != nil {
-							logger.Warningf("Could not decode on_expected, defaulting to transaction: %s", err)
-						}
-						if len(m.Unused) > 0 {
-							logger.Warningf("Unused keys in mapstructure decode: %+v", m.Unused)
-						}
+						OverrideExpected(&ex, e1)
 					}
 				}
 				logger.Tracef("not satisfied, continuing.")
@@ -194,12 +269,24 @@ func ProcessTests(kill chan *bool) {
 			tst.action = action
 			// ************** ^^^^^^^^^ *************
 			if res.Err != nil {
-				tst.tst.State.States[len(tst.tst.State.States)-1].Status = "errored"
 				logger.Warningf("Error running action: %s: %s", pa.Type, res.Err)
-				tst.tst.State.Err = res.Err
+				// a url action has used up the request, and a retry waits for
+				// another one, so this one is answered now.
+				if pa.Type == "url" && ctx != nil {
+					AnswerError(ctx, res.Err)
+					ctx = nil
+				}
+				switch ActionError(txn, pa, res.Err) {
+				case ErrorRetry:
+					tst.tst.State.States[len(tst.tst.State.States)-1].Status = "retrying"
+				case ErrorContinue:
+					tst.tst.State.TxnActionIdx++
+					continue
+				}
 				tst.processing = false
 				return
 			}
+			tst.tst.State.Retries = 0
 			if action.CanBackground() {
 				logger.Debugf("This action can background, appending to list: %s", action.GetName())
 				tst.bgActions = append(tst.bgActions, action)
@@ -218,14 +305,29 @@ func ProcessTests(kill chan *bool) {
 					err := tst.tst.Advance(res.NewTxn)
 					if err != nil {
 						logger.Warningf("Error advancing: %s", err)
-						tst.tst.State.Err = res.Err
+						TransactionError(txn, pa, err)
 						tst.processing = false
 						return
 					}
+					if res.Resume {
+						logger.Debugf("Resuming %s at action %v", res.NewTxn, res.ResumeIdx)
+						tst.tst.State.TxnActionIdx = res.ResumeIdx
+					}
 					tst.processing = false
 					return
 				}
+				if res.OnExpected != nil {
+					if res.Repeat {
+						// the transaction's actions wait for the last response.
+						ex.Action = nil
+					}
+					OverrideExpected(&ex, res.OnExpected)
+				}
 				urlres = &res
+				if res.Repeat {
+					// answer this request, and come back to this action for the next one.
+					break
+				}
 				tst.tst.State.TxnActionIdx++
 				continue
 			}
@@ -250,6 +352,7 @@ func ProcessTests(kill chan *bool) {
 	txn, err = tst.tst.GetCurrentTransaction()
 	if err != nil {
 		logger.Warningf("no current transaction??")
+		AnswerError(ctx, err)
 		tst.processing = false
 		return
 	}
@@ -263,55 +366,166 @@ func ProcessTests(kill chan *bool) {
 		e = nex
 		tst.tst.State.States[len(tst.tst.State.States)-1].Status = "unexpected"
 	}
-	code, err := strconv.Atoi(e.ResponseCode)
+	req, err := ctx.TemplateRequest()
 	if err != nil {
-		logger.Warningf("Invalid response code (not int)")
-		logger.Debugf("error: %s", err)
-		tst.tst.State.Err = err
+		logger.Warningf("Couldn't read request: %s", err)
+		AnswerError(ctx, err)
+		TransactionError(txn, nil, err)
 		tst.processing = false
 		return
 	}
-	ctx.Ctx.Writer.WriteHeader(code)
-	
-	// Validate response file path to prevent path traversal
-	if err := security.ValidatePath(e.Response, ""); err != nil {
-		logger.Warningf("Response file path validation failed: %s", err)
-		tst.tst.State.Err = err
+	resp, err := BuildResponse(tst.tst, e, req)
+	if err != nil {
+		logger.Warningf("Couldn't build response: %s", err)
+		AnswerError(ctx, err)
+		TransactionError(txn, nil, err)
 		tst.processing = false
 		return
 	}
-	
-	rawresponsestr, err := os.ReadFile(e.Response)
+
+	in, err := PickFault(e, urlres.Fault, tst.tst.State.FaultRandom())
 	if err != nil {
-		logger.Warningf("Couldn't read response file %s: %s", e.Response, err)
-		tst.tst.State.Err = err
+		logger.Warningf("Couldn't work out the fault: %s", err)
+		AnswerError(ctx, err)
+		TransactionError(txn, nil, err)
 		tst.processing = false
 		return
 	}
+	if in != nil {
+		logger.Infof("injecting %s into the response to %s", in, req.Path)
+		tst.tst.State.NoteFault(txn.Name, req.Path, in.String())
+		go func() {
+			resp.WriteFault(ctx.Ctx.Writer, in)
+			ctx.Finished <- true
+		}()
+	} else {
+		resp.Write(ctx.Ctx.Writer)
+		ctx.Finished <- true
+	}
 
-	responsestr := ParseStringTemplate(tst.tst, string(rawresponsestr))
-
-	ctx.Ctx.Writer.Write([]byte(responsestr))
-	ctx.Finished <- true
-
-	for _, pa := range e.Action {
+	for i := 0; i < len(e.Action); i++ {
+		pa := &e.Action[i]
 		// don't record the action.  That's really only useful for interruptible actions,
 		// and I can't think of any reason to do a callback here...
 		_, res := actions.Execute(pa.Type, pa.Args, tst.tst)
+		if res.Err != nil {
+			logger.Warningf("Error running action: %s: %s", pa.Type, res.Err)
+			// the response has been sent, so there's no waiting for the
+			// next pass to retry.
+			switch ActionError(txn, pa, res.Err) {
+			case ErrorRetry:
+				i--
+				continue
+			case ErrorContinue:
+				continue
+			}
+			tst.processing = false
+			return
+		}
+		tst.tst.State.Retries = 0
 		if !res.Complete {
 			return
 		}
 		if res.Advance {
 			logger.Debugf("advancing to transaction %s", res.NewTxn)
 			tst.tst.Advance(res.NewTxn)
+			if res.Resume {
+				tst.tst.State.TxnActionIdx = res.ResumeIdx
+			}
 			tst.processing = false
 			return
 		}
 	}
 
+	if urlres.Repeat {
+		tst.tst.State.States[len(tst.tst.State.States)-1].Status = "waiting"
+		tst.processing = false
+		return
+	}
+
 	logger.Warningf("expected/unexpected action had no advance")
-	tst.tst.State.Err = errors.New("no advance action specified")
+	TransactionError(txn, nil, errors.New("no advance action specified"))
+
+}
 
+// What to do after an action has failed.
+const (
+	ErrorStop     = iota // the test has stopped, or has moved on to another transaction
+	ErrorRetry           // run the action again
+	ErrorContinue        // carry on with the next action
+)
+
+// ActionError decides what happens after an action fails.  The action's
+// on_error is used if it has one, then the transaction's, and then the
+// plan's error_transaction.  The error is saved in the error variable
+// first, so that whatever runs next can report it.
+func ActionError(txn *transaction.Transaction, pa *planaction.PlanAction, err error) int {
+	logger := loggo.GetLogger("default")
+	s := tst.tst.State
+	oe := txn.OnError
+	if pa.OnError != nil {
+		oe = pa.OnError
+	}
+	if oe != nil && s.Retries < oe.Retry {
+		s.Retries++
+		SaveError(txn, pa, err)
+		logger.Infof("retrying %s (%d of %d)", pa.Type, s.Retries, oe.Retry)
+		return ErrorRetry
+	}
+	if oe != nil && oe.Advance == "" && oe.Continue {
+		SaveError(txn, pa, err)
+		s.Retries = 0
+		logger.Infof("continuing after %s failed", pa.Type)
+		return ErrorContinue
+	}
+	TransactionError(txn, pa, err)
+	s.Retries = 0
+	return ErrorStop
+}
+
+// TransactionError advances to the transaction's on_error advance, or the
+// plan's error_transaction, or stops the test if there's neither.
+func TransactionError(txn *transaction.Transaction, pa *planaction.PlanAction, err error) {
+	logger := loggo.GetLogger("default")
+	p := tst.tst
+	SaveError(txn, pa, err)
+	next := p.ErrorTransaction
+	if pa != nil && pa.OnError != nil && pa.OnError.Advance != "" {
+		next = pa.OnError.Advance
+	} else if txn.OnError != nil && txn.OnError.Advance != "" {
+		next = txn.OnError.Advance
+	}
+	if pa != nil {
+		p.State.States[len(p.State.States)-1].Status = "errored"
+	}
+	// failing in the error transaction would loop forever.
+	if next == "" || next == p.State.Transaction {
+		p.State.Err = err
+		return
+	}
+	logger.Infof("advancing to %s after an error", next)
+	if aerr := p.Advance(next); aerr != nil {
+		logger.Warningf("Error advancing to %s: %s", next, aerr)
+		p.State.Err = err
+	}
+}
+
+// SaveError puts the details of an error in the error variable.
+func SaveError(txn *transaction.Transaction, pa *planaction.PlanAction, err error) {
+	s := tst.tst.State
+	if s.Variables == nil {
+		s.Variables = make(map[string]interface{})
+	}
+	e := map[string]interface{}{
+		"message":     err.Error(),
+		"transaction": txn.Name,
+		"action":      "",
+		"retries":     s.Retries,
+	}
+	if pa != nil {
+		e["action"] = pa.Type
+	}
+	s.Variables["error"] = e
 }
 
 func FindSatisfaction(n string, g []*SatisfyGroup) *SatisfyGroup {
@@ -359,51 +573,3 @@ func CollateActions(a []planaction.PlanAction) []*SatisfyGroup {
 func GetPlan() *plan.Plan {
 	return tst.tst
 }
-
-// forklifted from actions.  If I used it from actions, it would create an import loop.
-func ParseStringTemplate(p *plan.Plan, in string) string {
-
-	logger := loggo.GetLogger("default")
-
-	t := time.Now()
-	mt, err := t.MarshalText()
-	if err != nil {
-		logger.Criticalf("Couldn't marshal time: %s", err.Error())
-		panic("AIEEEEEEEEE")
-	}
-
-	// Anonymous arg template struct.
-	at := struct {
-		Variables map[string]string
-		Bases     map[string]string
-		Now       string
-	}{
-		Bases: p.Bases,
-		Now:   string(mt),
-	}
-
-	at.Variables = make(map[string]string, 0)
-
-	// Only template the string variables.  It doesn't make much sense
-	// for any other type.
-	for i, v := range p.State.Variables {
-		if reflect.TypeOf(v).String() == "string" {
-			at.Variables[i] = v.(string)
-		}
-	}
-	tt := template.New("local")
-	tt.Delims("<<", ">>")
-	tpl, err := tt.Parse(in)
-	if err != nil {
-		logger.Warningf("Error parsing template: %s", err.Error())
-		return in
-	}
-	var b bytes.Buffer
-	err = tpl.Execute(&b, at)
-	if err != nil {
-		logger.Warningf("Error executing template: %s.  It's still alive.", err.Error())
-		return in
-	}
-	logger.Tracef("returning: %s", b.String())
-	return b.String()
-}
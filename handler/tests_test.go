@@ -6,8 +6,11 @@ package handler
 // See LICENSE for further details.
 
 import (
+	"net/http/httptest"
 	"testing"
 
+	"github.com/gin-gonic/gin"
+	"github.com/homedepot/trainer/actions"
 	"github.com/homedepot/trainer/structs/plan"
 	"github.com/homedepot/trainer/structs/planaction"
 	"github.com/homedepot/trainer/structs/state"
@@ -165,103 +168,6 @@ func TestGetPlan(t *testing.T) {
 	}
 }
 
-func TestParseStringTemplate(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		plan     *plan.Plan
-		expected string
-	}{
-		{
-			name:  "simple variable substitution",
-			input: "Hello <<.Variables.name>>",
-			plan: &plan.Plan{
-				State: &state.State{
-					Variables: map[string]interface{}{
-						"name": "World",
-					},
-				},
-				Bases: map[string]string{},
-			},
-			expected: "Hello World",
-		},
-		{
-			name:  "base URL substitution",
-			input: "URL: <<.Bases.api>>",
-			plan: &plan.Plan{
-				State: &state.State{
-					Variables: map[string]interface{}{},
-				},
-				Bases: map[string]string{
-					"api": "https://api.example.com",
-				},
-			},
-			expected: "URL: https://api.example.com",
-		},
-		{
-			name:  "non-string variable ignored",
-			input: "Count: <<.Variables.count>>",
-			plan: &plan.Plan{
-				State: &state.State{
-					Variables: map[string]interface{}{
-						"count": 42,
-					},
-				},
-				Bases: map[string]string{},
-			},
-			expected: "Count: <no value>",
-		},
-		{
-			name:  "template with Now timestamp",
-			input: "Time: <<.Now>>",
-			plan: &plan.Plan{
-				State: &state.State{
-					Variables: map[string]interface{}{},
-				},
-				Bases: map[string]string{},
-			},
-			expected: "Time: ", // Will have timestamp appended
-		},
-		{
-			name:  "invalid template returns original",
-			input: "Bad template <<.Missing",
-			plan: &plan.Plan{
-				State: &state.State{
-					Variables: map[string]interface{}{},
-				},
-				Bases: map[string]string{},
-			},
-			expected: "Bad template <<.Missing",
-		},
-		{
-			name:  "multiple variables",
-			input: "<<.Variables.first>> and <<.Variables.second>>",
-			plan: &plan.Plan{
-				State: &state.State{
-					Variables: map[string]interface{}{
-						"first":  "foo",
-						"second": "bar",
-					},
-				},
-				Bases: map[string]string{},
-			},
-			expected: "foo and bar",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := ParseStringTemplate(tt.plan, tt.input)
-			if tt.name == "template with Now timestamp" {
-				// Just verify it starts with the expected prefix
-				assert.Contains(t, result, "Time: ", "Should contain time prefix")
-			} else {
-				assert.Equal(t, tt.expected, result, "Template parsing should match expected")
-			}
-		})
-	}
-}
-
 func TestProcessTests_NilTest(t *testing.T) {
 	// Save original state
 	originalTst := tst.tst
@@ -354,3 +260,320 @@ func TestProcessTests_InvalidTransaction(t *testing.T) {
 	assert.Contains(t, tst.tst.State.Err.Error(), "invalid transaction", "Error should mention invalid transaction")
 	assert.False(t, tst.processing, "Should not be processing after error")
 }
+
+func TestProcessTests_WaitUntilInUrlGroup(t *testing.T) {
+	// Save original state
+	originalTst := tst.tst
+	originalProcessing := tst.processing
+	defer func() {
+		tst.tst = originalTst
+		tst.processing = originalProcessing
+	}()
+
+	tst.tst = &plan.Plan{
+		State: &state.State{
+			Transaction: "waiting",
+			Variables:   map[string]interface{}{},
+			States: []state.StateEntry{
+				{TxnName: "waiting", Status: "running"},
+			},
+		},
+		Txn: []transaction.Transaction{
+			{
+				Name: "waiting",
+				InitAction: []planaction.PlanAction{
+					{
+						Type:         "url",
+						SatisfyGroup: "events",
+						Args:         map[string]interface{}{"url": "/events", "method": "POST"},
+					},
+					{
+						Type:         "wait_until",
+						SatisfyGroup: "events",
+						Args: map[string]interface{}{
+							"term": map[string]interface{}{
+								"variable":          "status",
+								"conditional":       "eq",
+								"conditional_value": "done",
+							},
+							"timeout":       "1m",
+							"advance_true":  "finished",
+							"advance_false": "timed_out",
+						},
+					},
+				},
+			},
+			{Name: "finished"},
+			{Name: "timed_out"},
+		},
+	}
+	abort := make(chan *bool, 1)
+
+	// no request and the variable isn't set, so it's still waiting.
+	ProcessTests(abort)
+	assert.Nil(t, tst.tst.State.Err, "Should not error while waiting")
+	assert.Equal(t, "waiting", tst.tst.State.Transaction, "Should still be waiting")
+	assert.NotEmpty(t, tst.tst.State.WaitRemaining, "Should report the time left")
+
+	tst.tst.State.Variables["status"] = "done"
+	ProcessTests(abort)
+	assert.Nil(t, tst.tst.State.Err, "Should not error when the condition is met")
+	assert.Equal(t, "finished", tst.tst.State.Transaction, "Should advance to advance_true")
+}
+
+func TestProcessTests_SetInUrlGroup(t *testing.T) {
+	originalTst := tst.tst
+	originalProcessing := tst.processing
+	defer func() {
+		tst.tst = originalTst
+		tst.processing = originalProcessing
+	}()
+
+	tst.tst = &plan.Plan{
+		State: &state.State{
+			Transaction: "waiting",
+			Variables:   map[string]interface{}{},
+			States:      []state.StateEntry{{TxnName: "waiting", Status: "running"}},
+		},
+		Txn: []transaction.Transaction{
+			{
+				Name: "waiting",
+				InitAction: []planaction.PlanAction{
+					{Type: "url", SatisfyGroup: "events", Args: map[string]interface{}{"url": "/events", "method": "POST"}},
+					{Type: "set", SatisfyGroup: "events", Args: map[string]interface{}{"variable": "status", "value": "done"}},
+				},
+			},
+		},
+	}
+	abort := make(chan *bool, 1)
+
+	// only wait_until runs while a group waits for a request.
+	ProcessTests(abort)
+	assert.Nil(t, tst.tst.State.Err, "Should not error while waiting")
+	assert.Equal(t, "waiting", tst.tst.State.Transaction, "Should still be waiting")
+	assert.Equal(t, 0, tst.tst.State.TxnActionIdx, "Should not have run anything")
+	assert.NotContains(t, tst.tst.State.Variables, "status", "Should not have run the set")
+}
+
+func TestProcessTests_OnError(t *testing.T) {
+	// Save original state
+	originalTst := tst.tst
+	originalProcessing := tst.processing
+	defer func() {
+		tst.tst = originalTst
+		tst.processing = originalProcessing
+	}()
+
+	fail := planaction.PlanAction{Type: "log"} // no value
+	advance := planaction.PlanAction{Type: "advance", Args: map[string]interface{}{"txn": "next"}}
+	tests := []struct {
+		name     string
+		actions  []planaction.PlanAction
+		txnError *planaction.OnError
+		planErr  string
+		passes   int
+		wantTxn  string
+		wantErr  bool
+		retries  int
+	}{
+		{
+			name:    "stops without on_error",
+			actions: []planaction.PlanAction{fail, advance},
+			passes:  2,
+			wantTxn: "a",
+			wantErr: true,
+		},
+		{
+			name: "continue",
+			actions: []planaction.PlanAction{
+				{Type: "log", OnError: &planaction.OnError{Continue: true}},
+				advance,
+			},
+			passes:  1,
+			wantTxn: "next",
+		},
+		{
+			name: "retry then advance",
+			actions: []planaction.PlanAction{
+				{Type: "log", OnError: &planaction.OnError{Retry: 2, Advance: "recover"}},
+				advance,
+			},
+			passes:  3,
+			wantTxn: "recover",
+			retries: 2,
+		},
+		{
+			name:    "still retrying",
+			actions: []planaction.PlanAction{{Type: "log", OnError: &planaction.OnError{Retry: 2, Advance: "recover"}}},
+			passes:  2,
+			wantTxn: "a",
+			retries: 2,
+		},
+		{
+			name:    "retry then stop",
+			actions: []planaction.PlanAction{{Type: "log", OnError: &planaction.OnError{Retry: 1}}},
+			passes:  3,
+			wantTxn: "a",
+			wantErr: true,
+			retries: 1,
+		},
+		{
+			name:     "transaction on_error",
+			actions:  []planaction.PlanAction{fail, advance},
+			txnError: &planaction.OnError{Advance: "recover"},
+			passes:   1,
+			wantTxn:  "recover",
+		},
+		{
+			name:     "action overrides transaction",
+			actions:  []planaction.PlanAction{{Type: "log", OnError: &planaction.OnError{Continue: true}}, advance},
+			txnError: &planaction.OnError{Advance: "recover"},
+			passes:   1,
+			wantTxn:  "next",
+		},
+		{
+			name:    "plan error_transaction",
+			actions: []planaction.PlanAction{fail, advance},
+			planErr: "recover",
+			passes:  1,
+			wantTxn: "recover",
+		},
+		{
+			name:    "failing in the error transaction",
+			actions: []planaction.PlanAction{fail},
+			planErr: "a",
+			passes:  2,
+			wantTxn: "a",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tst.tst = &plan.Plan{
+				ErrorTransaction: tt.planErr,
+				State: &state.State{
+					Transaction: "a",
+					Variables:   map[string]interface{}{},
+					States:      []state.StateEntry{{TxnName: "a", Status: "running"}},
+				},
+				Txn: []transaction.Transaction{
+					{Name: "a", InitAction: tt.actions, OnError: tt.txnError},
+					{Name: "next"},
+					{Name: "recover"},
+				},
+			}
+			abort := make(chan *bool, 1)
+			for i := 0; i < tt.passes; i++ {
+				ProcessTests(abort)
+			}
+			s := tst.tst.State
+			assert.Equal(t, tt.wantTxn, s.Transaction, "Should be in the right transaction")
+			assert.Equal(t, tt.wantErr, s.Err != nil, "Should only stop if nothing handles the error")
+			e, ok := s.Variables["error"].(map[string]interface{})
+			if assert.True(t, ok, "Should save the error") {
+				assert.Equal(t, "log", e["action"], "Should save the failed action")
+				assert.Equal(t, "a", e["transaction"], "Should save the failed transaction")
+				assert.NotEmpty(t, e["message"], "Should save the message")
+				assert.Equal(t, tt.retries, e["retries"], "Should save the retries")
+			}
+		})
+	}
+}
+
+func TestProcessTests_ErrorInCall(t *testing.T) {
+	originalTst := tst.tst
+	originalProcessing := tst.processing
+	defer func() {
+		tst.tst = originalTst
+		tst.processing = originalProcessing
+	}()
+
+	tst.tst = &plan.Plan{
+		ErrorTransaction: "recover",
+		State: &state.State{
+			Transaction: "a",
+			Variables:   map[string]interface{}{"order": "o1"},
+			States:      []state.StateEntry{{TxnName: "a", Status: "running"}},
+		},
+		Txn: []transaction.Transaction{
+			{Name: "a", InitAction: []planaction.PlanAction{{Type: "call", Args: map[string]interface{}{"plan": "auth"}}}},
+			{Name: "recover"},
+		},
+		Library: []plan.Plan{{Name: "auth", Txn: []transaction.Transaction{
+			{Name: "login", InitAction: []planaction.PlanAction{{Type: "log"}}}, // no value
+		}}},
+	}
+	abort := make(chan *bool, 1)
+	ProcessTests(abort)
+	assert.Equal(t, "login", tst.tst.State.Transaction, "Should be in the called plan")
+	ProcessTests(abort)
+	s := tst.tst.State
+	assert.Nil(t, s.Err, "Should go to the error_transaction instead of stopping")
+	assert.Equal(t, "recover", s.Transaction, "Should be in the plan's error_transaction")
+	assert.Empty(t, s.CallStack, "Should have left the called plan")
+	assert.Equal(t, "o1", s.Variables["order"], "Should have the caller's variables back")
+}
+
+func TestProcessTests_URLOnError(t *testing.T) {
+	// Save original state
+	originalTst := tst.tst
+	originalProcessing := tst.processing
+	defer func() {
+		tst.tst = originalTst
+		tst.processing = originalProcessing
+	}()
+	gin.SetMode(gin.TestMode)
+
+	// a bad regex makes the url action fail once it has the request.
+	bad := map[string]interface{}{"url": "/orders", "headers": map[interface{}]interface{}{
+		"X-Tenant": map[interface{}]interface{}{"regex": "("},
+	}}
+	tests := []struct {
+		name     string
+		onError  *planaction.OnError
+		requests int
+		wantTxn  string
+		wantErr  bool
+	}{
+		{name: "stop", requests: 1, wantTxn: "a", wantErr: true},
+		{name: "retry", onError: &planaction.OnError{Retry: 1}, requests: 2, wantTxn: "a", wantErr: true},
+		{name: "retry then advance", onError: &planaction.OnError{Retry: 1, Advance: "recover"}, requests: 2, wantTxn: "recover"},
+		{name: "continue", onError: &planaction.OnError{Continue: true}, requests: 1, wantTxn: "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tst.tst = &plan.Plan{
+				State: &state.State{
+					Transaction: "a",
+					Variables:   map[string]interface{}{},
+					States:      []state.StateEntry{{TxnName: "a", Status: "running"}},
+				},
+				Txn: []transaction.Transaction{
+					{Name: "a", InitAction: []planaction.PlanAction{{Type: "url", Args: bad, OnError: tt.onError}}},
+					{Name: "recover"},
+				},
+			}
+			for i := 0; i < tt.requests; i++ {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				c.Request = httptest.NewRequest("GET", "/orders", nil)
+				finished := make(chan bool, 1)
+				q.Add(&actions.QueueContext{Ctx: c, Finished: finished})
+
+				ProcessTests(make(chan *bool, 1))
+
+				select {
+				case <-finished:
+				default:
+					t.Fatalf("request %d wasn't answered", i+1)
+				}
+				assert.Equal(t, 500, w.Code, "Should send a server error")
+				assert.Contains(t, w.Body.String(), "error parsing regexp", "Should send the error")
+			}
+			s := tst.tst.State
+			assert.Equal(t, tt.wantTxn, s.Transaction, "Should be in the right transaction")
+			assert.Equal(t, tt.wantErr, s.Err != nil, "Should only stop if nothing handles the error")
+			assert.Nil(t, q.GetUrl(), "Should have taken every request")
+		})
+	}
+}
@@ -7,6 +7,8 @@ package main
 
 import (
 	"fmt"
+	"github.com/homedepot/trainer/actions"
+	"github.com/homedepot/trainer/broker"
 	"github.com/homedepot/trainer/cli"
 	"github.com/homedepot/trainer/config"
 	"github.com/homedepot/trainer/handler"
@@ -82,6 +84,8 @@ func main() {
 	h.Start()
 	wg.Wait()
 	h.Stop()
+	broker.CloseAll()
+	actions.CloseDatabases()
 }
 
 // LoadConfig takes a config file and sets
@@ -102,6 +106,19 @@ func LoadConfig(opt cli.Options) *config.Config {
 		logger.Criticalf("Couldn't load config: %s", err.Error())
 		os.Exit(1)
 	}
+	for name, bc := range c.Brokers {
+		if _, err := broker.Open(name, bc); err != nil {
+			logger.Criticalf("Couldn't open broker: %s", err.Error())
+			os.Exit(1)
+		}
+	}
+	for name, db := range c.Databases {
+		if err := actions.RegisterDatabase(name, db); err != nil {
+			logger.Criticalf("Couldn't register database: %s", err.Error())
+			os.Exit(1)
+		}
+	}
+	handler.SetStubs(c.Stubs, c.Bases)
 	return c
 }
 
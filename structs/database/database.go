@@ -0,0 +1,21 @@
+package database
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+// Database is a database the sql action can query, by name.  Driver is a
+// database/sql driver name; sqlite is built in.
+type Database struct {
+	Driver string `yaml:"driver" json:"driver"`
+	DSN    string `yaml:"dsn" json:"-"` // may hold a password, so it's not in status output
+}
+
+// MarshalYAML leaves the dsn out, so the config endpoint doesn't give away
+// passwords.
+func (d Database) MarshalYAML() (interface{}, error) {
+	return struct {
+		Driver string `yaml:"driver"`
+	}{d.Driver}, nil
+}
@@ -0,0 +1,31 @@
+package database
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestDatabase_MarshalYAML(t *testing.T) {
+	in := "driver: sqlite\ndsn: file:secret.db\n"
+	var d Database
+	if err := yaml.Unmarshal([]byte(in), &d); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if d.DSN != "file:secret.db" {
+		t.Errorf("DSN = %s, want file:secret.db", d.DSN)
+	}
+	out, err := yaml.Marshal(map[string]Database{"orders": d})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if strings.Contains(string(out), "secret") || !strings.Contains(string(out), "sqlite") {
+		t.Errorf("Marshal() = %s, want the driver and not the dsn", out)
+	}
+}
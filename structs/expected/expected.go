@@ -11,9 +11,18 @@ import (
 
 // TODO comment this
 type Expected struct {
-	Response     string                  `yaml:"response" json:"response"`
-	ResponseCode string                  `yaml:"response_code" json:"response_code" mapstructure:"response_code"`
-	ResponseType string                  `yaml:"response_contenttype" json:"respoonse_contenttype" mapstructure:"response_code"`
-	Action       []planaction.PlanAction `yaml:"action" json:"action"`
-	Expected     bool                    `yaml:"-" json:"-"`
+	Response        string                  `yaml:"response" json:"response"`
+	ResponseCode    string                  `yaml:"response_code" json:"response_code" mapstructure:"response_code"`
+	ResponseType    string                  `yaml:"response_contenttype" json:"response_contenttype" mapstructure:"response_contenttype"`
+	ResponseHeaders map[string]string       `yaml:"response_headers" json:"response_headers" mapstructure:"response_headers"`
+	Body            interface{}             `yaml:"body" json:"body" mapstructure:"body"`                            // instead of a response file
+	BodyFromVar     string                  `yaml:"body_from_var" json:"body_from_var" mapstructure:"body_from_var"` // or a variable
+	Fault           *Fault                  `yaml:"fault" json:"fault,omitempty" mapstructure:"fault"`
+	Action          []planaction.PlanAction `yaml:"action" json:"action"`
+	Expected        bool                    `yaml:"-" json:"-"`
+}
+
+// HasBody reports whether a response file, body or body_from_var was given.
+func (e Expected) HasBody() bool {
+	return e.Response != "" || e.Body != nil || e.BodyFromVar != ""
 }
@@ -0,0 +1,135 @@
+package expected
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Fault makes a response misbehave, the way a flaky service would.  It can
+// be given on a url action, or in an on_expected (including a rule's or a
+// sequence's), which wins over the action's.
+type Fault struct {
+	Delay       string   `yaml:"delay" json:"delay,omitempty" mapstructure:"delay"`                   // wait this long before responding
+	DelayMax    string   `yaml:"delay_max" json:"delay_max,omitempty" mapstructure:"delay_max"`       // with delay, wait a random time between the two
+	ChunkSize   int      `yaml:"chunk_size" json:"chunk_size,omitempty" mapstructure:"chunk_size"`    // send the body in chunks this big
+	ChunkDelay  string   `yaml:"chunk_delay" json:"chunk_delay,omitempty" mapstructure:"chunk_delay"` // and wait this long between them
+	Truncate    *int     `yaml:"truncate" json:"truncate,omitempty" mapstructure:"truncate"`          // send only this much of the body
+	Reset       bool     `yaml:"reset" json:"reset,omitempty" mapstructure:"reset"`                   // reset the connection instead of responding
+	Empty       bool     `yaml:"empty" json:"empty,omitempty" mapstructure:"empty"`                   // close the connection instead of responding
+	ErrorCode   int      `yaml:"error_code" json:"error_code,omitempty" mapstructure:"error_code"`    // send this code, with no body, instead
+	Probability *float64 `yaml:"probability" json:"probability,omitempty" mapstructure:"probability"` // how often the fault happens, from 0 to 1 (default always)
+}
+
+// Injection is a fault as it was picked for one response.
+type Injection struct {
+	Delay      time.Duration
+	ChunkSize  int
+	ChunkDelay time.Duration
+	Truncate   int // -1 for the whole body
+	Reset      bool
+	Empty      bool
+	ErrorCode  int
+}
+
+// Validate checks that the fault makes sense.
+func (f *Fault) Validate() error {
+	for _, d := range []struct{ name, value string }{
+		{"delay", f.Delay}, {"delay_max", f.DelayMax}, {"chunk_delay", f.ChunkDelay},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d.value); err != nil || v < 0 {
+			return fmt.Errorf("fault: invalid %s %s", d.name, d.value)
+		}
+	}
+	if f.DelayMax != "" && f.Delay == "" {
+		return errors.New("fault: delay_max needs a delay")
+	}
+	if f.ChunkSize < 0 || (f.Truncate != nil && *f.Truncate < 0) {
+		return errors.New("fault: chunk_size and truncate can't be negative")
+	}
+	if f.ChunkDelay != "" && f.ChunkSize == 0 {
+		return errors.New("fault: chunk_delay needs a chunk_size")
+	}
+	if f.Reset && f.Empty {
+		return errors.New("fault: only one of reset and empty can be set")
+	}
+	if f.ErrorCode != 0 && (f.ErrorCode < 100 || f.ErrorCode > 999) {
+		return fmt.Errorf("fault: invalid error_code %d", f.ErrorCode)
+	}
+	if f.Probability != nil && (*f.Probability < 0 || *f.Probability > 1) {
+		return errors.New("fault: probability has to be between 0 and 1")
+	}
+	return nil
+}
+
+// Pick decides whether the fault happens this time, and how long any random
+// delay is.  It returns nil if there's no fault this time.
+func (f *Fault) Pick(r *rand.Rand) (*Injection, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	if f.Probability != nil && r.Float64() >= *f.Probability {
+		return nil, nil
+	}
+	in := &Injection{
+		ChunkSize: f.ChunkSize,
+		Truncate:  -1,
+		Reset:     f.Reset,
+		Empty:     f.Empty,
+		ErrorCode: f.ErrorCode,
+	}
+	if f.Truncate != nil {
+		in.Truncate = *f.Truncate
+	}
+	in.ChunkDelay, _ = parseDuration(f.ChunkDelay)
+	in.Delay, _ = parseDuration(f.Delay)
+	if max, _ := parseDuration(f.DelayMax); max > in.Delay {
+		in.Delay += time.Duration(r.Int63n(int64(max - in.Delay + 1)))
+	}
+	return in, nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// String describes the injection, for the run's state.
+func (in *Injection) String() string {
+	var out []string
+	if in.Delay > 0 {
+		out = append(out, "delay "+in.Delay.String())
+	}
+	switch {
+	case in.Reset:
+		out = append(out, "reset")
+	case in.Empty:
+		out = append(out, "empty")
+	default:
+		if in.ErrorCode != 0 {
+			out = append(out, fmt.Sprintf("error_code %d", in.ErrorCode))
+		}
+		if in.Truncate >= 0 {
+			out = append(out, fmt.Sprintf("truncate %d", in.Truncate))
+		}
+		if in.ChunkSize > 0 {
+			out = append(out, fmt.Sprintf("chunks of %d every %s", in.ChunkSize, in.ChunkDelay))
+		}
+	}
+	if len(out) == 0 {
+		return "none"
+	}
+	return strings.Join(out, ", ")
+}
@@ -0,0 +1,100 @@
+package expected
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestFault_Validate(t *testing.T) {
+	n, half, two := -1, 0.5, 2.0
+	tests := []struct {
+		name    string
+		f       Fault
+		wantErr bool
+	}{
+		{name: "delays", f: Fault{Delay: "10ms", DelayMax: "1s"}},
+		{name: "chunks", f: Fault{ChunkSize: 4, ChunkDelay: "5ms", Probability: &half}},
+		{name: "bad delay", f: Fault{Delay: "soon"}, wantErr: true},
+		{name: "negative delay", f: Fault{Delay: "-1s"}, wantErr: true},
+		{name: "delay_max alone", f: Fault{DelayMax: "1s"}, wantErr: true},
+		{name: "chunk_delay alone", f: Fault{ChunkDelay: "1s"}, wantErr: true},
+		{name: "negative truncate", f: Fault{Truncate: &n}, wantErr: true},
+		{name: "reset and empty", f: Fault{Reset: true, Empty: true}, wantErr: true},
+		{name: "bad error_code", f: Fault{ErrorCode: 42}, wantErr: true},
+		{name: "bad probability", f: Fault{Probability: &two}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.f.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFault_Pick(t *testing.T) {
+	zero, half, ten := 0.0, 0.5, 10
+	tests := []struct {
+		name string
+		f    Fault
+		want string
+	}{
+		{name: "never", f: Fault{ErrorCode: 503, Probability: &zero}},
+		{name: "error", f: Fault{ErrorCode: 503}, want: "error_code 503"},
+		{name: "truncate and chunks", f: Fault{Truncate: &ten, ChunkSize: 2, ChunkDelay: "1ms"}, want: "truncate 10, chunks of 2 every 1ms"},
+		{name: "reset", f: Fault{Reset: true, Delay: "1s"}, want: "delay 1s, reset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in, err := tt.f.Pick(rand.New(rand.NewSource(1)))
+			if err != nil {
+				t.Fatalf("Pick() error = %v", err)
+			}
+			got := ""
+			if in != nil {
+				got = in.String()
+			}
+			if got != tt.want {
+				t.Errorf("Pick() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// the same seed picks the same faults.
+	f := Fault{Delay: "10ms", DelayMax: "50ms", ErrorCode: 500, Probability: &half}
+	pick := func(seed int64) []string {
+		r := rand.New(rand.NewSource(seed))
+		var out []string
+		for i := 0; i < 20; i++ {
+			in, _ := f.Pick(r)
+			if in == nil {
+				out = append(out, "none")
+				continue
+			}
+			if in.Delay < 10*time.Millisecond || in.Delay > 50*time.Millisecond {
+				t.Errorf("delay %s out of range", in.Delay)
+			}
+			out = append(out, in.String())
+		}
+		return out
+	}
+	a, b := pick(7), pick(7)
+	faults := 0
+	for i := range a {
+		if a[i] != b[i] {
+			t.Errorf("pick %d: %q and %q from the same seed", i, a[i], b[i])
+		}
+		if a[i] != "none" {
+			faults++
+		}
+	}
+	if faults == 0 || faults == len(a) {
+		t.Errorf("%d of %d picks had a fault with probability 0.5", faults, len(a))
+	}
+}
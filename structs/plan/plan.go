@@ -6,17 +6,17 @@ package plan
 // See LICENSE for further details.
 
 import (
-	"bytes"
 	"errors"
+	"fmt"
 	"github.com/homedepot/trainer/security"
 	"github.com/homedepot/trainer/structs/state"
+	"github.com/homedepot/trainer/structs/stub"
 	"github.com/homedepot/trainer/structs/transaction"
+	"github.com/homedepot/trainer/templates"
 	"github.com/juju/loggo"
 	"github.com/mohae/deepcopy"
 	"gopkg.in/yaml.v2"
 	"os"
-	"reflect"
-	"text/template"
 	"time"
 )
 
@@ -33,6 +33,14 @@ type Plan struct {
 	TxnIncludes      []TxnInclude              `yaml:"txninclude" json:"txninclude"`
 	StopVar          string                    `yaml:"stop_var" json:"stop_var"`
 	State            *state.State              `yaml:"state" json:"state"`
+	Library          []Plan                    `yaml:"-" json:"-"`                                 // the plans that can be called from this one
+	Seed             int64                     `yaml:"seed" json:"seed"`                           // the seed for generated data, to repeat a run
+	SeedTime         string                    `yaml:"seed_time" json:"seed_time"`                 // what generated dates are relative to, to repeat a run
+	ErrorTransaction string                    `yaml:"error_transaction" json:"error_transaction"` // where to go when an action fails, if nothing else says
+	Setup            []transaction.Transaction `yaml:"setup" json:"setup"`                         // run before the start transaction
+	Teardown         []transaction.Transaction `yaml:"teardown" json:"teardown"`                   // run after the run ends, however it ends
+	Timeout          string                    `yaml:"timeout" json:"timeout"`                     // how long the main run can take
+	Stubs            []stub.Stub               `yaml:"stubs" json:"stubs"`                         // answered whenever this plan is running
 }
 
 type TxnInclude struct {
@@ -94,32 +102,18 @@ func (p *Plan) LoadTxnFile(txn TxnInclude) error {
 		return err
 	}
 
-	at := struct {
-		Variables map[string]string
-	}{}
-
-	at.Variables = make(map[string]string, 0)
-	for i, v := range txn.Variables {
-		if reflect.TypeOf(v).String() == "string" {
-			at.Variables[i] = v.(string)
-		}
-	}
-	if len(at.Variables) > 0 {
+	if len(txn.Variables) > 0 {
 		logger.Debugf("Parsing template...")
-		tt := template.New("local1")
-		tt.Delims("[[", "]]")
-		tpl, err := tt.Parse(string(str))
-		if err != nil {
-			logger.Warningf("Error parsing template: %s", err.Error())
-			return err
+		at := struct {
+			Variables map[string]interface{}
+		}{
+			Variables: txn.Variables,
 		}
-		var b bytes.Buffer
-		err = tpl.Execute(&b, at)
+		out, err := templates.RenderDelims("txninclude", string(str), "[[", "]]", at)
 		if err != nil {
-			logger.Warningf("Error executing template: %s.  It's still alive.", err.Error())
 			return err
 		}
-		str = b.Bytes()
+		str = []byte(out)
 	}
 
 	if len(str) == 0 {
@@ -139,13 +133,71 @@ func (p *Plan) LoadTxnFile(txn TxnInclude) error {
 	return nil
 }
 
+// FindTransaction finds a transaction by name.  While another plan has been
+// called, its transactions are looked in first, then those of the plans that
+// called it, and then this plan's.
 func (p *Plan) FindTransaction(name string) (*transaction.Transaction, error) {
-	for i, _ := range p.Txn {
-		if p.Txn[i].Name == name {
-			return &p.Txn[i], nil
+	t, _, err := p.findTransaction(name)
+	return t, err
+}
+
+// findTransaction is FindTransaction, but also returns how many calls deep
+// the transaction was found: 0 for this plan's own transactions.
+func (p *Plan) findTransaction(name string) (*transaction.Transaction, int, error) {
+	var frames []*state.CallFrame
+	if p.State != nil {
+		frames = p.State.CallStack
+	}
+	for depth := len(frames); depth >= 0; depth-- {
+		txns := p.Txn
+		if depth > 0 {
+			txns = frames[depth-1].Txn
+		}
+		for i, _ := range txns {
+			if txns[i].Name == name {
+				return &txns[i], depth, nil
+			}
+		}
+	}
+	return nil, 0, errors.New("no such transaction")
+}
+
+// unwind drops the calls deeper than depth, as if they had returned without
+// any outputs.  It's used when a called plan advances to a transaction of a
+// plan that called it, on an error for example.
+func (p *Plan) unwind(depth int) {
+	logger := loggo.GetLogger("default")
+	for len(p.State.CallStack) > depth {
+		f := p.State.CallStack[len(p.State.CallStack)-1]
+		logger.Infof("leaving called plan %s", f.Plan)
+		p.State.CallStack = p.State.CallStack[:len(p.State.CallStack)-1]
+		if f.Isolated {
+			p.State.Variables = f.Variables
 		}
 	}
-	return nil, errors.New("no such transaction")
+}
+
+// FindLibraryPlan finds a plan that can be called from this one.
+func (p *Plan) FindLibraryPlan(name string) (*Plan, error) {
+	for i, _ := range p.Library {
+		if p.Library[i].Name == name {
+			return &p.Library[i], nil
+		}
+	}
+	return nil, errors.New("failed to locate plan " + name)
+}
+
+// ParseSeedTime returns the time the plan's generated dates are relative to,
+// which is now unless the plan has a seed_time.
+func (p *Plan) ParseSeedTime() (time.Time, error) {
+	if p.SeedTime == "" {
+		return time.Now(), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, p.SeedTime)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("seed_time: %w", err)
+	}
+	return t, nil
 }
 
 func (p *Plan) Reset() error {
@@ -156,6 +208,11 @@ func (p *Plan) Reset() error {
 	p.CurrentTimer = 0
 
 	p.State = state.NewState(txn.Name)
+	p.State.Seed = p.Seed
+	p.State.SeedTime, err = p.ParseSeedTime()
+	if err != nil {
+		return err
+	}
 
 	err = p.State.Reset(txn.Name)
 	if err != nil {
@@ -165,15 +222,23 @@ func (p *Plan) Reset() error {
 	res := deepcopy.Copy(p.DefaultVars)
 	p.State.Variables = res.(map[string]interface{})
 
+	if len(p.Setup) > 0 {
+		p.State.Phase = state.PhaseSetup
+		p.State.Setup = &state.HookState{Status: "running"}
+	} else {
+		p.State.StartRun()
+	}
+
 	return nil
 }
 
 func (p *Plan) Advance(name string) error {
 	logger := loggo.GetLogger("default")
-	t, err := p.FindTransaction(name)
+	t, depth, err := p.findTransaction(name)
 	if err != nil {
 		return err
 	}
+	p.unwind(depth)
 
 	logger.Infof("Entering transaction %s", t.Name)
 	p.State.NewState(t.Name)
@@ -189,49 +254,24 @@ func (p *Plan) GetCurrentTransaction() (*transaction.Transaction, error) {
 	return t, nil
 }
 
-func (p *Plan) ParseTemplate(in string) string {
-
-	logger := loggo.GetLogger("default")
-
-	t := time.Now()
-	mt, err := t.MarshalText()
-	if err != nil {
-		logger.Criticalf("Couldn't marshal time: %s", err.Error())
-		panic("AIEEEEEEEEE")
-	}
-
-	// Anonymous arg template struct.
-	at := struct {
-		Variables map[string]string
-		Bases     map[string]string
-		Now       string
-	}{
-		Bases: p.Bases,
-		Now:   string(mt),
+// TemplateData is what templates for this plan get to work with.
+func (p *Plan) TemplateData() *templates.Data {
+	var vars map[string]interface{}
+	if p.State != nil {
+		vars = p.State.Variables
 	}
+	return templates.NewData(vars, p.Bases)
+}
 
-	at.Variables = make(map[string]string, 0)
+// ParseTemplate runs a template over the plan's variables and bases.
+func (p *Plan) ParseTemplate(in string) (string, error) {
+	return templates.Render("plan", in, p.TemplateData())
+}
 
-	// Only template the string variables.  It doesn't make much sense
-	// for any other type.
-	for i, v := range p.State.Variables {
-		if reflect.TypeOf(v).String() == "string" {
-			at.Variables[i] = v.(string)
-		}
-	}
-	tt := template.New("local")
-	tt.Delims("<<", ">>")
-	tpl, err := tt.Parse(in)
-	if err != nil {
-		logger.Warningf("Error parsing template: %s", err.Error())
-		return in
-	}
-	var b bytes.Buffer
-	err = tpl.Execute(&b, at)
-	if err != nil {
-		logger.Warningf("Error executing template: %s.  It's still alive.", err.Error())
-		return in
-	}
-	logger.Debugf("returning: %s", b.String())
-	return b.String()
+// ParseRequestTemplate is ParseTemplate for a response, which can use the
+// request it's answering as well.
+func (p *Plan) ParseRequestTemplate(in string, req *templates.Request) (string, error) {
+	data := p.TemplateData()
+	data.Request = req
+	return templates.Render("plan", in, data)
 }
@@ -1,8 +1,11 @@
 package plan
 
 import (
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/homedepot/trainer/structs/state"
 	"github.com/homedepot/trainer/structs/transaction"
 )
 
@@ -56,3 +59,186 @@ func TestGetFirstTxn(t *testing.T) {
 		t.Error("GetFirstTxn() should error on empty plan")
 	}
 }
+
+func TestReset_Seed(t *testing.T) {
+	p := &Plan{
+		Txn:         []transaction.Transaction{{Name: "first"}},
+		DefaultVars: map[string]interface{}{},
+		Seed:        42,
+	}
+	err := p.Reset()
+	if err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	if p.State.Seed != 42 {
+		t.Errorf("Reset() seed = %d, want 42", p.State.Seed)
+	}
+	a := p.State.Random().Int63()
+
+	err = p.Reset()
+	if err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	if b := p.State.Random().Int63(); a != b {
+		t.Errorf("Reset() with the same seed gave %d then %d", a, b)
+	}
+}
+
+func TestReset_SeedTime(t *testing.T) {
+	p := &Plan{
+		Txn:         []transaction.Transaction{{Name: "first"}},
+		DefaultVars: map[string]interface{}{},
+		SeedTime:    "2021-10-18T14:38:10.5Z",
+	}
+	if err := p.Reset(); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	want := time.Date(2021, 10, 18, 14, 38, 10, 500000000, time.UTC)
+	if !p.State.SeedNow().Equal(want) {
+		t.Errorf("Reset() seed time = %v, want %v", p.State.SeedNow(), want)
+	}
+
+	p.SeedTime = ""
+	before := time.Now()
+	if err := p.Reset(); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	if p.State.SeedTime.Before(before) || p.State.SeedTime.After(time.Now()) {
+		t.Errorf("Reset() seed time = %v, want the time of the reset", p.State.SeedTime)
+	}
+
+	p.SeedTime = "yesterday"
+	if err := p.Reset(); err == nil {
+		t.Errorf("Reset() expected error for a bad seed_time")
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		variables map[string]interface{}
+		bases     map[string]string
+		expected  string
+		wantErr   bool
+	}{
+		{
+			name:      "simple variable substitution",
+			input:     "Hello <<.Variables.name>>",
+			variables: map[string]interface{}{"name": "World"},
+			expected:  "Hello World",
+		},
+		{
+			name:     "base URL substitution",
+			input:    `URL: <<index .Bases "api">>`,
+			bases:    map[string]string{"api": "https://api.example.com"},
+			expected: "URL: https://api.example.com",
+		},
+		{
+			name:      "non-string variable",
+			input:     "Count: <<.Variables.count>>",
+			variables: map[string]interface{}{"count": 42},
+			expected:  "Count: 42",
+		},
+		{
+			name:  "nested variables",
+			input: `<<.Variables.order.id>> <<index .Variables "order" "items" 1 "sku">>`,
+			variables: map[string]interface{}{
+				"order": map[interface{}]interface{}{
+					"id": "o1",
+					"items": []interface{}{
+						map[string]interface{}{"sku": "a"},
+						map[string]interface{}{"sku": "b"},
+					},
+				},
+			},
+			expected: "o1 b",
+		},
+		{
+			name:     "missing variable with index",
+			input:    `auth: "<<index .Variables "authorization">>"`,
+			expected: `auth: ""`,
+		},
+		{
+			name:      "functions",
+			input:     `<<.Variables.list | toJson>> <<upper "a">> <<add .Variables.count 1>> <<index .Variables "missing" | default "x">>`,
+			variables: map[string]interface{}{"list": []interface{}{1, "b"}, "count": "41"},
+			expected:  `[1,"b"] A 42 x`,
+		},
+		{
+			name:     "template with Now timestamp",
+			input:    "Time: <<.Now>>",
+			expected: "Time: ",
+		},
+		{
+			name:    "invalid template is an error",
+			input:   "Bad template <<.Missing",
+			wantErr: true,
+		},
+		{
+			name:    "failing function is an error",
+			input:   `<<b64dec "not base64!">>`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := tt.variables
+			if vars == nil {
+				vars = map[string]interface{}{}
+			}
+			p := &Plan{State: &state.State{Variables: vars}, Bases: tt.bases}
+			result, err := p.ParseTemplate(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseTemplate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.name == "template with Now timestamp" {
+				if !strings.HasPrefix(result, tt.expected) || len(result) <= len(tt.expected) {
+					t.Errorf("ParseTemplate() = %q, want a time after %q", result, tt.expected)
+				}
+			} else if result != tt.expected {
+				t.Errorf("ParseTemplate() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFindTransaction_Called(t *testing.T) {
+	p := &Plan{
+		Txn: []transaction.Transaction{{Name: "main"}, {Name: "failed"}},
+		State: &state.State{
+			Transaction: "login",
+			Variables:   map[string]interface{}{"token": "abc"},
+			CallStack: []*state.CallFrame{{
+				Plan:      "auth",
+				ReturnTxn: "main",
+				Isolated:  true,
+				Variables: map[string]interface{}{"user": "u1"},
+				Txn:       []transaction.Transaction{{Name: "login"}, {Name: "main"}},
+			}},
+		},
+	}
+
+	txn, err := p.FindTransaction("main")
+	if err != nil || txn != &p.State.CallStack[0].Txn[1] {
+		t.Errorf("FindTransaction() = %v, %v, want the called plan's main", txn, err)
+	}
+	if err := p.Advance("login"); err != nil || len(p.State.CallStack) != 1 {
+		t.Fatalf("Advance(login) = %v, calls %d, want nil, 1", err, len(p.State.CallStack))
+	}
+
+	if err := p.Advance("failed"); err != nil {
+		t.Fatalf("Advance(failed) = %v, want nil", err)
+	}
+	if len(p.State.CallStack) != 0 || p.State.Transaction != "failed" {
+		t.Errorf("Advance(failed) left calls %d in %s, want 0 in failed", len(p.State.CallStack), p.State.Transaction)
+	}
+	if p.State.Variables["user"] != "u1" || p.State.Variables["token"] != nil {
+		t.Errorf("Advance(failed) variables = %v, want the caller's", p.State.Variables)
+	}
+}
@@ -10,4 +10,15 @@ type PlanAction struct {
 	Type         string                 `yaml:"type" json:"type"`
 	SatisfyGroup string                 `yaml:"satisfy_group" json:"satisfy_group"`
 	Args         map[string]interface{} `yaml:"args" json:"args"`
+	OnError      *OnError               `yaml:"on_error" json:"on_error,omitempty"`
+}
+
+// OnError says what to do when an action fails, instead of stopping the
+// test.  Failed actions are retried first, if Retry is set, and then the
+// test either advances to another transaction or carries on with the next
+// action.  With neither, the test stops as it always has.
+type OnError struct {
+	Advance  string `yaml:"advance" json:"advance,omitempty"`
+	Continue bool   `yaml:"continue" json:"continue,omitempty"`
+	Retry    int    `yaml:"retry" json:"retry,omitempty"`
 }
@@ -0,0 +1,49 @@
+package plugin
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import "encoding/json"
+
+// Plugin is an action type that's implemented by an external program.
+// Trainer runs Command each time the action runs, writes the request to its
+// stdin as JSON, and reads the reply from its stdout.
+type Plugin struct {
+	Name         string            `yaml:"name" json:"name"`
+	Command      string            `yaml:"command" json:"command"`
+	Args         []string          `yaml:"args" json:"args"`
+	Env          map[string]string `yaml:"env" json:"env"`
+	Dir          string            `yaml:"dir" json:"dir"`
+	Timeout      string            `yaml:"timeout" json:"timeout"`             // a go duration, or seconds
+	RequiredArgs []string          `yaml:"required_args" json:"required_args"` // checked when the config is loaded
+}
+
+// Redacted returns the plugin with the values of its environment hidden,
+// since they're often secrets.  The names are kept.
+func (p Plugin) Redacted() Plugin {
+	if p.Env == nil {
+		return p
+	}
+	env := make(map[string]string, len(p.Env))
+	for k := range p.Env {
+		env[k] = "xxxxx"
+	}
+	p.Env = env
+	return p
+}
+
+// plainPlugin is a Plugin without the marshalers, so they don't call themselves.
+type plainPlugin Plugin
+
+// MarshalYAML hides the environment values, so the config endpoint doesn't
+// give them away.
+func (p Plugin) MarshalYAML() (interface{}, error) {
+	return plainPlugin(p.Redacted()), nil
+}
+
+// MarshalJSON does the same for json.
+func (p Plugin) MarshalJSON() ([]byte, error) {
+	return json.Marshal(plainPlugin(p.Redacted()))
+}
@@ -0,0 +1,41 @@
+package plugin
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestPlugin_Marshal(t *testing.T) {
+	in := "name: stock\ncommand: ./stock\nenv:\n  STOCK_TOKEN: s3cret\n"
+	var p Plugin
+	if err := yaml.Unmarshal([]byte(in), &p); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if p.Env["STOCK_TOKEN"] != "s3cret" {
+		t.Errorf("Env = %v, want the token", p.Env)
+	}
+	y, err := yaml.Marshal([]Plugin{p})
+	if err != nil {
+		t.Fatalf("yaml.Marshal() error = %v", err)
+	}
+	j, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	for _, out := range []string{string(y), string(j)} {
+		if strings.Contains(out, "s3cret") || !strings.Contains(out, "STOCK_TOKEN") || !strings.Contains(out, "./stock") {
+			t.Errorf("Marshal() = %s, want the env names and not the values", out)
+		}
+	}
+	if p.Env["STOCK_TOKEN"] != "s3cret" {
+		t.Errorf("Marshal() changed the plugin's env to %v", p.Env)
+	}
+}
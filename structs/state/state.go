@@ -8,11 +8,13 @@ package state
 import (
 	"errors"
 	"fmt"
+	"math/rand"
 	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/homedepot/trainer/structs/transaction"
 	"github.com/juju/loggo"
 )
 
@@ -28,11 +30,151 @@ type State struct {
 	States              []StateEntry
 	RunnerKillSwitch    bool
 	Variables           map[string]interface{}
-	TxnActionIdx        int       // index of completed actions
-	TxnActionsCompleted bool      // whether the initactions are entirely completed
-	Err                 error     // put any errors here, also blocks any further progress
-	WaitActionStartTime time.Time // for waits
+	TxnActionIdx        int           // index of completed actions
+	TxnActionsCompleted bool          // whether the initactions are entirely completed
+	Err                 error         // put any errors here, also blocks any further progress
+	Retries             int           // how many times the current action has been retried after failing
+	WaitActionStartTime time.Time     // for waits
+	WaitActionTxn       string        // the transaction the current wait started in
+	WaitActionDuration  time.Duration // how long the current wait is, once it's picked
+	WaitRemaining       string        // how long the current wait has left, for status
 	AbortRunningAction  bool
+	Loops               map[string]*LoopState // foreach loops in progress, by name
+	CallStack           []*CallFrame          // plans called from this one, innermost last
+	Poll                *PollState            // the poll in progress, if there is one
+	Plugin              *PluginState          // the plugin process in progress, if there is one
+	Seed                int64                 // the seed for generated data, so a run can be repeated
+	SeedTime            time.Time             // what generated dates are relative to, so a run can be repeated
+	Rand                *rand.Rand            `json:"-"`
+	FaultRand           *rand.Rand            `json:"-"` // for faults, apart from Rand
+	Phase               string                // setup, run, teardown or finished
+	Started             time.Time             // when the main run started, after any setup
+	Result              string                // how the main run ended, once it has
+	Setup               *HookState            // how the setup transactions went, if there are any
+	Teardown            *HookState            // how the teardown transactions went, once they've started
+	Calls               map[string]int        // requests each url action has answered since its transaction was entered
+	Faults              []FaultEntry          // faults injected into responses
+	Stubs               map[string]int        // calls to the plan's stubs
+	GlobalStubs         map[string]int        // calls to the global stubs, since trainer started
+}
+
+// FaultEntry is a fault that was injected into a response.
+type FaultEntry struct {
+	Time  time.Time
+	Txn   string
+	Path  string
+	Fault string
+}
+
+// The parts of a run.  Setup and teardown are only there if the plan has
+// transactions for them.
+const (
+	PhaseSetup    = "setup"
+	PhaseRun      = "run"
+	PhaseTeardown = "teardown"
+	PhaseFinished = "finished"
+)
+
+// How the main run ended.
+const (
+	ResultStopped  = "stopped"   // the stop_var was set
+	ResultErrored  = "errored"   // an error stopped it
+	ResultTimedOut = "timed_out" // it took longer than the plan's timeout
+	ResultRemoved  = "removed"   // it was removed before it finished
+	ResultSkipped  = "skipped"   // the setup failed, so it never ran
+)
+
+// HookState tracks the setup or teardown transactions, separately from the
+// main run.
+type HookState struct {
+	Status    string       // running, completed, errored or removed
+	States    []StateEntry // each transaction, and how it went
+	Err       string       // the first error, if there was one
+	Index     int          // the transaction being run
+	ActionIdx int          // the action being run in it
+}
+
+// PollState tracks a poll action between attempts.
+type PollState struct {
+	Attempts int
+	Interval time.Duration
+	Next     time.Time // when the next attempt is due
+}
+
+// PluginState tracks a plugin process that hasn't finished yet.
+type PluginState struct {
+	ID      string
+	Name    string
+	Txn     string // the transaction it was started in
+	Started time.Time
+}
+
+// CallFrame is a plan that has been called from another plan, along with
+// what's needed to get back to the caller when it returns.
+type CallFrame struct {
+	Plan      string
+	ReturnTxn string                    // the transaction that made the call
+	ReturnIdx int                       // the index of the call action in that transaction
+	Isolated  bool                      // whether the called plan has its own variables
+	Variables map[string]interface{}    `json:"-"` // the caller's variables, if isolated
+	Outputs   map[string]string         // caller variable -> called plan variable
+	Txn       []transaction.Transaction `json:"-"` // the called plan's transactions
+}
+
+// CurrentFrame returns the innermost plan call, or nil if there isn't one.
+func (s *State) CurrentFrame() *CallFrame {
+	if len(s.CallStack) == 0 {
+		return nil
+	}
+	return s.CallStack[len(s.CallStack)-1]
+}
+
+// Random returns the run's random number generator, seeding it the first
+// time it's needed.  With no seed, one is picked (and kept, so the run can
+// be repeated).
+func (s *State) Random() *rand.Rand {
+	if s.Rand == nil {
+		if s.Seed == 0 {
+			s.Seed = time.Now().UnixNano()
+		}
+		s.Rand = rand.New(rand.NewSource(s.Seed))
+	}
+	return s.Rand
+}
+
+// FaultRandom returns the random number generator for faults.  It's kept
+// apart from Random, so that how many requests come in, and when, doesn't
+// change the generated data.  It's seeded from the run's seed plus one.
+func (s *State) FaultRandom() *rand.Rand {
+	if s.FaultRand == nil {
+		// picks the seed, if there isn't one yet.
+		s.Random()
+		s.FaultRand = rand.New(rand.NewSource(s.Seed + 1))
+	}
+	return s.FaultRand
+}
+
+// Reseed starts the run's random numbers over from the given seed.
+func (s *State) Reseed(seed int64) {
+	s.Seed = seed
+	s.Rand = nil
+}
+
+// SeedNow returns the time generated dates are relative to, in place of
+// now.  It's recorded the first time it's needed, if the run didn't start
+// with one, so the dates can be repeated along with the seed.
+func (s *State) SeedNow() time.Time {
+	if s.SeedTime.IsZero() {
+		s.SeedTime = time.Now()
+	}
+	return s.SeedTime
+}
+
+// LoopState tracks how far a foreach loop has gotten, so it can pick up
+// where it left off when an action inside of it doesn't complete right away.
+type LoopState struct {
+	Index     int // the item being worked on
+	ActionIdx int // the action being worked on for that item
 }
 
 func NewState(t string) *State {
@@ -55,6 +197,57 @@ func NewState(t string) *State {
 
 }
 
+// StartRun starts the main run, once any setup is done.
+func (s *State) StartRun() {
+	s.Phase = PhaseRun
+	s.Started = time.Now()
+}
+
+// ClearInFlight drops anything the main run left half done, so the teardown
+// starts clean.  If a called plan was running, the launched plan's variables
+// are put back.
+func (s *State) ClearInFlight() {
+	s.WaitActionStartTime = time.Time{}
+	s.WaitActionTxn = ""
+	s.WaitActionDuration = 0
+	s.WaitRemaining = ""
+	s.Poll = nil
+	s.Plugin = nil
+	s.Loops = nil
+	s.Retries = 0
+	for i := len(s.CallStack) - 1; i >= 0; i-- {
+		if s.CallStack[i].Isolated {
+			s.Variables = s.CallStack[i].Variables
+		}
+	}
+	s.CallStack = nil
+}
+
+// CountCall counts another request answered by a url action, and returns
+// how many there have been since its transaction was entered.
+func (s *State) CountCall(key string) int {
+	if s.Calls == nil {
+		s.Calls = make(map[string]int)
+	}
+	s.Calls[key]++
+	return s.Calls[key]
+}
+
+// ClearCalls forgets the calls to a transaction's url actions, so that
+// they're counted from the start when it's entered again.
+func (s *State) ClearCalls(txn string) {
+	for k := range s.Calls {
+		if strings.HasPrefix(k, txn+"[") {
+			delete(s.Calls, k)
+		}
+	}
+}
+
+// NoteFault records a fault injected into a response to a request for path.
+func (s *State) NoteFault(txn string, path string, fault string) {
+	s.Faults = append(s.Faults, FaultEntry{Time: time.Now(), Txn: txn, Path: path, Fault: fault})
+}
+
 // Reset interrupts current testing actions
 // to return state to initial (init) state.
 func (s *State) Reset(n string) error {
@@ -79,6 +272,8 @@ func (s *State) NewState(name string) {
 	s.States = append(s.States, entry)
 	s.TxnActionIdx = 0
 	s.TxnActionsCompleted = false
+	s.Retries = 0
+	s.ClearCalls(name)
 }
 
 func (s *State) GetVariable(varname string) (interface{}, error) {
@@ -95,7 +290,7 @@ func (s *State) GetVariableRecursive(i interface{}, arr []*VariableEntity, value
 		i = s.Variables
 	}
 
-	if (arr == nil || len(arr) == 0) && value == nil {
+	if arr == nil || len(arr) == 0 {
 		return nil, errors.New("get recursive var: nil or empty var array")
 	}
 
@@ -106,6 +301,9 @@ func (s *State) GetVariableRecursive(i interface{}, arr []*VariableEntity, value
 			if reflect.TypeOf(i).String() == "[]interface {}" {
 				ri := i.([]interface{})
 				n := arr[0].Index
+				if n < 0 || n >= len(ri) {
+					return nil, errors.New("index " + fmt.Sprint(n) + " out of range")
+				}
 				ri[n] = value
 				return nil, nil
 			} else {
@@ -228,8 +426,7 @@ func (s *State) DoMapVariable(m map[string]interface{}, argarr []*VariableEntity
 	if m[key] == nil && value != nil {
 		logger.Debugf("variable %s does not exist, creating", key)
 		if len(argarr) >= 1 {
-			logger.Debugf("creating as map[string]interface{}")
-			m[key] = make(map[string]interface{}, 0)
+			m[key] = NewContainer(argarr[0])
 		} else {
 			m[key] = value
 			return nil, nil
@@ -244,6 +441,20 @@ func (s *State) DoMapVariable(m map[string]interface{}, argarr []*VariableEntity
 	}
 	if mtype == "map[string]interface {}" || mtype == "[]interface {}" {
 		logger.Debugf("%s[%v] (argarr: %+v)", mtype, key, argarr)
+		if len(argarr) == 0 {
+			// the whole map or array was asked for.
+			if value == nil {
+				return m[key], nil
+			}
+			if !IsContainer(value) {
+				return nil, errors.New("incompatible type " + valuetype + " to " + mtype)
+			}
+			m[key] = value
+			return "", nil
+		}
+		if value != nil {
+			m[key] = GrowArray(m[key], argarr[0])
+		}
 		res, err := s.GetVariableRecursive(m[key], argarr, value)
 		if err != nil {
 			return nil, err
@@ -323,12 +534,16 @@ func (s *State) DoArray(m []interface{}, argarr []*VariableEntity, idx int, valu
 	logger := loggo.GetLogger("default")
 
 	if m == nil {
-		// we're refusing to create one because we have no idea how large to make it
-		// I wish I was that psychic.
+		// arrays are created (and grown) by whatever holds them, since a slice
+		// can't be resized in place.  If we got here, nothing did.
 		return nil, errors.New("array does not exist and refusing to create one")
 	}
-	if idx > len(m) {
-		return nil, errors.New("index " + fmt.Sprint(len(m)) + " out of range")
+	if idx < 0 || idx >= len(m) {
+		return nil, errors.New("index " + fmt.Sprint(idx) + " out of range")
+	}
+	if m[idx] == nil && value != nil && len(argarr) >= 1 {
+		logger.Debugf("index %v does not exist, creating", idx)
+		m[idx] = NewContainer(argarr[0])
 	}
 	if m[idx] == nil {
 		return nil, errors.New("domapvariable value of key " + fmt.Sprint(idx) + " is nil")
@@ -340,6 +555,19 @@ func (s *State) DoArray(m []interface{}, argarr []*VariableEntity, idx int, valu
 	}
 	if mtype == "map[string]interface {}" || mtype == "[]interface {}" {
 		logger.Debugf("%s[%v] (argarr: %+v)", mtype, idx, argarr)
+		if len(argarr) == 0 {
+			if value == nil {
+				return m[idx], nil
+			}
+			if !IsContainer(value) {
+				return nil, errors.New("incompatible type " + valuetype + " to " + mtype)
+			}
+			m[idx] = value
+			return "", nil
+		}
+		if value != nil {
+			m[idx] = GrowArray(m[idx], argarr[0])
+		}
 		res, err := s.GetVariableRecursive(m[idx], argarr, value)
 		if err != nil {
 			return nil, err
@@ -428,6 +656,83 @@ func (s *State) SetVariable(varname string, value interface{}) error {
 	return err
 }
 
+// DeleteVariable removes a variable, a key from a map variable, or an
+// element from an array variable.
+func (s *State) DeleteVariable(varname string) error {
+	logger := loggo.GetLogger("default")
+	logger.Debugf("Deleting variable: %s", varname)
+	arr := ParseString(varname)
+	if len(arr) == 0 {
+		return errors.New("delete var: empty variable name")
+	}
+	last := arr[len(arr)-1]
+
+	var parent interface{} = s.Variables
+	if len(arr) > 1 {
+		p, err := s.GetVariableRecursive(nil, arr[:len(arr)-1], nil)
+		if err != nil {
+			return err
+		}
+		parent = p
+	}
+
+	if last.Name != "" {
+		m, ok := parent.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("cannot delete %s: not a map", last.Name)
+		}
+		if _, ok := m[last.Name]; !ok {
+			return fmt.Errorf("variable %s does not exist", varname)
+		}
+		delete(m, last.Name)
+		return nil
+	}
+
+	l, ok := parent.([]interface{})
+	if !ok {
+		return fmt.Errorf("cannot delete index %v: not an array", last.Index)
+	}
+	if last.Index < 0 || last.Index >= len(l) {
+		return errors.New("index " + fmt.Sprint(last.Index) + " out of range")
+	}
+	// removing an element means a new slice, so it has to be put back into
+	// whatever held the old one.
+	nl := make([]interface{}, 0, len(l)-1)
+	nl = append(nl, l[:last.Index]...)
+	nl = append(nl, l[last.Index+1:]...)
+	_, err := s.GetVariableRecursive(nil, arr[:len(arr)-1], nl)
+	return err
+}
+
+// IsContainer returns whether i is a map or an array variable.
+func IsContainer(i interface{}) bool {
+	switch i.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewContainer creates the map or array needed to hold the next
+// entity in a variable name, when writing to one that doesn't exist yet.
+func NewContainer(next *VariableEntity) interface{} {
+	if next.Name == "" {
+		return make([]interface{}, next.Index+1)
+	}
+	return make(map[string]interface{}, 0)
+}
+
+// GrowArray extends an array so that the next entity's index is in range.
+// Anything that isn't an array (or doesn't need growing) is returned as is.
+func GrowArray(i interface{}, next *VariableEntity) interface{} {
+	l, ok := i.([]interface{})
+	if !ok || next.Name != "" || next.Index < len(l) {
+		return i
+	}
+	return append(l, make([]interface{}, next.Index+1-len(l))...)
+}
+
 type VariableEntity struct {
 	Name  string
 	Index int
@@ -0,0 +1,189 @@
+package state
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestState_GetVariable(t *testing.T) {
+	tests := []struct {
+		name      string
+		variables map[string]interface{}
+		varname   string
+		want      interface{}
+		wantErr   bool
+	}{
+		{
+			name:      "whole map",
+			variables: map[string]interface{}{"m": map[string]interface{}{"a": "b"}},
+			varname:   "m",
+			want:      map[string]interface{}{"a": "b"},
+		},
+		{
+			name:      "whole array",
+			variables: map[string]interface{}{"l": []interface{}{"a", "b"}},
+			varname:   "l",
+			want:      []interface{}{"a", "b"},
+		},
+		{
+			name:      "map inside array",
+			variables: map[string]interface{}{"l": []interface{}{map[string]interface{}{"id": "1"}}},
+			varname:   "l[0]",
+			want:      map[string]interface{}{"id": "1"},
+		},
+		{
+			name:      "index out of range",
+			variables: map[string]interface{}{"l": []interface{}{"a"}},
+			varname:   "l[1]",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &State{Variables: tt.variables}
+			got, err := s.GetVariable(tt.varname)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetVariable() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetVariable() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestState_SetVariable(t *testing.T) {
+	tests := []struct {
+		name      string
+		variables map[string]interface{}
+		varname   string
+		value     interface{}
+		want      map[string]interface{}
+		wantErr   bool
+	}{
+		{
+			name:      "create intermediate array",
+			variables: map[string]interface{}{},
+			varname:   "orders[1].id",
+			value:     "abc",
+			want: map[string]interface{}{
+				"orders": []interface{}{nil, map[string]interface{}{"id": "abc"}},
+			},
+		},
+		{
+			name:      "grow existing array",
+			variables: map[string]interface{}{"m": map[string]interface{}{"l": []interface{}{"a"}}},
+			varname:   "m.l[2]",
+			value:     "c",
+			want:      map[string]interface{}{"m": map[string]interface{}{"l": []interface{}{"a", nil, "c"}}},
+		},
+		{
+			name:      "replace nested map",
+			variables: map[string]interface{}{"m": map[string]interface{}{"n": map[string]interface{}{"a": "b"}}},
+			varname:   "m.n",
+			value:     map[string]interface{}{"c": "d"},
+			want:      map[string]interface{}{"m": map[string]interface{}{"n": map[string]interface{}{"c": "d"}}},
+		},
+		{
+			name:      "insert key",
+			variables: map[string]interface{}{"m": map[string]interface{}{"a": "b"}},
+			varname:   "m.c",
+			value:     "d",
+			want:      map[string]interface{}{"m": map[string]interface{}{"a": "b", "c": "d"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &State{Variables: tt.variables}
+			err := s.SetVariable(tt.varname, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SetVariable() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(s.Variables, tt.want) {
+				t.Errorf("SetVariable() got = %v, want %v", s.Variables, tt.want)
+			}
+		})
+	}
+}
+
+func TestState_DeleteVariable(t *testing.T) {
+	tests := []struct {
+		name      string
+		variables map[string]interface{}
+		varname   string
+		want      map[string]interface{}
+		wantErr   bool
+	}{
+		{
+			name:      "top level",
+			variables: map[string]interface{}{"a": "b", "c": "d"},
+			varname:   "a",
+			want:      map[string]interface{}{"c": "d"},
+		},
+		{
+			name:      "map key",
+			variables: map[string]interface{}{"m": map[string]interface{}{"a": "b", "c": "d"}},
+			varname:   "m.a",
+			want:      map[string]interface{}{"m": map[string]interface{}{"c": "d"}},
+		},
+		{
+			name:      "array element",
+			variables: map[string]interface{}{"m": map[string]interface{}{"l": []interface{}{"a", "b", "c"}}},
+			varname:   "m.l[1]",
+			want:      map[string]interface{}{"m": map[string]interface{}{"l": []interface{}{"a", "c"}}},
+		},
+		{
+			name:      "nonexistent",
+			variables: map[string]interface{}{},
+			varname:   "a",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &State{Variables: tt.variables}
+			err := s.DeleteVariable(tt.varname)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DeleteVariable() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(s.Variables, tt.want) {
+				t.Errorf("DeleteVariable() got = %v, want %v", s.Variables, tt.want)
+			}
+		})
+	}
+}
+
+func TestState_FaultRandom(t *testing.T) {
+	draws := func(faults int) ([]int64, []int64) {
+		s := NewState("")
+		s.Seed = 42
+		var gen, flt []int64
+		for i := 0; i < 3; i++ {
+			for j := 0; j < faults; j++ {
+				flt = append(flt, s.FaultRandom().Int63())
+			}
+			gen = append(gen, s.Random().Int63())
+		}
+		return gen, flt
+	}
+	gen, flt := draws(0)
+	gen2, flt2 := draws(2)
+	if !reflect.DeepEqual(gen, gen2) {
+		t.Errorf("Random() = %v with faults, want %v", gen2, gen)
+	}
+	if len(flt) != 0 || len(flt2) != 6 {
+		t.Fatalf("FaultRandom() drew %d and %d, want 0 and 6", len(flt), len(flt2))
+	}
+	_, flt3 := draws(2)
+	if !reflect.DeepEqual(flt2, flt3) {
+		t.Errorf("FaultRandom() = %v, want %v for the same seed", flt3, flt2)
+	}
+}
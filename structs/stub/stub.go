@@ -0,0 +1,40 @@
+package stub
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"strings"
+
+	"github.com/homedepot/trainer/structs/expected"
+)
+
+// Stub is an endpoint that's always answered the same way, whatever the
+// test is doing, such as a config service or a token endpoint.  The url,
+// method, headers and query match requests the same way a url action's
+// do, and the response is given the same way as an on_expected.
+type Stub struct {
+	Name              string                 `yaml:"name" json:"name,omitempty"`
+	URL               string                 `yaml:"url" json:"url"`
+	Method            string                 `yaml:"method" json:"method,omitempty"`
+	Headers           map[string]interface{} `yaml:"headers" json:"headers,omitempty"`
+	Query             map[string]interface{} `yaml:"query" json:"query,omitempty"`
+	expected.Expected `yaml:",inline" json:"response"`
+	SaveCount         string `yaml:"save_count" json:"save_count,omitempty"` // a variable to keep the call count in, for plan stubs
+	MinCalls          *int   `yaml:"min_calls" json:"min_calls,omitempty"`   // checked when the plan's run stops, for plan stubs
+	MaxCalls          *int   `yaml:"max_calls" json:"max_calls,omitempty"`
+}
+
+// Key is what the stub's calls are counted under: its name, or its method
+// and url if it doesn't have one.
+func (s Stub) Key() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	if s.Method == "" {
+		return s.URL
+	}
+	return strings.ToUpper(s.Method) + " " + s.URL
+}
@@ -0,0 +1,56 @@
+package stub
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestStub_YAML(t *testing.T) {
+	in := `
+- name: flags
+  url: /flags/:app
+  method: GET
+  response_code: "200"
+  response_contenttype: application/json
+  body:
+    enabled: true
+  fault:
+    delay: 10ms
+  min_calls: 1
+- url: /token
+  method: post
+  response: data/token.json
+`
+	var stubs []Stub
+	if err := yaml.Unmarshal([]byte(in), &stubs); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if len(stubs) != 2 {
+		t.Fatalf("got %d stubs, want 2", len(stubs))
+	}
+	s := stubs[0]
+	if s.ResponseCode != "200" || s.ResponseType != "application/json" || s.Body == nil {
+		t.Errorf("response = %+v, want the inline response", s.Expected)
+	}
+	if s.Fault == nil || s.Fault.Delay != "10ms" {
+		t.Errorf("fault = %+v, want a 10ms delay", s.Fault)
+	}
+	if s.MinCalls == nil || *s.MinCalls != 1 {
+		t.Errorf("min_calls = %v, want 1", s.MinCalls)
+	}
+	if stubs[1].Response != "data/token.json" {
+		t.Errorf("response file = %q", stubs[1].Response)
+	}
+
+	for i, want := range []string{"flags", "POST /token"} {
+		if k := stubs[i].Key(); k != want {
+			t.Errorf("Key() = %q, want %q", k, want)
+		}
+	}
+}
@@ -14,6 +14,10 @@ import (
 type Transaction struct {
 	Name          string                  `yaml:"name" json:"name"`
 	URL           string                  `yaml:"url" json:"url"`
+	Method        string                  `yaml:"method" json:"method,omitempty"`
+	Headers       map[string]interface{}  `yaml:"headers" json:"headers,omitempty"`           // headers the request has to have
+	Query         map[string]interface{}  `yaml:"query" json:"query,omitempty"`               // query parameters the request has to have
+	ParamPrefix   string                  `yaml:"param_prefix" json:"param_prefix,omitempty"` // put in front of the names of parameters from the url
 	Data          string                  `yaml:"data" json:"data"`
 	Datatype      string                  `yaml:"datatype" json:"datatype"`
 	OnExpected    expected.Expected       `yaml:"on_expected" json:"on_expected"`
@@ -23,6 +27,7 @@ type Transaction struct {
 	Running       bool                    `yaml:"-" json:"-"` // set when the transaction is running - only if standalone
 	SaveBody      string                  `yaml:"save_body" json:"save_body"`
 	SaveBodyAsMap string                  `yaml:"save_body_as_map" json:"save_body_as_map"`
+	OnError       *planaction.OnError     `yaml:"on_error" json:"on_error,omitempty"` // for actions without their own
 }
 
 func (t *Transaction) CreateUrlAction() {
@@ -45,6 +50,18 @@ func (t *Transaction) CreateUrlAction() {
 		if t.Datatype != "" {
 			args["datatype"] = t.Datatype
 		}
+		if t.Method != "" {
+			args["method"] = t.Method
+		}
+		if len(t.Headers) > 0 {
+			args["headers"] = t.Headers
+		}
+		if len(t.Query) > 0 {
+			args["query"] = t.Query
+		}
+		if t.ParamPrefix != "" {
+			args["param_prefix"] = t.ParamPrefix
+		}
 		a.Type = "url"
 		a.Args = args
 		t.InitAction = append(t.InitAction, a)
@@ -0,0 +1,259 @@
+package templates
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// GeneralFuncs are the functions for templates that aren't about time.
+func GeneralFuncs() template.FuncMap {
+	return template.FuncMap{
+		"index":    Index,
+		"default":  Default,
+		"toJson":   ToJSON,
+		"fromJson": FromJSON,
+		"upper":    strings.ToUpper,
+		"lower":    strings.ToLower,
+		"trim":     strings.TrimSpace,
+		"replace": func(old string, new string, s string) string {
+			return strings.ReplaceAll(s, old, new)
+		},
+		"b64enc": func(s string) string {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		},
+		"b64dec": func(s string) (string, error) {
+			b, err := base64.StdEncoding.DecodeString(s)
+			return string(b), err
+		},
+		"uuid": func() (string, error) {
+			u, err := uuid.NewV4()
+			return u.String(), err
+		},
+		"env":  os.Getenv,
+		"add":  func(a, b interface{}) (interface{}, error) { return Arith("add", a, b) },
+		"sub":  func(a, b interface{}) (interface{}, error) { return Arith("sub", a, b) },
+		"mul":  func(a, b interface{}) (interface{}, error) { return Arith("mul", a, b) },
+		"div":  func(a, b interface{}) (interface{}, error) { return Arith("div", a, b) },
+		"mod":  func(a, b interface{}) (interface{}, error) { return Arith("mod", a, b) },
+		"date": FormatTime,
+	}
+}
+
+// Index is the builtin index, except that a missing map key is an empty
+// string rather than <no value>.  That's how templates have always treated
+// variables that aren't set.
+func Index(item interface{}, keys ...interface{}) (interface{}, error) {
+	v := reflect.ValueOf(item)
+	for _, k := range keys {
+		for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer) {
+			v = v.Elem()
+		}
+		if !v.IsValid() {
+			return nil, fmt.Errorf("index of nil with %v", k)
+		}
+		switch v.Kind() {
+		case reflect.Map:
+			kv := reflect.ValueOf(k)
+			if !kv.IsValid() {
+				return nil, errors.New("index with a nil key")
+			}
+			if !kv.Type().AssignableTo(v.Type().Key()) {
+				if !kv.Type().ConvertibleTo(v.Type().Key()) {
+					return nil, fmt.Errorf("index of %s with %T", v.Type(), k)
+				}
+				kv = kv.Convert(v.Type().Key())
+			}
+			e := v.MapIndex(kv)
+			if !e.IsValid() {
+				return "", nil
+			}
+			v = e
+		case reflect.Slice, reflect.Array, reflect.String:
+			n, err := toInt(k)
+			if err != nil {
+				return nil, fmt.Errorf("index of %s: %w", v.Type(), err)
+			}
+			if n < 0 || n >= v.Len() {
+				return nil, fmt.Errorf("index %d out of range", n)
+			}
+			v = v.Index(n)
+		default:
+			return nil, fmt.Errorf("can't index %s", v.Type())
+		}
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+	return v.Interface(), nil
+}
+
+// Default returns the value, unless it's empty (nil, zero, false, or an
+// empty string or collection), in which case it returns def.
+//
+//	<< index .Variables "qty" | default 1 >>
+func Default(def interface{}, v ...interface{}) interface{} {
+	if len(v) == 0 || empty(v[0]) {
+		return def
+	}
+	return v[0]
+}
+
+func empty(i interface{}) bool {
+	v := reflect.ValueOf(i)
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.String, reflect.Map, reflect.Slice, reflect.Array:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
+
+// ToJSON encodes a value as json.  Maps from yaml are handled too.
+func ToJSON(i interface{}) (string, error) {
+	b, err := json.Marshal(stringKeys(i))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// FromJSON decodes json into a value.
+func FromJSON(s string) (interface{}, error) {
+	var i interface{}
+	err := json.Unmarshal([]byte(s), &i)
+	return i, err
+}
+
+// stringKeys converts yaml's maps into maps json can encode.
+func stringKeys(i interface{}) interface{} {
+	switch v := i.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = stringKeys(e)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = stringKeys(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for n, e := range v {
+			l[n] = stringKeys(e)
+		}
+		return l
+	default:
+		return i
+	}
+}
+
+// Arith does arithmetic on two numbers, which can also be strings holding
+// numbers.  If they're both whole numbers, so is the answer (except for
+// division).
+func Arith(op string, a interface{}, b interface{}) (interface{}, error) {
+	ai, aint := wholeNumber(a)
+	bi, bint := wholeNumber(b)
+	if aint && bint && op != "div" {
+		switch op {
+		case "add":
+			return ai + bi, nil
+		case "sub":
+			return ai - bi, nil
+		case "mul":
+			return ai * bi, nil
+		case "mod":
+			if bi == 0 {
+				return nil, errors.New("mod by zero")
+			}
+			return ai % bi, nil
+		}
+	}
+	af, err := toFloat(a)
+	if err != nil {
+		return nil, err
+	}
+	bf, err := toFloat(b)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "add":
+		return af + bf, nil
+	case "sub":
+		return af - bf, nil
+	case "mul":
+		return af * bf, nil
+	case "div":
+		if bf == 0 {
+			return nil, errors.New("divide by zero")
+		}
+		return af / bf, nil
+	case "mod":
+		if bf == 0 {
+			return nil, errors.New("mod by zero")
+		}
+		return math.Mod(af, bf), nil
+	}
+	return nil, fmt.Errorf("unknown operation %s", op)
+}
+
+func wholeNumber(i interface{}) (int, bool) {
+	switch v := i.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func toInt(i interface{}) (int, error) {
+	if n, ok := wholeNumber(i); ok {
+		return n, nil
+	}
+	if f, ok := i.(float64); ok && f == math.Trunc(f) {
+		return int(f), nil
+	}
+	return 0, fmt.Errorf("%v is not a whole number", i)
+}
+
+func toFloat(i interface{}) (float64, error) {
+	switch v := i.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	}
+	return 0, fmt.Errorf("%v is not a number", i)
+}
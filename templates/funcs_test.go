@@ -0,0 +1,92 @@
+package templates
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"encoding/base64"
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	os.Setenv("TRAINER_TEMPLATE_TEST", "from env")
+	defer os.Unsetenv("TRAINER_TEMPLATE_TEST")
+
+	data := NewData(map[string]interface{}{
+		"name":  "widget",
+		"qty":   3,
+		"price": "2.5",
+		"empty": "",
+		"order": map[interface{}]interface{}{
+			"id":    "o1",
+			"lines": []interface{}{map[interface{}]interface{}{"sku": "a"}},
+		},
+		"json": `{"a": [1, 2]}`,
+	}, map[string]string{"api": "http://localhost"})
+
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		match   string
+		wantErr bool
+	}{
+		{name: "variable", in: `<<.Variables.name>>`, want: "widget"},
+		{name: "base", in: `<<index .Bases "api">>/x`, want: "http://localhost/x"},
+		{name: "nested", in: `<<index .Variables "order" "lines" 0 "sku">>`, want: "a"},
+		{name: "missing", in: `[<<index .Variables "nope">>]`, want: "[]"},
+		{name: "missing nested", in: `[<<index .Variables "nope" "deeper">>]`, want: "[]"},
+		{name: "index out of range", in: `<<index .Variables "order" "lines" 3>>`, wantErr: true},
+		{name: "default empty", in: `<<.Variables.empty | default "none">>`, want: "none"},
+		{name: "default set", in: `<<.Variables.name | default "none">>`, want: "widget"},
+		{name: "toJson", in: `<<toJson .Variables.order>>`, want: `{"id":"o1","lines":[{"sku":"a"}]}`},
+		{name: "fromJson", in: `<<index (fromJson .Variables.json) "a" 1>>`, want: "2"},
+		{name: "upper lower", in: `<<upper .Variables.name>> <<lower "ABC">>`, want: "WIDGET abc"},
+		{name: "replace", in: `<<replace "w" "g" .Variables.name>>`, want: "gidget"},
+		{name: "b64", in: `<<b64enc "hi">> <<b64dec "aGk=">>`, want: base64.StdEncoding.EncodeToString([]byte("hi")) + " hi"},
+		{name: "uuid", in: `<<uuid>>`, match: `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[0-9a-f]{4}-[0-9a-f]{12}$`},
+		{name: "env", in: `<<env "TRAINER_TEMPLATE_TEST">>`, want: "from env"},
+		{name: "int math", in: `<<add .Variables.qty 2>> <<sub 10 .Variables.qty>> <<mul .Variables.qty 4>> <<mod 7 .Variables.qty>>`, want: "5 7 12 1"},
+		{name: "float math", in: `<<mul .Variables.price .Variables.qty>> <<div 7 2>>`, want: "7.5 3.5"},
+		{name: "divide by zero", in: `<<div 1 0>>`, wantErr: true},
+		{name: "not a number", in: `<<add .Variables.name 1>>`, wantErr: true},
+		{name: "date", in: `<<date "date" 1622550600>>`, want: "2021-06-01"},
+		{name: "bad template", in: `<<.Variables.name`, wantErr: true},
+		{name: "unknown function", in: `<<frobnicate 1>>`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.name, tt.in, data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Render() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.match != "" {
+				if !regexp.MustCompile(tt.match).MatchString(got) {
+					t.Errorf("Render() = %q, want a match for %s", got, tt.match)
+				}
+			} else if got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderDelims(t *testing.T) {
+	got, err := RenderDelims("txn", `url: [[.Variables.url]] << keep >>`, "[[", "]]", map[string]interface{}{
+		"Variables": map[string]interface{}{"url": "/a"},
+	})
+	if err != nil {
+		t.Fatalf("RenderDelims() error = %v", err)
+	}
+	if got != "url: /a << keep >>" {
+		t.Errorf("RenderDelims() = %q", got)
+	}
+}
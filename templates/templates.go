@@ -0,0 +1,97 @@
+// Package templates is the one template engine used for args, payloads,
+// responses and expected data.  Templates use << and >> as delimiters, so
+// they don't trip over the braces in json.
+package templates
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/juju/loggo"
+	"text/template"
+	"time"
+)
+
+// Data is what a template gets to work with.  Variables holds every type of
+// variable, so maps and lists can be walked into.
+type Data struct {
+	Variables map[string]interface{}
+	Bases     map[string]string
+	Now       string
+	Request   *Request // only set for the response to a request
+}
+
+// Request is the request being answered, as a response template sees it.
+// Headers and Query hold the first value of each, and Body is the body
+// parsed as json or yaml, or nil if it isn't either.
+type Request struct {
+	Method  string
+	Path    string
+	Params  map[string]string
+	Query   map[string]string
+	Headers map[string]string
+	Body    interface{}
+	RawBody string
+}
+
+// NewData returns template data for the variables and bases, as of now.
+func NewData(variables map[string]interface{}, bases map[string]string) *Data {
+	return &Data{
+		Variables: variables,
+		Bases:     bases,
+		Now:       time.Now().Format(time.RFC3339Nano),
+	}
+}
+
+// New returns an empty template with the usual delimiters and all of the
+// functions.
+func New(name string) *template.Template {
+	return NewDelims(name, "<<", ">>")
+}
+
+// NewDelims is New with other delimiters.
+func NewDelims(name string, left string, right string) *template.Template {
+	return template.New(name).Delims(left, right).Funcs(Funcs())
+}
+
+// Render runs a template over the data.
+func Render(name string, in string, data interface{}) (string, error) {
+	return render(New(name), in, data)
+}
+
+// RenderDelims is Render with other delimiters.
+func RenderDelims(name string, in string, left string, right string, data interface{}) (string, error) {
+	return render(NewDelims(name, left, right), in, data)
+}
+
+func render(tt *template.Template, in string, data interface{}) (string, error) {
+	logger := loggo.GetLogger("default")
+
+	tpl, err := tt.Parse(in)
+	if err != nil {
+		logger.Warningf("Error parsing template: %s", err.Error())
+		return "", fmt.Errorf("parsing template: %w", err)
+	}
+	var b bytes.Buffer
+	err = tpl.Execute(&b, data)
+	if err != nil {
+		logger.Warningf("Error executing template: %s", err.Error())
+		return "", fmt.Errorf("executing template: %w", err)
+	}
+	logger.Tracef("returning: %s", b.String())
+	return b.String(), nil
+}
+
+// Funcs is the whole function library: the general functions and the time
+// functions.
+func Funcs() template.FuncMap {
+	f := GeneralFuncs()
+	for k, v := range TimeFuncs() {
+		f[k] = v
+	}
+	return f
+}
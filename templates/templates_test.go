@@ -0,0 +1,117 @@
+package templates
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewData(t *testing.T) {
+	vars := map[string]interface{}{"name": "World"}
+	bases := map[string]string{"api": "https://api.example.com"}
+	before := time.Now()
+	d := NewData(vars, bases)
+	if d.Variables["name"] != "World" || d.Bases["api"] != "https://api.example.com" {
+		t.Errorf("NewData() = %+v, want the variables and bases", d)
+	}
+	if d.Request != nil {
+		t.Errorf("NewData() request = %+v, want nil", d.Request)
+	}
+	now, err := time.Parse(time.RFC3339Nano, d.Now)
+	if err != nil {
+		t.Fatalf("NewData() now = %q, not rfc3339: %v", d.Now, err)
+	}
+	if now.Before(before.Truncate(time.Second)) || now.After(time.Now()) {
+		t.Errorf("NewData() now = %v, want about %v", now, before)
+	}
+}
+
+func TestRender_Data(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		variables map[string]interface{}
+		bases     map[string]string
+		request   *Request
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "simple variable substitution",
+			in:        "Hello <<.Variables.name>>",
+			variables: map[string]interface{}{"name": "World"},
+			want:      "Hello World",
+		},
+		{
+			name:  "base url substitution",
+			in:    "URL: <<.Bases.api>>",
+			bases: map[string]string{"api": "https://api.example.com"},
+			want:  "URL: https://api.example.com",
+		},
+		{
+			name:      "non-string variable",
+			in:        "Count: <<.Variables.count>>",
+			variables: map[string]interface{}{"count": 42},
+			want:      "Count: 42",
+		},
+		{
+			name: "missing variable",
+			in:   "Count: <<.Variables.count>>",
+			want: "Count: <no value>",
+		},
+		{
+			name:      "multiple variables",
+			in:        "<<.Variables.first>> and <<.Variables.second>>",
+			variables: map[string]interface{}{"first": "foo", "second": "bar"},
+			want:      "foo and bar",
+		},
+		{
+			name:    "request",
+			in:      "<<.Request.Method>> <<.Request.Params.id>> <<.Request.Body.amount>>",
+			request: &Request{Method: "POST", Params: map[string]string{"id": "42"}, Body: map[string]interface{}{"amount": 10}},
+			want:    "POST 42 10",
+		},
+		{
+			name:    "invalid template",
+			in:      "Bad template <<.Missing",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			in:      "<<.Missing>>",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := tt.variables
+			if vars == nil {
+				vars = map[string]interface{}{}
+			}
+			d := NewData(vars, tt.bases)
+			d.Request = tt.request
+			got, err := Render("test", tt.in, d)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender_Now(t *testing.T) {
+	d := NewData(map[string]interface{}{}, nil)
+	got, err := Render("test", "Time: <<.Now>>", d)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if got != "Time: "+d.Now {
+		t.Errorf("Render() = %q, want %q", got, "Time: "+d.Now)
+	}
+}
@@ -0,0 +1,235 @@
+package templates
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	_ "time/tzdata" // so zones work wherever trainer runs
+)
+
+// Layouts are the names that can be used instead of a go time layout.
+var Layouts = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"rfc1123":     time.RFC1123,
+	"rfc1123z":    time.RFC1123Z,
+	"rfc822":      time.RFC822,
+	"kitchen":     time.Kitchen,
+	"date":        "2006-01-02",
+	"datetime":    "2006-01-02 15:04:05",
+	"time":        "15:04:05",
+}
+
+// Layout returns the go time layout for a name, or the layout itself if
+// it isn't a name.
+func Layout(l string) string {
+	if v, ok := Layouts[strings.ToLower(l)]; ok {
+		return v
+	}
+	return l
+}
+
+// epochMillisCutoff separates epoch seconds from epoch milliseconds.  Epoch
+// seconds won't get this big for a very long time, and epoch milliseconds
+// haven't been this small since 2001.
+const epochMillisCutoff = 1e12
+
+// ToTime converts a time, an epoch (seconds or milliseconds) or a string
+// holding either an epoch or a time in one of the usual formats into a
+// time.Time.
+func ToTime(i interface{}) (time.Time, error) {
+	switch v := i.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		return *v, nil
+	case int:
+		return fromEpoch(int64(v)), nil
+	case int64:
+		return fromEpoch(v), nil
+	case float64:
+		return fromEpoch(int64(v)), nil
+	case string:
+		s := strings.TrimSpace(v)
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return fromEpoch(n), nil
+		}
+		for _, l := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02", time.RFC1123Z, time.RFC1123} {
+			if t, err := time.Parse(l, s); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("couldnt parse time %s", s)
+	default:
+		return time.Time{}, fmt.Errorf("cannot convert %T to a time", i)
+	}
+}
+
+func fromEpoch(n int64) time.Time {
+	if n >= epochMillisCutoff || n <= -epochMillisCutoff {
+		return time.UnixMilli(n).UTC()
+	}
+	return time.Unix(n, 0).UTC()
+}
+
+// ParseTime parses a string with a layout (or a layout name).
+func ParseTime(layout string, value string) (time.Time, error) {
+	return time.Parse(Layout(layout), value)
+}
+
+var offsetRe = regexp.MustCompile(`([0-9]*\.?[0-9]+)(w|d)`)
+
+// ParseOffset parses a duration, which on top of what go understands can
+// have days (d) and weeks (w), like 2d or -1w12h.
+func ParseOffset(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errors.New("empty offset")
+	}
+	neg := false
+	if s[0] == '-' || s[0] == '+' {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+	var d time.Duration
+	var err error
+	rest := offsetRe.ReplaceAllStringFunc(s, func(m string) string {
+		sm := offsetRe.FindStringSubmatch(m)
+		f, perr := strconv.ParseFloat(sm[1], 64)
+		if perr != nil {
+			err = perr
+			return ""
+		}
+		unit := 24 * time.Hour
+		if sm[2] == "w" {
+			unit *= 7
+		}
+		d += time.Duration(f * float64(unit))
+		return ""
+	})
+	if err != nil {
+		return 0, err
+	}
+	if rest != "" {
+		rd, err := time.ParseDuration(rest)
+		if err != nil {
+			return 0, err
+		}
+		d += rd
+	}
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+// AddTime adds an offset (see ParseOffset) to a time.
+func AddTime(offset string, i interface{}) (time.Time, error) {
+	t, err := ToTime(i)
+	if err != nil {
+		return time.Time{}, err
+	}
+	d, err := ParseOffset(offset)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.Add(d), nil
+}
+
+// InZone converts a time to the named zone, like America/New_York or UTC.
+func InZone(zone string, i interface{}) (time.Time, error) {
+	t, err := ToTime(i)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(loc), nil
+}
+
+// FormatTime formats a time with a layout (or a layout name).  The layouts
+// epoch and epoch_millis give the epoch instead.
+func FormatTime(layout string, i interface{}) (string, error) {
+	t, err := ToTime(i)
+	if err != nil {
+		return "", err
+	}
+	switch strings.ToLower(layout) {
+	case "epoch":
+		return strconv.FormatInt(t.Unix(), 10), nil
+	case "epoch_millis":
+		return strconv.FormatInt(t.UnixMilli(), 10), nil
+	}
+	return t.Format(Layout(layout)), nil
+}
+
+// CompareTimes returns -1, 0 or 1 depending on whether a is before, the
+// same as, or after b.
+func CompareTimes(a interface{}, b interface{}) (int, error) {
+	ta, err := ToTime(a)
+	if err != nil {
+		return 0, err
+	}
+	tb, err := ToTime(b)
+	if err != nil {
+		return 0, err
+	}
+	return ta.Compare(tb), nil
+}
+
+// TimeFuncs are the time functions for templates.  The time being worked
+// on comes last, so they can be piped:
+//
+//	<< now | addTime "2d" | inZone "America/Chicago" | formatTime "rfc3339" >>
+func TimeFuncs() template.FuncMap {
+	return template.FuncMap{
+		"now":        time.Now,
+		"toTime":     ToTime,
+		"parseTime":  ParseTime,
+		"addTime":    AddTime,
+		"inZone":     InZone,
+		"formatTime": FormatTime,
+		"epoch": func(i interface{}) (int64, error) {
+			t, err := ToTime(i)
+			return t.Unix(), err
+		},
+		"epochMillis": func(i interface{}) (int64, error) {
+			t, err := ToTime(i)
+			return t.UnixMilli(), err
+		},
+		"timeBefore": func(a interface{}, b interface{}) (bool, error) {
+			c, err := CompareTimes(a, b)
+			return c < 0, err
+		},
+		"timeAfter": func(a interface{}, b interface{}) (bool, error) {
+			c, err := CompareTimes(a, b)
+			return c > 0, err
+		},
+		"timeEqual": func(a interface{}, b interface{}) (bool, error) {
+			c, err := CompareTimes(a, b)
+			return c == 0, err
+		},
+		"timeDiff": func(a interface{}, b interface{}) (string, error) {
+			ta, err := ToTime(a)
+			if err != nil {
+				return "", err
+			}
+			tb, err := ToTime(b)
+			if err != nil {
+				return "", err
+			}
+			return ta.Sub(tb).String(), nil
+		},
+	}
+}
@@ -0,0 +1,145 @@
+package templates
+
+// trainer
+// Copyright 2021 The Home Depot
+// Licensed under the Apache License v2.0
+// See LICENSE for further details.
+
+import (
+	"bytes"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestToTime(t *testing.T) {
+	want := time.Date(2021, 6, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		in      interface{}
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "time", in: want, want: want},
+		{name: "epoch seconds", in: 1622550600, want: want},
+		{name: "epoch millis", in: int64(1622550600000), want: want},
+		{name: "json number", in: float64(1622550600000), want: want},
+		{name: "epoch string", in: "1622550600", want: want},
+		{name: "rfc3339", in: "2021-06-01T12:30:00Z", want: want},
+		{name: "rfc3339 offset", in: "2021-06-01T07:30:00-05:00", want: want},
+		{name: "date", in: "2021-06-01", want: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "garbage", in: "yesterday", wantErr: true},
+		{name: "bool", in: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToTime(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ToTime() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("ToTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOffset(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "90m", want: 90 * time.Minute},
+		{in: "2d", want: 48 * time.Hour},
+		{in: "-1w", want: -7 * 24 * time.Hour},
+		{in: "+1d12h", want: 36 * time.Hour},
+		{in: "-1.5d", want: -36 * time.Hour},
+		{in: "", wantErr: true},
+		{in: "2 days", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseOffset(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseOffset() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseOffset() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeFuncs(t *testing.T) {
+	vars := map[string]interface{}{
+		"ordered":   "2021-06-01T12:30:00Z",
+		"delivered": "2021-06-03",
+	}
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "add and format",
+			in:   `<< .ordered | addTime "2d" | formatTime "date" >>`,
+			want: "2021-06-03",
+		},
+		{
+			name: "zone",
+			in:   `<< .ordered | inZone "America/Chicago" | formatTime "15:04 MST" >>`,
+			want: "07:30 CDT",
+		},
+		{
+			name: "epoch millis",
+			in:   `<< epochMillis .ordered >>`,
+			want: "1622550600000",
+		},
+		{
+			name: "epoch format",
+			in:   `<< formatTime "epoch" .ordered >>`,
+			want: "1622550600",
+		},
+		{
+			name: "parse",
+			in:   `<< parseTime "01/02/2006" "06/01/2021" | formatTime "date" >>`,
+			want: "2021-06-01",
+		},
+		{
+			name: "compare",
+			in:   `<< if timeAfter .delivered .ordered >>late<< else >>early<< end >>`,
+			want: "late",
+		},
+		{
+			name: "diff",
+			in:   `<< timeDiff .delivered .ordered >>`,
+			want: "35h30m0s",
+		},
+		{
+			name:    "bad zone",
+			in:      `<< inZone "Mars/Olympus_Mons" .ordered >>`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tpl, err := template.New("test").Delims("<<", ">>").Funcs(TimeFuncs()).Parse(tt.in)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			var b bytes.Buffer
+			err = tpl.Execute(&b, vars)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && b.String() != tt.want {
+				t.Errorf("Execute() = %q, want %q", b.String(), tt.want)
+			}
+		})
+	}
+}